@@ -0,0 +1,62 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+)
+
+var cleanupOpts = &drivers.CleanupOptions{}
+
+func NewCmdCleanup(out io.Writer) *cobra.Command {
+	var cleanupCmd = &cobra.Command{
+		Use:   "cleanup",
+		Short: "Removes the containers and images left behind by the docker driver",
+		Long: `Finds the containers and images created by the docker driver, which are left
+behind by --save or an aborted run, through their labels, and removes them.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCleanup(cmd.Context(), out)
+		},
+	}
+
+	cleanupCmd.Flags().StringVar(&cleanupOpts.RunID, "run-id", "", "only remove the containers and images of this run")
+	cleanupCmd.Flags().DurationVar(&cleanupOpts.OlderThan, "older-than", 0, "only remove containers and images created at least this long ago (e.g. 24h)")
+	cleanupCmd.Flags().BoolVar(&cleanupOpts.DryRun, "dry-run", false, "list the containers and images without removing them")
+	return cleanupCmd
+}
+
+func runCleanup(ctx context.Context, out io.Writer) error {
+	resources, err := drivers.CleanupDocker(ctx, *cleanupOpts)
+	action := "Removed"
+	if cleanupOpts.DryRun {
+		action = "Would remove"
+	}
+	for _, r := range resources {
+		fmt.Fprintf(out, "%s %s\n", action, r)
+	}
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		fmt.Fprintln(out, "Nothing to clean up")
+	}
+	return nil
+}
@@ -52,6 +52,12 @@ func NewRootCommand(out, err io.Writer) *cobra.Command {
 	rootCmd.SilenceErrors = true
 	rootCmd.AddCommand(NewCmdVersion(out))
 	rootCmd.AddCommand(NewCmdTest(out))
+	rootCmd.AddCommand(NewCmdSnapshot(out))
+	rootCmd.AddCommand(NewCmdInit(out))
+	rootCmd.AddCommand(NewCmdValidate(out))
+	rootCmd.AddCommand(NewCmdSchema(out))
+	rootCmd.AddCommand(NewCmdCleanup(out))
+	rootCmd.AddCommand(NewCmdDebug(out))
 
 	rootCmd.PersistentFlags().StringVarP(&v, "verbosity", "v", logrus.WarnLevel.String(), "Log level (debug, info, warn, error, fatal, panic)")
 
@@ -0,0 +1,110 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleContainerTools/container-structure-test/cmd/container-structure-test/app/cmd/test"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+var debugOpts = &config.DebugOptions{}
+
+func NewCmdDebug(out io.Writer) *cobra.Command {
+	var debugCmd = &cobra.Command{
+		Use:   "debug",
+		Short: "Opens a shell in the environment of a command test",
+		Long: `Rebuilds the environment of a command test with the docker driver, as left by
+its setup commands and with its env vars and run options, and opens an
+interactive shell in it.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runDebug(cmd.Context(), out)
+		},
+	}
+
+	debugCmd.Flags().StringVarP(&debugOpts.ImagePath, "image", "i", "", "path to test image")
+	debugCmd.MarkFlagRequired("image")
+	debugCmd.Flags().StringVarP(&debugOpts.ConfigFile, "config", "c", "", "test config file")
+	debugCmd.MarkFlagRequired("config")
+	debugCmd.Flags().StringVar(&debugOpts.Test, "test", "", "name of the command test")
+	debugCmd.MarkFlagRequired("test")
+	debugCmd.Flags().StringToStringVar(&debugOpts.Vars, "set", nil, "set a template variable of the test config (key=value)")
+	debugCmd.Flags().StringVar(&debugOpts.Runtime, "runtime", "", "runtime to use with docker driver")
+	debugCmd.Flags().StringVar(&debugOpts.Platform, "platform", fmt.Sprintf("linux/%s", runtime.GOARCH), "Set platform if host is multi-platform capable")
+	debugCmd.Flags().StringVar(&debugOpts.Shell, "shell", v2.DebugShell, "shell to open in the environment of the test")
+	debugCmd.Flags().BoolVar(&debugOpts.Print, "print", false, "keep the environment and print the docker command opening a shell in it, instead of running it")
+	return debugCmd
+}
+
+func runDebug(ctx context.Context, out io.Writer) error {
+	args := &drivers.DriverConfig{
+		Driver:   drivers.Docker,
+		Image:    debugOpts.ImagePath,
+		Runtime:  debugOpts.Runtime,
+		Platform: debugOpts.Platform,
+		RunID:    drivers.NewRunID(),
+	}
+	tests, err := test.Parse(debugOpts.ConfigFile, debugOpts.Vars, args, drivers.InitDriverImpl(drivers.Docker))
+	if err != nil {
+		return err
+	}
+	st, ok := tests.(*v2.StructureTest)
+	if !ok {
+		return fmt.Errorf("%s: debug requires schemaVersion 2.0.0", debugOpts.ConfigFile)
+	}
+	driver, command, err := st.DebugCommandTest(ctx, debugOpts.Test, debugOpts.Shell)
+	if err != nil {
+		return errors.Wrapf(err, "rebuilding the environment of %s", debugOpts.Test)
+	}
+	if debugOpts.Print {
+		debugDriver, ok := driver.(drivers.DebugDriver)
+		if !ok {
+			driver.Destroy()
+			return errors.New("the driver cannot keep the environment of a test")
+		}
+		if err := debugDriver.Keep(ctx); err != nil {
+			driver.Destroy()
+			return errors.Wrapf(err, "keeping the environment of %s", debugOpts.Test)
+		}
+		fmt.Fprintln(out, utils.ShellJoin(command))
+		fmt.Fprintf(out, "# remove the environment with `container-structure-test cleanup --run-id %s`\n", args.RunID)
+		return nil
+	}
+	defer driver.Destroy()
+
+	// the shell is not cancelled on SIGINT, which it handles itself
+	shell := exec.Command(command[0], command[1:]...)
+	shell.Stdin = os.Stdin
+	shell.Stdout = os.Stdout
+	shell.Stderr = os.Stderr
+	if err := shell.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return errors.Wrap(err, "running docker")
+		}
+	}
+	return nil
+}
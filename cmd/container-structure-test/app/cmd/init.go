@@ -0,0 +1,102 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/scaffold"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+var initOpts = &config.InitOptions{}
+
+func NewCmdInit(out io.Writer) *cobra.Command {
+	var initCmd = &cobra.Command{
+		Use:   "init",
+		Short: "Generates a starter test config from an existing image",
+		Long: `Inspects an existing image and generates a test config matching
+its current metadata, key files and installed packages.`,
+		Args: func(cmd *cobra.Command, _ []string) error {
+			if initOpts.Driver == drivers.Host {
+				if initOpts.Metadata == "" {
+					return fmt.Errorf("Please provide path to image metadata file")
+				}
+			} else if initOpts.ImagePath == "" {
+				return fmt.Errorf("Please supply path to image to generate a config for")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runInit(cmd.Context(), out)
+		},
+	}
+
+	AddInitFlags(initCmd)
+	return initCmd
+}
+
+func runInit(ctx context.Context, out io.Writer) error {
+	if initOpts.Driver == drivers.Host && !utils.UserConfirmation(warnMessage, initOpts.Force) {
+		return errors.New("aborted by user")
+	}
+	driverImpl := drivers.InitDriverImpl(initOpts.Driver)
+	if driverImpl == nil {
+		return fmt.Errorf("unsupported driver type: %s", initOpts.Driver)
+	}
+	driver, err := driverImpl(drivers.DriverConfig{
+		Image:    initOpts.ImagePath,
+		Metadata: initOpts.Metadata,
+		Runtime:  initOpts.Runtime,
+		Platform: initOpts.Platform,
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating driver")
+	}
+	defer driver.Destroy()
+
+	contents, err := scaffold.Generate(ctx, driver)
+	if err != nil {
+		return err
+	}
+	if initOpts.Output == "" {
+		_, err = out.Write(contents)
+		return err
+	}
+	if err := os.WriteFile(initOpts.Output, contents, 0644); err != nil {
+		return errors.Wrap(err, "writing config")
+	}
+	fmt.Fprintf(out, "Generated test config %s\n", initOpts.Output)
+	return nil
+}
+
+func AddInitFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&initOpts.ImagePath, "image", "i", "", "path to image to generate a config for")
+	cmd.Flags().StringVarP(&initOpts.Driver, "driver", "d", "docker", "driver to use when inspecting the image")
+	cmd.Flags().StringVar(&initOpts.Metadata, "metadata", "", "path to image metadata file")
+	cmd.Flags().StringVar(&initOpts.Runtime, "runtime", "", "runtime to use with docker driver")
+	cmd.Flags().StringVar(&initOpts.Platform, "platform", fmt.Sprintf("linux/%s", runtime.GOARCH), "Set platform if host is multi-platform capable")
+	cmd.Flags().BoolVarP(&initOpts.Force, "force", "f", false, "force run of host driver (without user prompt)")
+	cmd.Flags().StringVarP(&initOpts.Output, "output", "o", "", "file to write the generated config to (default: stdout)")
+}
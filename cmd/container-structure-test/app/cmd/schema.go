@@ -0,0 +1,62 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/schema"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types"
+)
+
+var schemaVersion string
+
+func NewCmdSchema(out io.Writer) *cobra.Command {
+	var schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Prints the JSON Schema of the test config",
+		Long: `Prints the JSON Schema of the test config for the given schema version,
+for use by editors and other config validation tools.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runSchema(out)
+		},
+	}
+
+	schemaCmd.Flags().StringVar(&schemaVersion, "schema-version", "2.0.0", "schema version of the test config")
+	return schemaCmd
+}
+
+func runSchema(out io.Writer) error {
+	newStructureTest, ok := types.SchemaVersions[schemaVersion]
+	if !ok {
+		return fmt.Errorf("Unsupported schema version: %s", schemaVersion)
+	}
+	s := schema.Generate(fmt.Sprintf("container-structure-test config %s", schemaVersion), newStructureTest())
+	properties := s["properties"].(schema.Schema)
+	properties["schemaVersion"] = schema.Schema{"const": schemaVersion}
+	s["required"] = []string{"schemaVersion"}
+
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling schema")
+	}
+	_, err = fmt.Fprintln(out, string(contents))
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/snapshot"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+var snapshotOpts = &config.SnapshotOptions{}
+
+func NewCmdSnapshot(out io.Writer) *cobra.Command {
+	var snapshotCmd = &cobra.Command{
+		Use:   "snapshot",
+		Short: "Records the state of an image into a golden file",
+		Long: `Records a normalized manifest of an image into a golden file,
+which can then be checked for drift with snapshotTests.`,
+		Args: func(cmd *cobra.Command, _ []string) error {
+			if snapshotOpts.Driver == drivers.Host {
+				if snapshotOpts.Metadata == "" {
+					return fmt.Errorf("Please provide path to image metadata file")
+				}
+			} else if snapshotOpts.ImagePath == "" {
+				return fmt.Errorf("Please supply path to image to snapshot")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runSnapshot(cmd.Context(), out)
+		},
+	}
+
+	AddSnapshotFlags(snapshotCmd)
+	return snapshotCmd
+}
+
+func runSnapshot(ctx context.Context, out io.Writer) error {
+	if snapshotOpts.Driver == drivers.Host && !utils.UserConfirmation(warnMessage, snapshotOpts.Force) {
+		return errors.New("aborted by user")
+	}
+	driverImpl := drivers.InitDriverImpl(snapshotOpts.Driver)
+	if driverImpl == nil {
+		return fmt.Errorf("unsupported driver type: %s", snapshotOpts.Driver)
+	}
+	driver, err := driverImpl(drivers.DriverConfig{
+		Image:    snapshotOpts.ImagePath,
+		Metadata: snapshotOpts.Metadata,
+		Runtime:  snapshotOpts.Runtime,
+		Platform: snapshotOpts.Platform,
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating driver")
+	}
+	defer driver.Destroy()
+
+	m, err := snapshot.Record(ctx, driver, snapshot.Options{
+		Paths:   snapshotOpts.Paths,
+		Digests: snapshotOpts.Digests,
+		Ignore:  snapshotOpts.Ignore,
+	})
+	if err != nil {
+		return err
+	}
+	if err := m.Write(snapshotOpts.Output); err != nil {
+		return errors.Wrap(err, "writing golden file")
+	}
+	fmt.Fprintf(out, "Recorded %d files into %s\n", len(m.Files), snapshotOpts.Output)
+	return nil
+}
+
+func AddSnapshotFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&snapshotOpts.ImagePath, "image", "i", "", "path to image to snapshot")
+	cmd.Flags().StringVarP(&snapshotOpts.Driver, "driver", "d", "docker", "driver to use when recording the snapshot")
+	cmd.Flags().StringVar(&snapshotOpts.Metadata, "metadata", "", "path to image metadata file")
+	cmd.Flags().StringVar(&snapshotOpts.Runtime, "runtime", "", "runtime to use with docker driver")
+	cmd.Flags().StringVar(&snapshotOpts.Platform, "platform", fmt.Sprintf("linux/%s", runtime.GOARCH), "Set platform if host is multi-platform capable")
+	cmd.Flags().BoolVarP(&snapshotOpts.Force, "force", "f", false, "force run of host driver (without user prompt)")
+	cmd.Flags().StringVarP(&snapshotOpts.Output, "output", "o", "", "golden file to write the snapshot to")
+	cmd.MarkFlagRequired("output")
+	cmd.Flags().StringArrayVar(&snapshotOpts.Paths, "path", []string{"/"}, "root of the file tree to record")
+	cmd.Flags().StringArrayVar(&snapshotOpts.Digests, "digest", []string{}, "pattern of files to record the sha256 digest of")
+	cmd.Flags().StringArrayVar(&snapshotOpts.Ignore, "ignore", []string{}, "pattern of files to leave out of the snapshot")
+}
@@ -15,14 +15,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"regexp"
 	"runtime"
+	"syscall"
 
 	"github.com/GoogleContainerTools/container-structure-test/cmd/container-structure-test/app/cmd/test"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 
+	"github.com/GoogleContainerTools/container-structure-test/internal/pkgutil"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/color"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
@@ -86,7 +91,7 @@ func NewCmdTest(out io.Writer) *cobra.Command {
 				opts.Output = unversioned.Json
 			}
 
-			return run(out)
+			return run(cmd.Context(), out)
 		},
 	}
 
@@ -94,17 +99,60 @@ func NewCmdTest(out io.Writer) *cobra.Command {
 	return testCmd
 }
 
-func run(out io.Writer) error {
+func run(ctx context.Context, out io.Writer) error {
+	// report every config error upfront, before loading or pulling any image
+	if err := validateConfigs(opts.ConfigFiles, opts.Vars, func(p test.Problem) {
+		logrus.Error(p.String())
+	}); err != nil {
+		return err
+	}
+
+	filter := unversioned.TestFilter{
+		IncludeTags: opts.IncludeTags,
+		ExcludeTags: opts.ExcludeTags,
+	}
+	if opts.Run != "" {
+		run, err := regexp.Compile(opts.Run)
+		if err != nil {
+			return fmt.Errorf("invalid --run regex %s: %v", opts.Run, err)
+		}
+		filter.Run = run
+	}
+
 	args = &drivers.DriverConfig{
-		Image:    opts.ImagePath,
-		Save:     opts.Save,
-		Metadata: opts.Metadata,
-		Runtime:  opts.Runtime,
-		Platform: opts.Platform,
+		Driver:        opts.Driver,
+		Image:         opts.ImagePath,
+		Save:          opts.Save,
+		Metadata:      opts.Metadata,
+		Runtime:       opts.Runtime,
+		Platform:      opts.Platform,
+		BaselineImage: opts.BaselineImage,
+
+		SingleContainer: opts.SingleContainer,
+		Compatibility:   opts.Compatibility,
+		DebugOnFailure:  opts.DebugOnFailure,
+		Strict:          opts.Strict,
+
+		RunID: drivers.NewRunID(),
+	}
+	if opts.Save && opts.Driver == drivers.Docker {
+		logrus.Warnf("the containers and images of this run are kept, and labelled with run ID %s; remove them with `container-structure-test cleanup --run-id %s`", args.RunID, args.RunID)
 	}
 
+	// on SIGINT or SIGTERM, no further tests are started and the containers and
+	// images created so far are removed, before a partial report is written
+	ctx, cancel := interruptContext(ctx)
+	defer cancel()
+
 	var err error
 
+	if opts.Compatibility && opts.Driver != drivers.Docker {
+		return fmt.Errorf("--compatibility is only supported with the docker driver")
+	}
+	if opts.DebugOnFailure && opts.Driver != drivers.Docker {
+		return fmt.Errorf("--debug-on-failure is only supported with the docker driver")
+	}
+
 	if opts.ImageFromLayout != "" {
 		if opts.Driver != drivers.Docker {
 			logrus.Fatal("--image-from-oci-layout is not supported when not using Docker driver")
@@ -181,6 +229,7 @@ func run(out io.Writer) error {
 			logrus.Fatalf("error connecting to daemon: %v", err)
 		}
 		if err = client.PullImage(docker.PullImageOptions{
+			Context:      ctx,
 			Platform:     opts.Platform,
 			Repository:   ref.Context().RepositoryStr(),
 			Tag:          ref.Identifier(),
@@ -202,18 +251,54 @@ func run(out io.Writer) error {
 	if err != nil {
 		logrus.Fatal(err.Error())
 	}
+
+	if opts.Driver == drivers.Tar {
+		// the image is unpacked once, and shared by the tests of every config file
+		cache, err := pkgutil.NewImageCache(opts.CacheDir, opts.CacheSizeLimit*1024*1024)
+		if err != nil {
+			return err
+		}
+		if opts.Save {
+			cache.Keep()
+		}
+		defer cache.Close()
+		args.ImageCache = cache
+	}
+
 	channel := make(chan interface{}, 1)
-	go runTests(out, channel, args, driverImpl)
+	go runTests(ctx, out, channel, args, driverImpl, filter)
 	// TODO(nkubala): put a sync.WaitGroup here
-	return test.ProcessResults(out, opts.Output, opts.JunitSuiteName, channel)
+	return test.ProcessResults(ctx, out, opts.Output, opts.JunitSuiteName, channel)
 }
 
-func runTests(out io.Writer, channel chan interface{}, args *drivers.DriverConfig, driverImpl func(drivers.DriverConfig) (drivers.Driver, error)) {
+// interruptContext returns a context which is cancelled on the first SIGINT or
+// SIGTERM. Signals are handled as usual from then on, so that a second one exits
+// immediately, without cleaning up.
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			logrus.Warnf("received %s, cleaning up and writing a partial report; interrupt again to exit immediately", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func runTests(ctx context.Context, out io.Writer, channel chan interface{}, args *drivers.DriverConfig, driverImpl func(drivers.DriverConfig) (drivers.Driver, error), filter unversioned.TestFilter) {
 	for _, file := range opts.ConfigFiles {
+		if ctx.Err() != nil {
+			break
+		}
 		if opts.Output == unversioned.Text {
 			output.Banner(out, file)
 		}
-		tests, err := test.Parse(file, args, driverImpl)
+		tests, err := test.Parse(file, opts.Vars, args, driverImpl)
 		if err != nil {
 			channel <- &unversioned.TestResult{
 				Errors: []string{
@@ -222,7 +307,8 @@ func runTests(out io.Writer, channel chan interface{}, args *drivers.DriverConfi
 			}
 			continue // Continue with other config files
 		}
-		tests.RunAll(channel, file)
+		tests.SetFilter(filter)
+		tests.RunAll(ctx, channel, file)
 	}
 	close(channel)
 }
@@ -234,12 +320,19 @@ func AddTestFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&opts.IgnoreRefAnnotation, "ignore-ref-annotation", false, "ignore the org.opencontainers.image.ref.name and use --default-image-tag when loading to daemon")
 	cmd.MarkFlagsMutuallyExclusive("image", "image-from-oci-layout")
 	cmd.Flags().StringVarP(&opts.Driver, "driver", "d", "docker", "driver to use when running tests")
+	cmd.Flags().StringVar(&opts.BaselineImage, "baseline-image", "", "reference image to compare against in diff tests")
 	cmd.Flags().StringVar(&opts.Metadata, "metadata", "", "path to image metadata file")
 	cmd.Flags().StringVar(&opts.Runtime, "runtime", "", "runtime to use with docker driver")
 	cmd.Flags().StringVar(&opts.Platform, "platform", fmt.Sprintf("linux/%s", runtime.GOARCH), "Set platform if host is multi-platform capable")
 	cmd.Flags().BoolVar(&opts.Pull, "pull", false, "force a pull of the image before running tests")
 	cmd.MarkFlagsMutuallyExclusive("image-from-oci-layout", "pull")
 	cmd.Flags().BoolVar(&opts.Save, "save", false, "preserve created containers after test run")
+	cmd.Flags().StringVar(&opts.CacheDir, "cache-dir", "", "directory the tar driver keeps unpacked images in between runs, keyed by image digest (defaults to a temp dir for the run)")
+	cmd.Flags().Int64Var(&opts.CacheSizeLimit, "cache-size-limit", 10240, "size in MiB that --cache-dir is trimmed to after the run, removing the least recently used images first (0 for no limit)")
+	cmd.Flags().BoolVar(&opts.SingleContainer, "single-container", false, "run the setup, command and teardown of each command test in one container with the docker driver, instead of committing an image per step")
+	cmd.Flags().BoolVar(&opts.Compatibility, "compatibility", false, "re-run each command test under an arbitrary UID with gid 0, a read-only root filesystem, no capabilities and no network, and report the tests which only pass in the default run")
+	cmd.Flags().BoolVar(&opts.Strict, "strict", false, "fail the tests which need features the driver does not support, such as command tests with the tar driver, instead of skipping them")
+	cmd.Flags().BoolVar(&opts.DebugOnFailure, "debug-on-failure", false, "keep the containers and images of failing command tests with the docker driver, and print the command opening a shell in their environment")
 	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "flag to suppress output")
 	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "force run of host driver (without user prompt)")
 	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "output test results in json format")
@@ -250,5 +343,9 @@ func AddTestFlags(cmd *cobra.Command) {
 
 	cmd.Flags().StringArrayVarP(&opts.ConfigFiles, "config", "c", []string{}, "test config files")
 	cmd.MarkFlagRequired("config")
+	cmd.Flags().StringSliceVar(&opts.IncludeTags, "include-tags", nil, "only run tests with at least one of these tags")
+	cmd.Flags().StringSliceVar(&opts.ExcludeTags, "exclude-tags", nil, "skip tests with any of these tags")
+	cmd.Flags().StringVar(&opts.Run, "run", "", "only run tests whose name matches this regex")
+	cmd.Flags().StringToStringVar(&opts.Vars, "set", nil, "set a template variable of the test configs (key=value)")
 	cmd.Flags().StringVar(&opts.TestReport, "test-report", "", "generate test report and write it to specified file (supported format: json, junit; default: json)")
 }
@@ -0,0 +1,226 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types"
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
+)
+
+// configFile is a single file of the include graph of a config, rendered with
+// the variables in effect for it.
+type configFile struct {
+	path     string
+	source   string // path relative to the directory of the root config
+	contents []byte
+	tests    types.StructureTest
+}
+
+// configError is an error in a single file of the include graph.
+type configError struct {
+	path     string
+	contents []byte // rendered contents of the file, if it could be rendered
+	err      error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+// loader resolves the include graph of a config file.
+type loader struct {
+	rootDir string
+	visited map[string]bool
+	stack   []string
+	files   []*configFile
+}
+
+// loadConfigFiles renders and parses a config file, along with every file it
+// includes, directly or indirectly. Files are returned in the order they are
+// first included, starting with the root config. A file included more than once
+// is only returned the first time, and include cycles are reported as errors.
+func loadConfigFiles(fp string, vars map[string]string) ([]*configFile, error) {
+	l := &loader{
+		rootDir: filepath.Dir(fp),
+		visited: map[string]bool{},
+	}
+	if err := l.load(fp, vars); err != nil {
+		return nil, err
+	}
+	return l.files, nil
+}
+
+func (l *loader) load(fp string, inherited map[string]string) error {
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return err
+	}
+	for i, p := range l.stack {
+		if p == abs {
+			cycle := append(append([]string{}, l.stack[i:]...), abs)
+			return errors.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if l.visited[abs] {
+		return nil
+	}
+	l.visited[abs] = true
+	l.stack = append(l.stack, abs)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	raw, err := os.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	// only the files which use variables are rendered, so that the braces of
+	// plain configs, e.g. in docker --format strings, are left as they are
+	vars, contents := inherited, raw
+	if declaresVars(raw) || len(inherited) > 0 {
+		if vars, err = fileVars(fp, raw, inherited); err != nil {
+			return &configError{path: fp, err: err}
+		}
+		if contents, err = render(fp, raw, vars, "missingkey=error"); err != nil {
+			return &configError{path: fp, err: err}
+		}
+	}
+	tests, err := parseContents(fp, contents)
+	if err != nil {
+		return &configError{path: fp, contents: contents, err: err}
+	}
+	source, err := filepath.Rel(l.rootDir, fp)
+	if err != nil {
+		source = fp
+	}
+	l.files = append(l.files, &configFile{
+		path:     fp,
+		source:   source,
+		contents: contents,
+		tests:    tests,
+	})
+
+	st, ok := tests.(*v2.StructureTest)
+	if !ok {
+		return nil
+	}
+	for _, include := range st.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(fp), include)
+		}
+		files, err := includedFiles(include)
+		if err != nil {
+			return errors.Wrapf(err, "including %s from %s", include, fp)
+		}
+		for _, f := range files {
+			if err := l.load(f, vars); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// varsBlock matches the top level vars block of a YAML or JSON config which is not
+// valid YAML before it is rendered.
+var varsBlock = regexp.MustCompile(`(?m)^(vars|\s*"vars")\s*:`)
+
+// declaresVars reports whether a config file declares a vars block.
+func declaresVars(raw []byte) bool {
+	var header map[interface{}]interface{}
+	if err := yaml.Unmarshal(raw, &header); err != nil {
+		return varsBlock.Match(raw)
+	}
+	_, ok := header["vars"]
+	return ok
+}
+
+// fileVars returns the variables in effect for a config file: the defaults from its
+// vars block, overridden by the variables inherited from the including file or set
+// on the command line.
+func fileVars(fp string, raw []byte, inherited map[string]string) (map[string]string, error) {
+	// the vars block is read from a lenient render, since it cannot refer to itself
+	contents, err := render(fp, raw, inherited, "missingkey=zero")
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Vars map[string]string `yaml:"vars"`
+	}
+	// errors are reported by the strict parse of the fully rendered file
+	_ = yaml.Unmarshal(contents, &header)
+
+	vars := map[string]string{}
+	for k, v := range header.Vars {
+		vars[k] = v
+	}
+	for k, v := range inherited {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// render executes a config file as a Go template, with its variables as data.
+func render(fp string, raw []byte, vars map[string]string, missingKey string) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(fp)).Option(missingKey).Parse(string(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing config template")
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return nil, errors.Wrap(err, "rendering config template")
+	}
+	return b.Bytes(), nil
+}
+
+// includedFiles returns the config files referred to by an include: the file
+// itself, or every config file in it if it is a directory.
+func includedFiles(include string) ([]string, error) {
+	info, err := os.Stat(include)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{include}, nil
+	}
+	entries, err := os.ReadDir(include)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(include, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		fp := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseFileIncludes(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"config.yaml": `schemaVersion: 2.0.0
+vars:
+  user: app
+include:
+  - common
+  - common/os.yaml
+commandTests:
+  - name: whoami
+    command: whoami
+    expectedOutput: ["{{ .user }}"]
+`,
+		"common/os.yaml": `schemaVersion: 2.0.0
+vars:
+  release: bookworm
+fileContentTests:
+  - name: os release
+    path: /etc/os-release
+    expectedContents: ["{{ .release }}"]
+`,
+		"common/user.yaml": `schemaVersion: 2.0.0
+include: [os.yaml]
+commandTests:
+  - name: whoami
+    command: whoami
+    expectedOutput: ["{{ .user }}"]
+  - name: home
+    command: sh
+    args: ["-c", "echo $HOME"]
+    expectedOutput: ["/home/{{ .user }}"]
+`,
+	})
+
+	tests, err := ParseFile(filepath.Join(dir, "config.yaml"), map[string]string{"release": "trixie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := tests.(*v2.StructureTest)
+
+	var names, outputs []string
+	for _, ct := range st.CommandTests {
+		names = append(names, ct.Name)
+		outputs = append(outputs, ct.ExpectedOutput...)
+	}
+	// the whoami test of user.yaml is identical to the one of the root config
+	testutil.CheckDeepEqual(t, []string{"whoami", "home (from common/user.yaml)"}, names)
+	testutil.CheckDeepEqual(t, []string{"app", "/home/app"}, outputs)
+	// os.yaml is included twice, but merged once
+	testutil.CheckDeepEqual(t, 1, len(st.FileContentTests))
+	testutil.CheckDeepEqual(t, "os release (from common/os.yaml)", st.FileContentTests[0].Name)
+	testutil.CheckDeepEqual(t, []string{"trixie"}, st.FileContentTests[0].ExpectedContents)
+}
+
+func TestParseFileLiteralBraces(t *testing.T) {
+	config := `schemaVersion: 2.0.0
+include: [base.yaml]
+metadataTest:
+  workdir: /app
+commandTests:
+  - name: os
+    command: docker
+    args: ["inspect", "--format", "{{.Os}}", "image"]
+    expectedOutput: ['{"os": {{']
+`
+	dir := writeConfigs(t, map[string]string{
+		"config.yaml": config,
+		// the same metadata test is not a conflict
+		"base.yaml": "schemaVersion: 2.0.0\nmetadataTest:\n  workdir: /app\n",
+	})
+	// configs without variables are not rendered
+	tests, err := ParseFile(filepath.Join(dir, "config.yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := tests.(*v2.StructureTest).CommandTests[0]
+	testutil.CheckDeepEqual(t, []string{"inspect", "--format", "{{.Os}}", "image"}, ct.Args)
+	testutil.CheckDeepEqual(t, []string{`{"os": {{`}, ct.ExpectedOutput)
+
+	// while they are once variables are set
+	if _, err := ParseFile(filepath.Join(dir, "config.yaml"), map[string]string{"user": "app"}); err == nil {
+		t.Error("expected rendering the config with variables to fail")
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config.yaml": "schemaVersion: 2.0.0\ninclude: [a.yaml]\n",
+				"a.yaml":      "schemaVersion: 2.0.0\ninclude: [b.yaml]\n",
+				"b.yaml":      "schemaVersion: 2.0.0\ninclude: [a.yaml]\n",
+			},
+			expected: "include cycle: ",
+		},
+		{
+			name: "undefined variable",
+			files: map[string]string{
+				"config.yaml": "schemaVersion: 2.0.0\nvars:\n  user: app\ncommandTests:\n  - name: '{{ .missing }}'\n    command: echo\n",
+			},
+			expected: "rendering config template",
+		},
+		{
+			name: "conflicting metadata test",
+			files: map[string]string{
+				"config.yaml": "schemaVersion: 2.0.0\ninclude: [base.yaml]\nmetadataTest:\n  workdir: /app\n",
+				"base.yaml":   "schemaVersion: 2.0.0\nmetadataTest:\n  workdir: /\n",
+			},
+			expected: "base.yaml: metadataTest: the metadataTest of base.yaml conflicts with the one of the including config",
+		},
+		{
+			name: "conflicting run options",
+			files: map[string]string{
+				"config.yaml": "schemaVersion: 2.0.0\ninclude: [base.yaml]\ncontainerRunOptions:\n  user: app\n",
+				"base.yaml":   "schemaVersion: 2.0.0\ncontainerRunOptions:\n  user: root\n",
+			},
+			expected: "base.yaml: containerRunOptions: the containerRunOptions of base.yaml conflicts with the one of the including config",
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.yaml": "schemaVersion: 2.0.0\ninclude: [missing.yaml]\n",
+			},
+			expected: "including ",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeConfigs(t, test.files)
+			_, err := ParseFile(filepath.Join(dir, "config.yaml"), nil)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
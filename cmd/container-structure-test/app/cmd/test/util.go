@@ -15,10 +15,10 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"time"
 
@@ -27,6 +27,7 @@ import (
 	"github.com/GoogleContainerTools/container-structure-test/pkg/output"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -34,9 +35,7 @@ import (
 
 func ValidateArgs(opts *config.StructureTestOptions) error {
 	if opts.Driver == drivers.Host {
-		if opts.Metadata == "" {
-			return fmt.Errorf("Please provide path to image metadata file")
-		}
+		// without a metadata file, the tests which need the image config are skipped
 		if opts.ImagePath != "" {
 			return fmt.Errorf("Cannot provide both image path and metadata file")
 		}
@@ -54,12 +53,38 @@ func ValidateArgs(opts *config.StructureTestOptions) error {
 	return nil
 }
 
-func Parse(fp string, args *drivers.DriverConfig, driverImpl func(drivers.DriverConfig) (drivers.Driver, error)) (types.StructureTest, error) {
-	testContents, err := os.ReadFile(fp)
+func Parse(fp string, vars map[string]string, args *drivers.DriverConfig, driverImpl func(drivers.DriverConfig) (drivers.Driver, error)) (types.StructureTest, error) {
+	tests, err := ParseFile(fp, vars)
 	if err != nil {
 		return nil, err
 	}
+	tests.SetDriverImpl(driverImpl, *args)
+	return tests, nil
+}
 
+// ParseFile strictly parses a config file into the structure test of its schema version.
+// Files which declare variables, or are given some, are rendered as templates, and the
+// tests of every file the config includes are merged into it.
+func ParseFile(fp string, vars map[string]string) (types.StructureTest, error) {
+	files, err := loadConfigFiles(fp, vars)
+	if err != nil {
+		return nil, err
+	}
+	tests := files[0].tests
+	for _, f := range files[1:] {
+		included, ok := f.tests.(*v2.StructureTest)
+		if !ok {
+			return nil, fmt.Errorf("included config %s must use schema version 2.0.0", f.path)
+		}
+		if err := tests.(*v2.StructureTest).Merge(included, f.source); err != nil {
+			return nil, errors.Wrapf(err, "merging %s", f.path)
+		}
+	}
+	return tests, nil
+}
+
+// parseContents strictly parses the contents of a config file, without resolving its includes.
+func parseContents(fp string, testContents []byte) (types.StructureTest, error) {
 	// We first have to unmarshal to determine the schema version, then we unmarshal again
 	// to do the full parse.
 	var unmarshal types.Unmarshaller
@@ -96,18 +121,16 @@ func Parse(fp string, args *drivers.DriverConfig, driverImpl func(drivers.Driver
 		return nil, errors.New("Unsupported schema version: " + version)
 	}
 
-	if err = strictUnmarshal(testContents, st); err != nil {
+	if err := strictUnmarshal(testContents, st); err != nil {
 		return nil, errors.New("error unmarshalling config: " + err.Error())
 	}
-
-	tests, _ := st.(types.StructureTest) //type assertion
-	tests.SetDriverImpl(driverImpl, *args)
-	return tests, nil
+	return st, nil
 }
 
-func ProcessResults(out io.Writer, format unversioned.OutputValue, junitSuiteName string, c chan interface{}) error {
+func ProcessResults(ctx context.Context, out io.Writer, format unversioned.OutputValue, junitSuiteName string, c chan interface{}) error {
 	totalPass := 0
 	totalFail := 0
+	totalSkipped := 0
 	totalDuration := time.Duration(0)
 	errStrings := make([]string, 0)
 	results, err := channelToSlice(c)
@@ -119,25 +142,36 @@ func ProcessResults(out io.Writer, format unversioned.OutputValue, junitSuiteNam
 			// output individual results if we're not in json mode
 			output.OutputResult(out, r)
 		}
-		if r.IsPass() {
+		if r.Skipped {
+			totalSkipped++
+		} else if r.IsPass() {
 			totalPass++
 		} else {
 			totalFail++
 		}
 		totalDuration += r.Duration
 	}
-	if totalPass+totalFail == 0 || totalFail > 0 {
+	// the context is cancelled when the run is interrupted, so only part of the
+	// tests have results
+	interrupted := ctx.Err() != nil
+	if (totalPass+totalFail+totalSkipped == 0 && !interrupted) || totalFail > 0 {
 		errStrings = append(errStrings, "FAIL")
 	}
+	if interrupted {
+		errStrings = append(errStrings, "INTERRUPTED")
+	}
 	if len(errStrings) > 0 {
 		err = fmt.Errorf(strings.Join(errStrings, "\n"))
 	}
 
 	summary := unversioned.SummaryObject{
-		Total:    totalFail + totalPass,
+		Total:    totalFail + totalPass + totalSkipped,
 		Pass:     totalPass,
 		Fail:     totalFail,
+		Skipped:  totalSkipped,
 		Duration: totalDuration,
+
+		Interrupted: interrupted,
 	}
 	if format == unversioned.Json || format == unversioned.Junit {
 		// only output results here if we're in json mode
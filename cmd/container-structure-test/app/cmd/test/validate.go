@@ -0,0 +1,172 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
+)
+
+// yaml errors refer to their location as "line N: <message>"
+var lineErrorRegex = regexp.MustCompile(`line (\d+): (.*)`)
+
+// Problem is an error in a config file, along with its location in the file.
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// ValidateFile strictly parses a config file, along with every file it includes,
+// and runs the validation of every test in them without creating any drivers.
+// Each problem found is located in the file it comes from.
+func ValidateFile(fp string, vars map[string]string) ([]Problem, error) {
+	files, err := loadConfigFiles(fp, vars)
+	if err != nil {
+		var cerr *configError
+		if !errors.As(err, &cerr) {
+			return nil, err
+		}
+		// the yaml.v3 node tree is only used for locating problems; JSON configs
+		// parse into it as well, since JSON is a subset of YAML.
+		var root yaml.Node
+		_ = yaml.Unmarshal(cerr.contents, &root)
+		return parseErrorProblems(cerr.path, &root, cerr.err), nil
+	}
+
+	var problems []Problem
+	nodes := make([]*yaml.Node, len(files))
+	for i, f := range files {
+		var root yaml.Node
+		if err := yaml.Unmarshal(f.contents, &root); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", f.path)
+		}
+		nodes[i] = &root
+		for _, verr := range f.tests.Validate() {
+			problems = append(problems, locateProblem(f.path, &root, verr))
+		}
+	}
+	// conflicts between the files are located in the included file
+	merged, ok := files[0].tests.(*v2.StructureTest)
+	if !ok {
+		return problems, nil
+	}
+	for i, f := range files[1:] {
+		included, ok := f.tests.(*v2.StructureTest)
+		if !ok {
+			continue
+		}
+		var verr types.ValidationError
+		if err := merged.Merge(included, f.source); errors.As(err, &verr) {
+			problems = append(problems, locateProblem(f.path, nodes[i+1], verr))
+		}
+	}
+	return problems, nil
+}
+
+// locateProblem returns the problem of a validation error in a config file.
+func locateProblem(fp string, root *yaml.Node, verr types.ValidationError) Problem {
+	line, column := locateTest(root, verr.Section, verr.Index)
+	return Problem{
+		File:    fp,
+		Line:    line,
+		Column:  column,
+		Message: verr.Error(),
+	}
+}
+
+// parseErrorProblems converts a parse error into problems, one for every line
+// the error refers to.
+func parseErrorProblems(fp string, root *yaml.Node, err error) []Problem {
+	var problems []Problem
+	for _, msg := range strings.Split(err.Error(), "\n") {
+		match := lineErrorRegex.FindStringSubmatch(msg)
+		if match == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		problems = append(problems, Problem{
+			File:    fp,
+			Line:    line,
+			Column:  locateColumn(root, line),
+			Message: match[2],
+		})
+	}
+	if len(problems) == 0 {
+		problems = append(problems, Problem{
+			File:    fp,
+			Line:    1,
+			Column:  1,
+			Message: err.Error(),
+		})
+	}
+	return problems
+}
+
+// locateTest returns the position of a test in the config, falling back to the
+// position of its section, or the start of the file.
+func locateTest(root *yaml.Node, section string, index int) (int, int) {
+	doc := root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return 1, 1
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		if key.Value != section {
+			continue
+		}
+		if index >= 0 && value.Kind == yaml.SequenceNode && index < len(value.Content) {
+			return value.Content[index].Line, value.Content[index].Column
+		}
+		return key.Line, key.Column
+	}
+	return 1, 1
+}
+
+// locateColumn returns the column of the first node on the given line.
+func locateColumn(root *yaml.Node, line int) int {
+	if column := findColumn(root, line); column > 0 {
+		return column
+	}
+	return 1
+}
+
+func findColumn(node *yaml.Node, line int) int {
+	if node.Line == line && node.Kind != yaml.DocumentNode {
+		return node.Column
+	}
+	for _, child := range node.Content {
+		if column := findColumn(child, line); column > 0 {
+			return column
+		}
+	}
+	return 0
+}
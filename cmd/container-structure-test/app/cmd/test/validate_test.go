@@ -0,0 +1,131 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestValidateFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		included string // base.yaml, next to the config
+		expected []string
+	}{
+		{
+			name: "valid",
+			config: `schemaVersion: 2.0.0
+commandTests:
+  - name: echo
+    command: echo
+`,
+		},
+		{
+			name: "unknown field",
+			config: `schemaVersion: 2.0.0
+commandTests:
+  - name: echo
+    comand: echo
+`,
+			expected: []string{"config.yaml:4:5: field comand not found in type v2.CommandTest"},
+		},
+		{
+			name: "invalid tests",
+			config: `schemaVersion: 2.0.0
+commandTests:
+  - name: echo
+    command: echo
+  - name: missing command
+fileExistenceTests:
+  - path: /etc
+`,
+			expected: []string{
+				"config.yaml:5:5: commandTests[1]: Please provide a valid command to run for test missing command",
+				"config.yaml:7:5: fileExistenceTests[0]: Please provide a valid name for every test",
+			},
+		},
+		{
+			name: "invalid values",
+			config: `schemaVersion: 2.0.0
+commandTests:
+  - name: echo
+    command: echo
+    expectedOutput: ["(unclosed"]
+  - name: echo
+    command: echo
+fileExistenceTests:
+  - name: etc
+    path: /etc
+    permissions: rwx
+    isExecutableBy: nobody
+`,
+			expected: []string{
+				"config.yaml:3:5: commandTests[0]: Invalid regex '(unclosed' in expectedOutput: error parsing regexp: missing closing ): `(unclosed`",
+				"config.yaml:9:5: fileExistenceTests[0]: Invalid permissions string rwx for test etc, expected e.g. -rwxr-xr-x",
+				"config.yaml:9:5: fileExistenceTests[0]: nobody not recognised as a valid option for isExecutableBy, please use one of owner, group, other or any",
+				"config.yaml:6:5: commandTests[1]: Duplicate test name echo",
+			},
+		},
+		{
+			name: "conflicting include",
+			config: `schemaVersion: 2.0.0
+include: [base.yaml]
+metadataTest:
+  workdir: /app
+`,
+			included: `schemaVersion: 2.0.0
+commandTests:
+  - name: echo
+    command: echo
+metadataTest:
+  workdir: /
+`,
+			expected: []string{"base.yaml:5:1: metadataTest: the metadataTest of base.yaml conflicts with the one of the including config"},
+		},
+		{
+			name:     "missing schema version",
+			config:   "commandTests: []\n",
+			expected: []string{"config.yaml:1:1: Please provide schema version"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fp := filepath.Join(t.TempDir(), "config.yaml")
+			if test.included != "" {
+				if err := os.WriteFile(filepath.Join(filepath.Dir(fp), "base.yaml"), []byte(test.included), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(fp, []byte(test.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			problems, err := ValidateFile(fp, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, p := range problems {
+				p.File = filepath.Base(p.File)
+				actual = append(actual, p.String())
+			}
+			testutil.CheckDeepEqual(t, test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleContainerTools/container-structure-test/cmd/container-structure-test/app/cmd/test"
+)
+
+var (
+	validateConfigFiles []string
+	validateVars        map[string]string
+)
+
+func NewCmdValidate(out io.Writer) *cobra.Command {
+	var validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validates test config files without running them",
+		Long: `Strictly parses the test config files and validates every test in them,
+without requiring an image. Each problem is reported with its file:line:column location.`,
+		Args: func(cmd *cobra.Command, _ []string) error {
+			if len(validateConfigFiles) == 0 {
+				return fmt.Errorf("Please provide at least one test config file")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runValidate(out)
+		},
+	}
+
+	validateCmd.Flags().StringArrayVarP(&validateConfigFiles, "config", "c", []string{}, "test config files")
+	validateCmd.MarkFlagRequired("config")
+	validateCmd.Flags().StringToStringVar(&validateVars, "set", nil, "set a template variable of the test configs (key=value)")
+	return validateCmd
+}
+
+func runValidate(out io.Writer) error {
+	return validateConfigs(validateConfigFiles, validateVars, func(p test.Problem) {
+		fmt.Fprintln(out, p.String())
+	})
+}
+
+// validateConfigs validates every config file, passing each problem found to report.
+// An error is returned if any problem was found, so that no driver gets created
+// for an invalid config.
+func validateConfigs(files []string, vars map[string]string, report func(test.Problem)) error {
+	total := 0
+	for _, file := range files {
+		problems, err := test.ValidateFile(file, vars)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			report(p)
+		}
+		total += len(problems)
+	}
+	if total > 0 {
+		return fmt.Errorf("config validation failed: %d problem(s) found", total)
+	}
+	return nil
+}
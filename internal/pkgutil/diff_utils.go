@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DirDiff stores the paths added, removed and modified between two directories.
+// All paths are relative to the root of their directory, e.g. "/etc/passwd".
+type DirDiff struct {
+	Adds []string
+	Dels []string
+	Mods []string
+}
+
+// DiffDirectory compares the contents of two directories retrieved through GetDirectory,
+// treating d1 as the baseline and d2 as the updated directory.
+func DiffDirectory(d1, d2 Directory) (DirDiff, error) {
+	d1Content := make(map[string]bool, len(d1.Content))
+	for _, name := range d1.Content {
+		d1Content[name] = true
+	}
+	d2Content := make(map[string]bool, len(d2.Content))
+	for _, name := range d2.Content {
+		d2Content[name] = true
+	}
+
+	diff := DirDiff{}
+	for _, name := range d2.Content {
+		if !d1Content[name] {
+			diff.Adds = append(diff.Adds, name)
+		}
+	}
+	for _, name := range d1.Content {
+		if !d2Content[name] {
+			diff.Dels = append(diff.Dels, name)
+			continue
+		}
+		same, err := checkSameEntry(filepath.Join(d1.Root, name), filepath.Join(d2.Root, name))
+		if err != nil {
+			return DirDiff{}, err
+		}
+		if !same {
+			diff.Mods = append(diff.Mods, name)
+		}
+	}
+	sort.Strings(diff.Adds)
+	sort.Strings(diff.Dels)
+	sort.Strings(diff.Mods)
+	return diff, nil
+}
+
+// checkSameEntry reports whether two filesystem entries are of the same type and,
+// for files and symlinks, have the same contents or link target.
+func checkSameEntry(f1name, f2name string) (bool, error) {
+	f1stat, err := os.Lstat(f1name)
+	if err != nil {
+		return false, err
+	}
+	f2stat, err := os.Lstat(f2name)
+	if err != nil {
+		return false, err
+	}
+	if f1stat.Mode().Type() != f2stat.Mode().Type() {
+		return false, nil
+	}
+	switch {
+	case f1stat.Mode()&os.ModeSymlink != 0:
+		return CheckSameSymlink(f1name, f2name)
+	case f1stat.Mode().IsRegular():
+		if f1stat.Mode().Perm() != f2stat.Mode().Perm() {
+			return false, nil
+		}
+		return CheckSameFile(f1name, f2name)
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		target := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiffDirectory(t *testing.T) {
+	baseline := t.TempDir()
+	updated := t.TempDir()
+	writeFiles(t, baseline, map[string]string{
+		"etc/hosts":  "localhost",
+		"etc/passwd": "root",
+		"app/main":   "v1",
+	})
+	writeFiles(t, updated, map[string]string{
+		"etc/hosts":   "localhost",
+		"app/main":    "v2",
+		"app/VERSION": "2",
+	})
+	if err := os.Symlink("/app/main", filepath.Join(baseline, "usr-main")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/app/other", filepath.Join(updated, "usr-main")); err != nil {
+		t.Fatal(err)
+	}
+
+	d1, err := GetDirectory(baseline, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := GetDirectory(updated, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := DiffDirectory(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, DirDiff{
+		Adds: []string{"/app/VERSION"},
+		Dels: []string{"/etc/passwd"},
+		Mods: []string{"/app/main", "/usr-main"},
+	}, diff)
+}
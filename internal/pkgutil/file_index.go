@@ -0,0 +1,213 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+)
+
+// maxSymlinks is the number of symlinks followed when resolving a path, as on Linux.
+const maxSymlinks = 40
+
+// FileIndex holds the tar headers of the files of an image, with whiteouts resolved.
+// Unpacking an image as an unprivileged user loses the ownership and extended
+// attributes of its files, and skips device nodes and FIFOs altogether, so the
+// index is what their metadata is read from.
+type FileIndex struct {
+	headers map[string]*tar.Header // by absolute, cleaned path
+	implied map[string]bool        // directories of the files in the index, which may have no header
+}
+
+func NewFileIndex() *FileIndex {
+	return &FileIndex{headers: map[string]*tar.Header{}, implied: map[string]bool{}}
+}
+
+// BuildFileIndex reads the tar headers of the flattened filesystem of an image,
+// without unpacking it.
+func BuildFileIndex(image v1.Image) (*FileIndex, error) {
+	contents := Flatten(image)
+	defer contents.Close()
+	index := NewFileIndex()
+	tr := tar.NewReader(contents)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting next tar header")
+		}
+		index.add(header)
+	}
+}
+
+// ReadFileIndex reads an index written by Write.
+func ReadFileIndex(file string) (*FileIndex, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	index := NewFileIndex()
+	if err := json.Unmarshal(contents, &index.headers); err != nil {
+		return nil, errors.Wrapf(err, "parsing file index %s", file)
+	}
+	for key := range index.headers {
+		index.imply(key)
+	}
+	return index, nil
+}
+
+// Write writes the index to a file, to be read back with ReadFileIndex.
+func (i *FileIndex) Write(file string) error {
+	contents, err := json.Marshal(i.headers)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, contents, 0600)
+}
+
+// add records a header. Headers of a flattened filesystem come from the topmost
+// layer first, so a path already in the index is not overwritten.
+func (i *FileIndex) add(header *tar.Header) {
+	key := path.Clean("/" + header.Name)
+	if _, ok := i.headers[key]; ok {
+		return
+	}
+	i.headers[key] = header
+	i.imply(key)
+}
+
+// imply records the parent directories of a path. Layers need not have headers for
+// them, and these directories are then created owned by root with mode 0755, as
+// when a container runtime extracts the layer.
+func (i *FileIndex) imply(key string) {
+	for dir := path.Dir(key); dir != "/" && !i.implied[dir]; dir = path.Dir(dir) {
+		i.implied[dir] = true
+	}
+}
+
+// header returns the header of a path, synthesized for an implied directory.
+func (i *FileIndex) header(key string) (*tar.Header, bool) {
+	if header, ok := i.headers[key]; ok {
+		return header, true
+	}
+	if i.implied[key] {
+		return &tar.Header{Name: strings.TrimPrefix(key, "/") + "/", Typeflag: tar.TypeDir, Mode: 0755}, true
+	}
+	return nil, false
+}
+
+// Stat returns the metadata of a file as recorded in its tar header, without
+// following the file if it is a symlink. The FileInfo returned has the header as
+// its Sys(), even for directories which only exist because of the files in them.
+// Symlinks in the parent directories of the path are followed, and hard links
+// report the metadata of the file they link to.
+func (i *FileIndex) Stat(file string) (os.FileInfo, bool) {
+	header, ok := i.header(i.resolve(file))
+	if !ok {
+		return nil, false
+	}
+	if header.Typeflag == tar.TypeLink {
+		if target, ok := i.headers[path.Clean("/"+header.Linkname)]; ok {
+			link := *target
+			link.Name = header.Name
+			return link.FileInfo(), true
+		}
+	}
+	return header.FileInfo(), true
+}
+
+// ReadDir returns the metadata of the files in a directory, sorted by name.
+func (i *FileIndex) ReadDir(dir string) []os.FileInfo {
+	// resolving a path inside the directory also follows the directory itself,
+	// if it is a symlink
+	dir = path.Dir(i.resolve(path.Join(dir, "_")))
+	var names []string
+	for key := range i.headers {
+		if key != "/" && path.Dir(key) == dir {
+			names = append(names, key)
+		}
+	}
+	for key := range i.implied {
+		if _, ok := i.headers[key]; !ok && path.Dir(key) == dir {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	infos := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		info, _ := i.Stat(name)
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Resolve follows the symlinks in a path, including the file itself, and returns
+// the path it points to in the image. Absolute symlinks are resolved against the
+// root of the image rather than the host.
+func (i *FileIndex) Resolve(file string) string {
+	file = i.resolve(file)
+	for hops := 0; hops < maxSymlinks; hops++ {
+		header, ok := i.headers[file]
+		if !ok || header.Typeflag != tar.TypeSymlink {
+			return file
+		}
+		target := header.Linkname
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(file), target)
+		}
+		file = i.resolve(target)
+	}
+	return file
+}
+
+// resolve follows the symlinks in the parent directories of a path.
+func (i *FileIndex) resolve(file string) string {
+	file = path.Clean("/" + file)
+	for hops := 0; hops < maxSymlinks; hops++ {
+		parts := strings.Split(strings.TrimPrefix(file, "/"), "/")
+		dir := "/"
+		followed := false
+		for n, part := range parts[:len(parts)-1] {
+			current := path.Join(dir, part)
+			header, ok := i.headers[current]
+			if ok && header.Typeflag == tar.TypeSymlink {
+				target := header.Linkname
+				if !path.IsAbs(target) {
+					target = path.Join(dir, target)
+				}
+				file = path.Join(append([]string{"/", target}, parts[n+1:]...)...)
+				followed = true
+				break
+			}
+			dir = current
+		}
+		if !followed {
+			return file
+		}
+	}
+	return file
+}
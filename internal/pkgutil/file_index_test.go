@@ -0,0 +1,166 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// layer builds a layer from tar headers, giving regular files the contents "data".
+func layer(t *testing.T, headers ...*tar.Header) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = 4
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte("data"))
+		}
+	}
+	tw.Close()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestFileIndex(t *testing.T) {
+	base := layer(t,
+		&tar.Header{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "usr/bin/app", Typeflag: tar.TypeReg, Mode: 04750, Uid: 1000, Gid: 50, Uname: "app", Gname: "staff",
+			PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "cap"}},
+		&tar.Header{Name: "usr/bin/app-link", Typeflag: tar.TypeLink, Linkname: "usr/bin/app"},
+		&tar.Header{Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "usr/bin", Mode: 0777},
+		&tar.Header{Name: "dev/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3},
+		&tar.Header{Name: "dev/fifo", Typeflag: tar.TypeFifo, Mode: 0600},
+		&tar.Header{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "tmp/removed", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "opt/old", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "app", Typeflag: tar.TypeSymlink, Linkname: "/bin/app", Mode: 0777},
+		// the parent directories of the file have no headers
+		&tar.Header{Name: "var/lib/app/data", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+	top := layer(t,
+		&tar.Header{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 01777},
+		&tar.Header{Name: "tmp/.wh.removed", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "opt/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "opt/new", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+	img, err := mutate.AppendLayers(empty.Image, base, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	unpacked, err := GetFileSystemForImage(img, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err := BuildFileIndex(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := filepath.Join(t.TempDir(), "index.json")
+	if err := unpacked.Write(written); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadFileIndex(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, index := range map[string]*FileIndex{"unpacked": unpacked, "built": built, "read": read} {
+		t.Run(name, func(t *testing.T) {
+			mode := func(path string) string {
+				info, ok := index.Stat(path)
+				if !ok {
+					return "missing"
+				}
+				return info.Mode().String()
+			}
+			testutil.CheckDeepEqual(t, "urwxr-x---", mode("/usr/bin/app"))
+			testutil.CheckDeepEqual(t, "urwxr-x---", mode("/bin/app-link"))
+			testutil.CheckDeepEqual(t, "Lrwxrwxrwx", mode("/bin"))
+			testutil.CheckDeepEqual(t, "Dcrw-rw-rw-", mode("/dev/null"))
+			testutil.CheckDeepEqual(t, "prw-------", mode("/dev/fifo"))
+			testutil.CheckDeepEqual(t, "dtrwxrwxrwx", mode("/tmp"))
+			testutil.CheckDeepEqual(t, "missing", mode("/tmp/removed"))
+			// the opaque directory hides the files of the lower layer
+			testutil.CheckDeepEqual(t, "missing", mode("/opt/old"))
+			testutil.CheckDeepEqual(t, "-rw-r--r--", mode("/opt/new"))
+			testutil.CheckDeepEqual(t, "/usr/bin/app", index.Resolve("/app"))
+			testutil.CheckDeepEqual(t, "/usr/bin/app-link", index.Resolve("/bin/app-link"))
+
+			info, _ := index.Stat("bin/app")
+			header := info.Sys().(*tar.Header)
+			testutil.CheckDeepEqual(t, []interface{}{1000, 50, "app", "staff", "cap"},
+				[]interface{}{header.Uid, header.Gid, header.Uname, header.Gname, header.PAXRecords["SCHILY.xattr.security.capability"]})
+
+			var names []string
+			for _, info := range index.ReadDir("/bin") {
+				names = append(names, info.Name())
+			}
+			testutil.CheckDeepEqual(t, []string{"app", "app-link"}, names)
+
+			// implied directories are reported as a container runtime creates them
+			testutil.CheckDeepEqual(t, "drwxr-xr-x", mode("/var/lib"))
+			info, _ = index.Stat("/var/lib/app")
+			header, ok := info.Sys().(*tar.Header)
+			if !ok {
+				t.Fatalf("expected a tar header for an implied directory, got %T", info.Sys())
+			}
+			testutil.CheckDeepEqual(t, []interface{}{"app", 0, 0}, []interface{}{info.Name(), header.Uid, header.Gid})
+			names = nil
+			for _, info := range index.ReadDir("/var") {
+				names = append(names, info.Name())
+			}
+			testutil.CheckDeepEqual(t, []string{"lib"}, names)
+		})
+	}
+
+	// special files are only in the index
+	if _, err := os.Lstat(filepath.Join(root, "dev", "null")); !os.IsNotExist(err) {
+		t.Errorf("expected /dev/null not to be unpacked, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "opt", "old")); !os.IsNotExist(err) {
+		t.Errorf("expected /opt/old not to be unpacked, got %v", err)
+	}
+}
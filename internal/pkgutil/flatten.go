@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// Flatten returns the filesystem of an image as a single tar stream, with the files
+// of upper layers replacing those of lower ones. It is mutate.Extract, which also
+// applies opaque whiteouts: a directory holding one hides everything lower layers
+// put in it, as in a running container.
+func Flatten(image v1.Image) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(flatten(image, pw))
+	}()
+	return pr
+}
+
+func flatten(image v1.Image, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	layers, err := image.Layers()
+	if err != nil {
+		return errors.Wrap(err, "retrieving image layers")
+	}
+	// layers are read from the top, so that the files which are replaced or removed
+	// are known by the time lower layers are read. removed holds the paths seen so
+	// far, and whether they hide the paths below them.
+	removed := map[string]bool{}
+	opaque := map[string]bool{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		if err := flattenLayer(layers[i], tw, removed, opaque); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenLayer writes the files of a layer which are not replaced or removed by
+// upper layers. Opaque directories of the layer only apply to lower layers.
+func flattenLayer(layer v1.Layer, tw *tar.Writer, removed map[string]bool, opaque map[string]bool) error {
+	contents, err := layer.Uncompressed()
+	if err != nil {
+		return errors.Wrap(err, "reading layer contents")
+	}
+	defer contents.Close()
+	var layerOpaque []string
+	tr := tar.NewReader(contents)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar")
+		}
+		header.Name = path.Clean(header.Name)
+		// PAX lifts the limit of 100 bytes on names
+		header.Format = tar.FormatPAX
+		dir, base := path.Split(header.Name)
+		dir = path.Clean(dir)
+		if base == opaqueWhiteout {
+			layerOpaque = append(layerOpaque, dir)
+			continue
+		}
+		name := header.Name
+		whiteout := strings.HasPrefix(base, whiteoutPrefix)
+		if whiteout {
+			name = path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+		}
+		if _, ok := removed[name]; ok || hidden(name, removed, opaque) {
+			continue
+		}
+		// anything but a directory replaces what lower layers put below it
+		removed[name] = whiteout || header.Typeflag != tar.TypeDir
+		if whiteout {
+			continue
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Size > 0 {
+			if _, err := io.CopyN(tw, tr, header.Size); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dir := range layerOpaque {
+		opaque[dir] = true
+	}
+	return nil
+}
+
+// hidden reports whether a parent directory of the path was removed or made opaque
+// by an upper layer.
+func hidden(name string, removed map[string]bool, opaque map[string]bool) bool {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if removed[dir] || opaque[dir] {
+			return true
+		}
+	}
+	return false
+}
@@ -174,23 +174,15 @@ func CheckSameFile(f1name, f2name string) (bool, error) {
 	return true, nil
 }
 
-// HasFilepathPrefix checks if the given file path begins with prefix
+// HasFilepathPrefix checks if the given file path begins with prefix, as a whole
+// path element: /usr is a prefix of /usr/lib, but not of /usrlocal.
 func HasFilepathPrefix(path, prefix string) bool {
 	path = filepath.Clean(path)
 	prefix = filepath.Clean(prefix)
-	pathArray := strings.Split(path, "/")
-	prefixArray := strings.Split(prefix, "/")
-
-	if len(pathArray) < len(prefixArray) {
-		return false
-	}
-	for index := range prefixArray {
-		if prefixArray[index] == pathArray[index] {
-			continue
-		}
-		return false
+	if prefix == "/" {
+		return strings.HasPrefix(path, "/")
 	}
-	return true
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
 }
 
 // given a path to a directory, check if it has any contents
@@ -0,0 +1,277 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	rootfsDir = "rootfs"
+	sizeFile  = "size"
+	indexFile = "index.json"
+	lockName  = ".lock"
+	tmpPrefix = ".tmp-"
+)
+
+// ImageCache shares the unpacked filesystems of images between all tests of a run.
+// Filesystems are keyed by image digest, so an image is only unpacked once however
+// many names it is referred to by. Images handed out by the cache must be treated
+// as read-only, and must not be removed with CleanupImage.
+type ImageCache struct {
+	dir      string   // each entry is a directory named after the digest of its image
+	maxSize  int64    // size in bytes the cache is evicted down to when closed, 0 for no limit
+	keep     bool     // whether the cache dir is kept once the run is over
+	lock     *os.File // shared lock on a dir kept between runs, held for the whole run
+	mu       sync.Mutex
+	resolved map[string]Image // images by the name they were requested with
+}
+
+// NewImageCache creates a cache in dir, which is kept between runs and evicted down to
+// maxSize bytes in least recently used order when closed. If dir is empty, the cache
+// lives in a temp dir for the run only. Runs sharing dir hold a lock on it, so that
+// entries are only evicted once no other run may still be reading them.
+func NewImageCache(dir string, maxSize int64) (*ImageCache, error) {
+	c := &ImageCache{
+		dir:      dir,
+		maxSize:  maxSize,
+		keep:     dir != "",
+		resolved: map[string]Image{},
+	}
+	if dir == "" {
+		var err error
+		if c.dir, err = os.MkdirTemp("", "structure-test-cache"); err != nil {
+			return nil, errors.Wrap(err, "creating image cache dir")
+		}
+		return c, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "creating image cache dir")
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "locking image cache dir")
+	}
+	if _, err := lockFile(lock, false, true); err != nil {
+		lock.Close()
+		return nil, errors.Wrap(err, "locking image cache dir")
+	}
+	c.lock = lock
+	return c, nil
+}
+
+// Get retrieves an image the way ResolveImage does, unpacking its filesystem into
+// the cache unless it is already there.
+func (c *ImageCache) Get(imageName string) (Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if image, ok := c.resolved[imageName]; ok {
+		c.touch(image.Digest.Hex)
+		return image, nil
+	}
+	img, source, err := resolveImage(imageName)
+	if err != nil {
+		return Image{}, err
+	}
+	digest, err := getImageDigest(img)
+	if err != nil {
+		return Image{}, err
+	}
+	entry := filepath.Join(c.dir, digest.Hex)
+	var files *FileIndex
+	if _, err := os.Stat(entry); err == nil {
+		logrus.Infof("using cached filesystem of %s at %s", source, entry)
+		c.touch(digest.Hex)
+		if files, err = c.index(img, entry); err != nil {
+			return Image{}, err
+		}
+	} else {
+		// the image is unpacked next to its entry and moved into place once complete,
+		// so that other runs sharing the cache never see a partial filesystem.
+		tmp, err := os.MkdirTemp(c.dir, tmpPrefix)
+		if err != nil {
+			return Image{}, errors.Wrap(err, "creating image cache entry")
+		}
+		defer os.RemoveAll(tmp)
+		if err := os.Mkdir(filepath.Join(tmp, rootfsDir), 0755); err != nil {
+			return Image{}, errors.Wrap(err, "creating image cache entry")
+		}
+		if files, err = GetFileSystemForImage(img, filepath.Join(tmp, rootfsDir), nil); err != nil {
+			return Image{}, errors.Wrap(err, "getting filesystem for image")
+		}
+		if err := files.Write(filepath.Join(tmp, indexFile)); err != nil {
+			return Image{}, errors.Wrap(err, "writing image cache entry")
+		}
+		size := GetSize(filepath.Join(tmp, rootfsDir))
+		if err := os.WriteFile(filepath.Join(tmp, sizeFile), []byte(strconv.FormatInt(size, 10)), 0600); err != nil {
+			return Image{}, errors.Wrap(err, "writing image cache entry")
+		}
+		if err := os.Rename(tmp, entry); err != nil {
+			// another run may have unpacked the same image in the meantime
+			if _, statErr := os.Stat(entry); statErr != nil {
+				return Image{}, errors.Wrap(err, "writing image cache entry")
+			}
+		}
+	}
+	image := Image{
+		Image:  img,
+		Source: source,
+		FSPath: filepath.Join(entry, rootfsDir),
+		Digest: digest,
+		Files:  files,
+	}
+	c.resolved[imageName] = image
+	return image, nil
+}
+
+// index reads the file index of an entry, rebuilding it from the image for entries
+// unpacked without one.
+func (c *ImageCache) index(img v1.Image, entry string) (*FileIndex, error) {
+	files, err := ReadFileIndex(filepath.Join(entry, indexFile))
+	if err == nil {
+		return files, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if files, err = BuildFileIndex(img); err != nil {
+		return nil, errors.Wrap(err, "indexing image files")
+	}
+	if err := files.Write(filepath.Join(entry, indexFile)); err != nil {
+		logrus.Warnf("error writing image cache entry: %s", err)
+	}
+	return files, nil
+}
+
+// touch marks an entry as used, for the least recently used eviction.
+func (c *ImageCache) touch(hex string) {
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(c.dir, hex), now, now); err != nil {
+		logrus.Warnf("error updating image cache entry: %s", err)
+	}
+}
+
+// Close removes the cache if it only lives for the run, and otherwise evicts the
+// least recently used entries until it fits in its size limit. Eviction is left to
+// the last run to finish when other runs are still using the cache dir.
+func (c *ImageCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.keep {
+		if err := os.RemoveAll(c.dir); err != nil {
+			logrus.Warnf("error removing image cache: %s", err)
+		}
+		return
+	}
+	if c.lock != nil {
+		defer c.lock.Close()
+		// upgrading the shared lock in place could deadlock with another run doing
+		// the same, so it is released before trying for an exclusive one.
+		if err := unlockFile(c.lock); err != nil {
+			logrus.Warnf("error unlocking image cache: %s", err)
+			return
+		}
+		locked, err := lockFile(c.lock, true, false)
+		if err != nil {
+			logrus.Warnf("error locking image cache: %s", err)
+			return
+		}
+		if !locked {
+			logrus.Debugf("image cache %s is in use by another run, not evicting it", c.dir)
+			return
+		}
+		defer unlockFile(c.lock)
+	}
+	if err := c.evict(); err != nil {
+		logrus.Warnf("error evicting image cache: %s", err)
+	}
+}
+
+// Keep keeps the cache dir once the run is over, even if it only lived for the run.
+func (c *ImageCache) Keep() {
+	c.keep = true
+}
+
+type cacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+func (c *ImageCache) evict() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var entries []cacheEntry
+	var total int64
+	for _, f := range files {
+		if !f.IsDir() || strings.HasPrefix(f.Name(), tmpPrefix) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(c.dir, f.Name())
+		size, err := entrySize(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, cacheEntry{path: path, size: size, lastUsed: info.ModTime()})
+		total += size
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		logrus.Infof("evicting %s from image cache", e.path)
+		if err := os.RemoveAll(e.path); err != nil {
+			return err
+		}
+		total -= e.size
+	}
+	return nil
+}
+
+// entrySize returns the size of an entry as recorded when it was unpacked.
+func entrySize(path string) (int64, error) {
+	contents, err := os.ReadFile(filepath.Join(path, sizeFile))
+	if os.IsNotExist(err) {
+		return GetSize(path), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+}
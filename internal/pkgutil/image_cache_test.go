@@ -0,0 +1,159 @@
+/*
+Copyright 2018 Google, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkgutil
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestImageCacheGet(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := tarball.WriteToFile(path, name.MustParseReference("test/image:latest"), img); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	cache, err := NewImageCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := cache.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cache.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, first.FSPath, second.FSPath)
+	digest, _ := img.Digest()
+	testutil.CheckDeepEqual(t, filepath.Join(dir, digest.Hex, "rootfs"), first.FSPath)
+	cache.Close()
+
+	// a new run reuses the unpacked filesystem
+	cache, err = NewImageCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := cache.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, first.FSPath, third.FSPath)
+	cache.Close()
+	if _, err := os.Stat(first.FSPath); err != nil {
+		t.Errorf("expected cache to be kept: %s", err)
+	}
+
+	// without a cache dir, the cache is removed after the run
+	cache, err = NewImageCache("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, err := cache.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Close()
+	if _, err := os.Stat(temp.FSPath); !os.IsNotExist(err) {
+		t.Errorf("expected temp cache to be removed, got %v", err)
+	}
+}
+
+func TestImageCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	writeCacheEntries(t, dir)
+
+	cache, err := NewImageCache(dir, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Close()
+	testutil.CheckDeepEqual(t, []string{"older", "recent"}, cacheEntries(t, dir))
+}
+
+func TestImageCacheEvictInUse(t *testing.T) {
+	dir := t.TempDir()
+	writeCacheEntries(t, dir)
+
+	first, err := NewImageCache(dir, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewImageCache(dir, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second run may still be reading any of the entries
+	first.Close()
+	testutil.CheckDeepEqual(t, []string{"older", "oldest", "recent"}, cacheEntries(t, dir))
+	second.Close()
+	testutil.CheckDeepEqual(t, []string{"older", "recent"}, cacheEntries(t, dir))
+}
+
+// writeCacheEntries fills a cache dir with three entries of 300 bytes, used an
+// hour apart.
+func writeCacheEntries(t *testing.T, dir string) {
+	now := time.Now()
+	entries := map[string]struct {
+		size string
+		age  time.Duration
+	}{
+		"oldest": {size: "300", age: 3 * time.Hour},
+		"older":  {size: "300", age: 2 * time.Hour},
+		"recent": {size: "300", age: time.Hour},
+	}
+	for hex, e := range entries {
+		writeFiles(t, dir, map[string]string{
+			filepath.Join(hex, "size"):           e.size,
+			filepath.Join(hex, "rootfs", "file"): "contents",
+		})
+		lastUsed := now.Add(-e.age)
+		if err := os.Chtimes(filepath.Join(dir, hex), lastUsed, lastUsed); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func cacheEntries(t *testing.T, dir string) []string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, f := range files {
+		if f.IsDir() {
+			entries = append(entries, f.Name())
+		}
+	}
+	sort.Strings(entries)
+	return entries
+}
@@ -32,7 +32,6 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/daemon"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 
@@ -59,6 +58,7 @@ type Image struct {
 	FSPath string
 	Digest v1.Hash
 	Layers []Layer
+	Files  *FileIndex // metadata of the files of the image, as in its layers
 }
 
 type ImageHistoryItem struct {
@@ -71,58 +71,57 @@ func GetImageForName(imageName string) (Image, error) {
 	return GetImage(imageName, false, "")
 }
 
-// GetImage infers the source of an image and retrieves a v1.Image reference to it.
-// Once a reference is obtained, it attempts to unpack the v1.Image's reader's contents
-// into a temp directory on the local filesystem.
-func GetImage(imageName string, includeLayers bool, cacheDir string) (Image, error) {
-	logrus.Infof("retrieving image: %s", imageName)
-	var img v1.Image
-	var err error
+// ResolveImage retrieves an image from a tarball path, or from an image reference by
+// trying the local docker daemon first and falling back to the remote registry.
+func ResolveImage(imageName string) (Image, error) {
+	img, imageName, err := resolveImage(imageName)
+	if err != nil {
+		return Image{}, err
+	}
+	return unpackImage(img, imageName, false, "")
+}
+
+// resolveImage retrieves a reference to an image the way ResolveImage does,
+// without unpacking it.
+func resolveImage(imageName string) (v1.Image, string, error) {
 	if IsTar(imageName) {
-		start := time.Now()
-		img, err = tarball.ImageFromPath(imageName, nil)
+		// tar provided, so don't provide any prefix. container-diff can figure this out.
+		img, name, err := retrieveImage(imageName)
 		if err != nil {
-			return Image{}, errors.Wrap(err, "retrieving tar from path")
+			return nil, "", errors.Wrap(err, "processing tar image reference")
 		}
-		elapsed := time.Now().Sub(start)
-		logrus.Infof("retrieving image ref from tar took %f seconds", elapsed.Seconds())
-	} else if strings.HasPrefix(imageName, daemonPrefix) {
-		// remove the daemon prefix
-		imageName = strings.Replace(imageName, daemonPrefix, "", -1)
+		return img, name, nil
+	}
+	// try the local docker daemon first
+	img, name, err := retrieveImage(daemonPrefix + imageName)
+	if err == nil {
+		logrus.Debugf("image found in local docker daemon")
+		return img, name, nil
+	}
 
-		ref, err := name.ParseReference(imageName, name.WeakValidation)
-		if err != nil {
-			return Image{}, errors.Wrap(err, "parsing image reference")
-		}
+	// image not found in local daemon, so try remote.
+	logrus.Infof("unable to retrieve image locally: %s", err)
+	img, name, err = retrieveImage(remotePrefix + imageName)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "retrieving image")
+	}
+	return img, name, nil
+}
 
-		start := time.Now()
-		// TODO(nkubala): specify gzip.NoCompression here when functional options are supported
-		img, err = daemon.Image(ref, daemon.WithBufferedOpener())
-		if err != nil {
-			return Image{}, errors.Wrap(err, "retrieving image from daemon")
-		}
-		elapsed := time.Now().Sub(start)
-		logrus.Infof("retrieving local image ref took %f seconds", elapsed.Seconds())
-	} else {
-		// either has remote prefix or has no prefix, in which case we force remote
-		imageName = strings.Replace(imageName, remotePrefix, "", -1)
-		ref, err := name.ParseReference(imageName, name.WeakValidation)
-		if err != nil {
-			return Image{}, errors.Wrap(err, "parsing image reference")
-		}
-		auth, err := authn.DefaultKeychain.Resolve(ref.Context().Registry)
-		if err != nil {
-			return Image{}, errors.Wrap(err, "resolving auth")
-		}
-		start := time.Now()
-		img, err = remote.Image(ref, remote.WithAuth(auth), remote.WithTransport(BuildTransport(ref.Context().Registry)))
-		if err != nil {
-			return Image{}, errors.Wrap(err, "retrieving remote image")
-		}
-		elapsed := time.Now().Sub(start)
-		logrus.Infof("retrieving remote image ref took %f seconds", elapsed.Seconds())
+// GetImage infers the source of an image and retrieves a v1.Image reference to it.
+// Once a reference is obtained, it attempts to unpack the v1.Image's reader's contents
+// into a temp directory on the local filesystem.
+func GetImage(imageName string, includeLayers bool, cacheDir string) (Image, error) {
+	img, imageName, err := retrieveImage(imageName)
+	if err != nil {
+		return Image{}, err
 	}
+	return unpackImage(img, imageName, includeLayers, cacheDir)
+}
 
+// unpackImage extracts the filesystem of an image, and optionally of each of its
+// layers, into the cache dir or a temp directory.
+func unpackImage(img v1.Image, imageName string, includeLayers bool, cacheDir string) (Image, error) {
 	// create tempdir and extract fs into it
 	var layers []Layer
 	if includeLayers {
@@ -165,7 +164,8 @@ func GetImage(imageName string, includeLayers bool, cacheDir string) (Image, err
 		return Image{}, err
 	}
 	// extract fs into provided dir
-	if err := GetFileSystemForImage(img, path, nil); err != nil {
+	files, err := GetFileSystemForImage(img, path, nil)
+	if err != nil {
 		return Image{
 			FSPath: path,
 			Layers: layers,
@@ -177,9 +177,63 @@ func GetImage(imageName string, includeLayers bool, cacheDir string) (Image, err
 		FSPath: path,
 		Digest: imageDigest,
 		Layers: layers,
+		Files:  files,
 	}, nil
 }
 
+// retrieveImage infers the source of an image and retrieves a v1.Image reference to
+// it, along with the name of the image without its source prefix.
+func retrieveImage(imageName string) (v1.Image, string, error) {
+	logrus.Infof("retrieving image: %s", imageName)
+	var img v1.Image
+	var err error
+	if IsTar(imageName) {
+		start := time.Now()
+		img, err = tarball.ImageFromPath(imageName, nil)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "retrieving tar from path")
+		}
+		elapsed := time.Now().Sub(start)
+		logrus.Infof("retrieving image ref from tar took %f seconds", elapsed.Seconds())
+	} else if strings.HasPrefix(imageName, daemonPrefix) {
+		// remove the daemon prefix
+		imageName = strings.Replace(imageName, daemonPrefix, "", -1)
+
+		ref, err := name.ParseReference(imageName, name.WeakValidation)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "parsing image reference")
+		}
+
+		start := time.Now()
+		// TODO(nkubala): specify gzip.NoCompression here when functional options are supported
+		img, err = daemon.Image(ref, daemon.WithBufferedOpener())
+		if err != nil {
+			return nil, "", errors.Wrap(err, "retrieving image from daemon")
+		}
+		elapsed := time.Now().Sub(start)
+		logrus.Infof("retrieving local image ref took %f seconds", elapsed.Seconds())
+	} else {
+		// either has remote prefix or has no prefix, in which case we force remote
+		imageName = strings.Replace(imageName, remotePrefix, "", -1)
+		ref, err := name.ParseReference(imageName, name.WeakValidation)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "parsing image reference")
+		}
+		auth, err := authn.DefaultKeychain.Resolve(ref.Context().Registry)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "resolving auth")
+		}
+		start := time.Now()
+		img, err = remote.Image(ref, remote.WithAuth(auth), remote.WithTransport(BuildTransport(ref.Context().Registry)))
+		if err != nil {
+			return nil, "", errors.Wrap(err, "retrieving remote image")
+		}
+		elapsed := time.Now().Sub(start)
+		logrus.Infof("retrieving remote image ref took %f seconds", elapsed.Seconds())
+	}
+	return img, imageName, nil
+}
+
 func getExtractPathForName(name string, cacheDir string) (string, error) {
 	path := cacheDir
 	var err error
@@ -253,24 +307,25 @@ func GetFileSystemForLayer(layer v1.Layer, root string, whitelist []string) erro
 	if err != nil {
 		return err
 	}
-	return unpackTar(tar.NewReader(contents), root, whitelist)
+	return unpackTar(tar.NewReader(contents), root, whitelist, nil)
 }
 
-// unpack image filesystem to local disk
-// if provided directory is not empty, do nothing
-func GetFileSystemForImage(image v1.Image, root string, whitelist []string) error {
+// unpack image filesystem to local disk, and return the index of its files
+// if provided directory is not empty, only index the files
+func GetFileSystemForImage(image v1.Image, root string, whitelist []string) (*FileIndex, error) {
 	empty, err := DirIsEmpty(root)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !empty {
 		logrus.Infof("using cached filesystem in %s", root)
-		return nil
+		return BuildFileIndex(image)
 	}
-	if err := unpackTar(tar.NewReader(mutate.Extract(image)), root, whitelist); err != nil {
-		return err
+	index := NewFileIndex()
+	if err := unpackTar(tar.NewReader(Flatten(image)), root, whitelist, index); err != nil {
+		return nil, err
 	}
-	return nil
+	return index, nil
 }
 
 func GetImageLayers(pathToImage string) []string {
@@ -36,7 +36,9 @@ type OriginalPerm struct {
 	perm os.FileMode
 }
 
-func unpackTar(tr *tar.Reader, path string, whitelist []string) error {
+// unpackTar extracts a tar stream into path, recording the headers of the files
+// extracted in index if it is not nil.
+func unpackTar(tr *tar.Reader, path string, whitelist []string, index *FileIndex) error {
 	// Thread safe Map of target:linkname
 	var hardlinks sync.Map
 
@@ -55,6 +57,9 @@ func unpackTar(tr *tar.Reader, path string, whitelist []string) error {
 		if checkWhitelist(target, whitelist) {
 			continue
 		}
+		if index != nil {
+			index.add(header)
+		}
 		mode := header.FileInfo().Mode()
 		switch header.Typeflag {
 
@@ -27,6 +27,11 @@ type StructureTestOptions struct {
 	Metadata            string
 	TestReport          string
 	ConfigFiles         []string
+	Vars                map[string]string
+	IncludeTags         []string
+	ExcludeTags         []string
+	Run                 string
+	BaselineImage       string
 
 	JSON           bool
 	Output         unversioned.OutputValue
@@ -36,4 +41,45 @@ type StructureTestOptions struct {
 	Quiet          bool
 	Force          bool
 	NoColor        bool
+
+	SingleContainer bool
+	CacheDir        string
+	CacheSizeLimit  int64
+	Compatibility   bool
+	DebugOnFailure  bool
+	Strict          bool
+}
+
+type SnapshotOptions struct {
+	ImagePath string
+	Driver    string
+	Runtime   string
+	Platform  string
+	Metadata  string
+	Output    string
+	Paths     []string
+	Digests   []string
+	Ignore    []string
+	Force     bool
+}
+
+type InitOptions struct {
+	ImagePath string
+	Driver    string
+	Runtime   string
+	Platform  string
+	Metadata  string
+	Output    string
+	Force     bool
+}
+
+type DebugOptions struct {
+	ImagePath  string
+	ConfigFile string
+	Test       string
+	Vars       map[string]string
+	Runtime    string
+	Platform   string
+	Shell      string
+	Print      bool
 }
@@ -0,0 +1,246 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance checks that a driver reads the files and config of an image
+// the way the other drivers do, so that tests pass or fail the same whichever
+// driver runs them.
+package conformance
+
+import (
+	"archive/tar"
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// NewDriver returns a driver reading the given image. Drivers which cannot be set
+// up in the environment of the test skip it.
+type NewDriver func(t *testing.T, img v1.Image) drivers.Driver
+
+// Run runs the suite against the driver created for the fixture image. The checks
+// which need a capability the driver does not advertise are skipped.
+func Run(t *testing.T, newDriver NewDriver) {
+	img, err := Image()
+	if err != nil {
+		t.Fatalf("building fixture image: %s", err)
+	}
+	driver := newDriver(t, img)
+	t.Cleanup(driver.Destroy)
+	capabilities := map[drivers.Capability]bool{}
+	for _, c := range driver.Capabilities() {
+		capabilities[c] = true
+	}
+
+	t.Run("StatFile", func(t *testing.T) { testStatFile(t, driver, capabilities) })
+	t.Run("ReadFile", func(t *testing.T) { testReadFile(t, driver) })
+	t.Run("ReadDir", func(t *testing.T) { testReadDir(t, driver) })
+	t.Run("GetConfig", func(t *testing.T) {
+		if !capabilities[drivers.CapMetadata] {
+			t.Skip("the driver does not support metadata")
+		}
+		testGetConfig(t, driver)
+	})
+}
+
+func testStatFile(t *testing.T, driver drivers.Driver, capabilities map[drivers.Capability]bool) {
+	ctx := context.Background()
+	tests := []struct {
+		path string
+		mode string
+		size int64 // of regular files
+	}{
+		{path: Root, mode: "drwxr-xr-x"},
+		{path: Root + "/file", mode: "-rw-r--r--", size: 6},
+		{path: Root + "/exec", mode: "-rwxr-x---", size: 10},
+		{path: Root + "/setuid", mode: "urwxr-xr-x", size: 7},
+		{path: Root + "/noperm", mode: "----------", size: 7},
+		{path: Root + "/sticky", mode: "dtrwxrwxrwx"},
+		{path: Root + "/dir", mode: "drwx------"},
+		// symlinks are not followed
+		{path: Root + "/rel-link", mode: "Lrwxrwxrwx"},
+		{path: Root + "/abs-link", mode: "Lrwxrwxrwx"},
+		{path: Root + "/dir-link", mode: "Lrwxrwxrwx"},
+		{path: Root + "/loop-a", mode: "Lrwxrwxrwx"},
+		// unless they are parent directories
+		{path: Root + "/dir-link/nested", mode: "-rw-r--r--", size: 7},
+		{path: Root + "/hardlink", mode: "-rw-r--r--", size: 6},
+		{path: Root + "/fifo", mode: "prw-------"},
+		{path: Root + "/replaced", mode: "-rw-------", size: 4},
+		{path: Root + "/opaque/new", mode: "-rw-r--r--", size: 4},
+		{path: deepDir, mode: "drwxr-xr-x"},
+		{path: deepFile, mode: "-rw-r--r--", size: 5},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			info, err := driver.StatFile(ctx, test.path)
+			if err != nil {
+				t.Fatalf("stat %s: %s", test.path, err)
+			}
+			testutil.CheckDeepEqual(t, path.Base(test.path), info.Name())
+			testutil.CheckDeepEqual(t, test.mode, info.Mode().String())
+			if info.Mode().IsRegular() {
+				testutil.CheckDeepEqual(t, test.size, info.Size())
+			}
+		})
+	}
+
+	for _, missing := range []string{Root + "/removed", Root + "/opaque/old", Root + "/missing"} {
+		t.Run(missing, func(t *testing.T) {
+			if info, err := driver.StatFile(ctx, missing); err == nil {
+				t.Errorf("expected %s not to exist, got %s", missing, info.Mode())
+			}
+		})
+	}
+
+	t.Run("ownership", func(t *testing.T) {
+		if !capabilities[drivers.CapOwnership] {
+			t.Skip("the driver does not support ownership")
+		}
+		info, err := driver.StatFile(ctx, Root+"/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, ok := info.Sys().(*tar.Header)
+		if !ok {
+			t.Fatalf("expected the tar header of the file, got %T", info.Sys())
+		}
+		testutil.CheckDeepEqual(t, []int{1000, 1001}, []int{header.Uid, header.Gid})
+	})
+}
+
+func testReadFile(t *testing.T, driver drivers.Driver) {
+	ctx := context.Background()
+	tests := []struct {
+		path     string
+		contents string
+	}{
+		{path: Root + "/file", contents: "hello\n"},
+		{path: Root + "/rel-link", contents: "hello\n"},
+		{path: Root + "/abs-link", contents: "hello\n"},
+		{path: Root + "/chain-link", contents: "hello\n"},
+		{path: Root + "/dir-link/nested", contents: "nested\n"},
+		{path: Root + "/hardlink", contents: "hello\n"},
+		{path: Root + "/replaced", contents: "new\n"},
+		{path: Root + "/opaque/new", contents: "new\n"},
+		{path: deepFile, contents: "deep\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			contents, err := driver.ReadFile(ctx, test.path)
+			if err != nil {
+				t.Fatalf("reading %s: %s", test.path, err)
+			}
+			testutil.CheckDeepEqual(t, test.contents, string(contents))
+		})
+	}
+
+	for _, unreadable := range []string{Root + "/dir", Root + "/removed", Root + "/opaque/old", Root + "/missing"} {
+		t.Run(unreadable, func(t *testing.T) {
+			if _, err := driver.ReadFile(ctx, unreadable); err == nil {
+				t.Errorf("expected reading %s to fail", unreadable)
+			}
+		})
+	}
+
+	t.Run("symlink loop", func(t *testing.T) {
+		_, err := driver.ReadFile(ctx, Root+"/loop-a")
+		checkSymlinkLoop(t, err)
+	})
+}
+
+// checkSymlinkLoop checks that following a symlink loop fails, the way it does on
+// Linux, rather than never returning.
+func checkSymlinkLoop(t *testing.T, err error) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), "too many levels of symbolic links") {
+		t.Errorf("expected too many levels of symbolic links, got %v", err)
+	}
+}
+
+func testReadDir(t *testing.T, driver drivers.Driver) {
+	ctx := context.Background()
+	tests := []struct {
+		path  string
+		files []string // name and mode of the files in the directory
+	}{
+		{
+			path: Root,
+			files: []string{
+				"abs-link Lrwxrwxrwx",
+				"chain-link Lrwxrwxrwx",
+				"deep drwxr-xr-x",
+				"dir drwx------",
+				"dir-link Lrwxrwxrwx",
+				"exec -rwxr-x---",
+				"fifo prw-------",
+				"file -rw-r--r--",
+				"hardlink -rw-r--r--",
+				"loop-a Lrwxrwxrwx",
+				"loop-b Lrwxrwxrwx",
+				"noperm ----------",
+				"opaque drwxr-xr-x",
+				"rel-link Lrwxrwxrwx",
+				"replaced -rw-------",
+				"setuid urwxr-xr-x",
+				"sticky dtrwxrwxrwx",
+			},
+		},
+		{path: Root + "/opaque", files: []string{"new -rw-r--r--"}},
+		{path: Root + "/dir-link", files: []string{"nested -rw-r--r--"}},
+		{path: Root + "/sticky", files: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			infos, err := driver.ReadDir(ctx, test.path)
+			if err != nil {
+				t.Fatalf("reading directory %s: %s", test.path, err)
+			}
+			var files []string
+			for _, info := range infos {
+				files = append(files, info.Name()+" "+info.Mode().String())
+			}
+			if !sort.StringsAreSorted(files) {
+				t.Errorf("expected the files to be sorted by name, got %v", files)
+			}
+			testutil.CheckDeepEqual(t, test.files, files)
+		})
+	}
+
+	t.Run("symlink loop", func(t *testing.T) {
+		_, err := driver.ReadDir(ctx, Root+"/loop-a")
+		checkSymlinkLoop(t, err)
+	})
+}
+
+func testGetConfig(t *testing.T, driver drivers.Driver) {
+	config, err := driver.GetConfig(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "conformance", config.Env["FIXTURE"])
+	testutil.CheckDeepEqual(t, []string{Root + "/exec"}, config.Entrypoint)
+	testutil.CheckDeepEqual(t, []string{"--flag"}, config.Cmd)
+	testutil.CheckDeepEqual(t, Root, config.Workdir)
+	testutil.CheckDeepEqual(t, "1000:1001", config.User)
+	testutil.CheckDeepEqual(t, "conformance", config.Labels["fixture"])
+	testutil.CheckDeepEqual(t, []string{"8080"}, config.ExposedPorts)
+	testutil.CheckDeepEqual(t, []string{"/data"}, config.Volumes)
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Root is the directory the files of the fixture image are in. The rest of the
+// image is a layer of random files.
+const Root = "/fixture"
+
+var (
+	// deepDir is nested deeper than most images, with a name longer than the 100
+	// bytes which fit in a plain tar header.
+	deepDir  = Root + "/deep/" + strings.Repeat("d/", 16) + strings.Repeat("n", 120)
+	deepFile = deepDir + "/leaf"
+)
+
+// entry is a file of a layer of the fixture image. Regular files get the contents.
+type entry struct {
+	header   tar.Header
+	contents string
+}
+
+func dir(name string, mode int64) entry {
+	return entry{header: tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: mode}}
+}
+
+func file(name string, mode int64, contents string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: mode}, contents: contents}
+}
+
+func owned(e entry, uid int, gid int) entry {
+	e.header.Uid, e.header.Gid = uid, gid
+	return e
+}
+
+func symlink(name string, target string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+}
+
+// layers are the layers of the fixture image, on top of the random one. The second
+// one removes and replaces files of the first.
+var layers = [][]entry{
+	{
+		dir("fixture", 0755),
+		owned(file("fixture/file", 0644, "hello\n"), 1000, 1001),
+		file("fixture/exec", 0750, "#!/bin/sh\n"),
+		file("fixture/setuid", 04755, "setuid\n"),
+		file("fixture/noperm", 0, "noperm\n"),
+		dir("fixture/sticky", 01777),
+		dir("fixture/dir", 0700),
+		file("fixture/dir/nested", 0644, "nested\n"),
+		symlink("fixture/rel-link", "file"),
+		symlink("fixture/abs-link", Root+"/file"),
+		symlink("fixture/dir-link", "dir"),
+		symlink("fixture/chain-link", "rel-link"),
+		symlink("fixture/loop-a", "loop-b"),
+		symlink("fixture/loop-b", "loop-a"),
+		{header: tar.Header{Name: "fixture/hardlink", Typeflag: tar.TypeLink, Linkname: "fixture/file"}},
+		{header: tar.Header{Name: "fixture/fifo", Typeflag: tar.TypeFifo, Mode: 0600}},
+		file("fixture/removed", 0644, "removed\n"),
+		file("fixture/replaced", 0644, "old\n"),
+		dir("fixture/opaque", 0755),
+		file("fixture/opaque/old", 0644, "old\n"),
+		file(strings.TrimPrefix(deepFile, "/"), 0644, "deep\n"),
+	},
+	{
+		file("fixture/.wh.removed", 0, ""),
+		file("fixture/replaced", 0600, "new\n"),
+		dir("fixture/opaque", 0755),
+		file("fixture/opaque/.wh..wh..opq", 0, ""),
+		file("fixture/opaque/new", 0644, "new\n"),
+	},
+}
+
+// config is the config of the fixture image.
+var config = v1.Config{
+	Env:          []string{"PATH=/usr/local/bin:/usr/bin:/bin", "FIXTURE=conformance"},
+	Entrypoint:   []string{Root + "/exec"},
+	Cmd:          []string{"--flag"},
+	WorkingDir:   Root,
+	User:         "1000:1001",
+	Labels:       map[string]string{"fixture": "conformance"},
+	ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+	Volumes:      map[string]struct{}{"/data": {}},
+}
+
+// Image builds the fixture image the suite runs drivers against, with symlinks,
+// hard links, whiteouts, unusual permissions and deep paths.
+func Image() (v1.Image, error) {
+	base, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating random layer")
+	}
+	img, err := mutate.AppendLayers(empty.Image, base)
+	if err != nil {
+		return nil, err
+	}
+	for _, entries := range layers {
+		layer, err := newLayer(entries)
+		if err != nil {
+			return nil, err
+		}
+		if img, err = mutate.AppendLayers(img, layer); err != nil {
+			return nil, err
+		}
+	}
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	configFile = configFile.DeepCopy()
+	configFile.OS = "linux"
+	configFile.Architecture = runtime.GOARCH
+	configFile.Config = config
+	return mutate.ConfigFile(img, configFile)
+}
+
+// newLayer builds an uncompressed layer from the entries.
+func newLayer(entries []entry) (v1.Layer, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := e.header
+		header.Size = int64(len(e.contents))
+		if err := tw.WriteHeader(&header); err != nil {
+			return nil, errors.Wrapf(err, "writing %s", header.Name)
+		}
+		if _, err := tw.Write([]byte(e.contents)); err != nil {
+			return nil, errors.Wrapf(err, "writing %s", header.Name)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	contents := buf.Bytes()
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(contents)), nil
+	})
+}
@@ -0,0 +1,339 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers_test
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/GoogleContainerTools/container-structure-test/internal/pkgutil"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers/conformance"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestTarDriverConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, img v1.Image) drivers.Driver {
+		file := filepath.Join(t.TempDir(), "fixture.tar")
+		tag, err := name.NewTag("conformance:latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tarball.WriteToFile(file, tag, img); err != nil {
+			t.Fatal(err)
+		}
+		driver, err := drivers.NewTarDriver(drivers.DriverConfig{Image: file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return driver
+	})
+}
+
+func TestHostDriverConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, img v1.Image) drivers.Driver {
+		root := t.TempDir()
+		if err := extract(img, root); err != nil {
+			t.Fatal(err)
+		}
+		configFile, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata := filepath.Join(t.TempDir(), "metadata.json")
+		contents, err := json.Marshal(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(metadata, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		driver, err := drivers.NewHostDriver(drivers.DriverConfig{Metadata: metadata})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rootedDriver{Driver: driver, root: root}
+	})
+}
+
+// TestDockerDriverConformance runs the suite against a real docker daemon. It is
+// skipped without one, unless CST_REQUIRE_DOCKER is set, as it is in CI.
+func TestDockerDriverConformance(t *testing.T) {
+	cli, err := docker.NewClientFromEnv()
+	if err == nil {
+		err = cli.Ping()
+	}
+	if err != nil {
+		if os.Getenv("CST_REQUIRE_DOCKER") != "" {
+			t.Fatalf("docker is not available: %s", err)
+		}
+		t.Skipf("docker is not available: %s", err)
+	}
+	conformance.Run(t, func(t *testing.T, img v1.Image) drivers.Driver {
+		tag, err := name.NewTag("container-structure-test/conformance:latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := daemon.Write(tag, img); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cli.RemoveImageExtended(tag.String(), docker.RemoveImageOptions{Force: true})
+		})
+		driver, err := drivers.NewDockerDriver(drivers.DriverConfig{Image: tag.String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return driver
+	})
+}
+
+// TestDockerDriverArchiveConformance runs the suite against a fake daemon, which
+// serves the files of the image as the archive API of docker does, so that the
+// driver is checked where docker is not available. The fake only mirrors how the
+// daemon is expected to behave: TestDockerDriverConformance, against a real daemon,
+// is the authoritative check.
+func TestDockerDriverArchiveConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, img v1.Image) drivers.Driver {
+		daemon, err := newArchiveDaemon(img, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(daemon)
+		t.Cleanup(server.Close)
+		t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+		t.Setenv("DOCKER_TLS_VERIFY", "")
+		t.Setenv("DOCKER_API_VERSION", "")
+		driver, err := drivers.NewDockerDriver(drivers.DriverConfig{Image: "conformance:latest"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return driver
+	})
+}
+
+// archiveDaemon serves the parts of the docker API used to read files: creating and
+// removing containers, inspecting the image and downloading archives.
+type archiveDaemon struct {
+	root   string             // where the image is unpacked
+	files  *pkgutil.FileIndex // the tar headers of the files, with their ownership
+	config *v1.ConfigFile
+}
+
+func newArchiveDaemon(img v1.Image, root string) (*archiveDaemon, error) {
+	if err := extract(img, root); err != nil {
+		return nil, err
+	}
+	files, err := pkgutil.BuildFileIndex(img)
+	if err != nil {
+		return nil, err
+	}
+	config, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return &archiveDaemon{root: root, files: files, config: config}, nil
+}
+
+func (f *archiveDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/containers/create"):
+		json.NewEncoder(w).Encode(docker.Container{ID: "fixture"})
+	case r.Method == http.MethodDelete && strings.HasSuffix(r.URL.Path, "/containers/fixture"):
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/containers/fixture/archive"):
+		if err := f.archive(w, r.URL.Query().Get("path")); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/json") && strings.Contains(r.URL.Path, "/images/"):
+		config := f.config.Config
+		ports := map[docker.Port]struct{}{}
+		for p := range config.ExposedPorts {
+			ports[docker.Port(p)] = struct{}{}
+		}
+		json.NewEncoder(w).Encode(docker.Image{
+			Architecture: f.config.Architecture,
+			OS:           f.config.OS,
+			Config: &docker.Config{
+				Env:          config.Env,
+				Entrypoint:   config.Entrypoint,
+				Cmd:          config.Cmd,
+				WorkingDir:   config.WorkingDir,
+				User:         config.User,
+				Labels:       config.Labels,
+				ExposedPorts: ports,
+				Volumes:      config.Volumes,
+			},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// archive writes the tar archive docker returns for a path: the file itself, named
+// after the last element of the path, followed by its contents if it is a directory.
+// Symlinks in the parent directories are followed, but not the file itself.
+func (f *archiveDaemon) archive(w io.Writer, target string) error {
+	dir, err := filepath.EvalSymlinks(filepath.Join(f.root, path.Dir(target)))
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(dir, path.Base(target))
+	if _, err := os.Lstat(base); err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	return filepath.Walk(base, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(f.root, file)
+		if err != nil {
+			return err
+		}
+		// directories only implied by the files in them are not in the index
+		if indexed, ok := f.files.Stat("/" + rel); ok {
+			info = indexed
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		if indexed, ok := info.Sys().(*tar.Header); ok {
+			copied := *indexed
+			header = &copied
+		}
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(contents)
+		return err
+	})
+}
+
+// rootedDriver reads the files of an image unpacked in a directory of the host,
+// rather than at its root.
+type rootedDriver struct {
+	drivers.Driver
+	root string
+}
+
+func (d rootedDriver) StatFile(ctx context.Context, path string) (os.FileInfo, error) {
+	return d.Driver.StatFile(ctx, filepath.Join(d.root, path))
+}
+
+func (d rootedDriver) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	return d.Driver.ReadFile(ctx, filepath.Join(d.root, path))
+}
+
+func (d rootedDriver) ReadDir(ctx context.Context, path string) ([]os.FileInfo, error) {
+	return d.Driver.ReadDir(ctx, filepath.Join(d.root, path))
+}
+
+// extract unpacks the filesystem of an image into a directory, as it would be at the
+// root of a host. Absolute symlinks are made relative, so that they point into the
+// directory.
+func extract(img v1.Image, root string) error {
+	contents := pkgutil.Flatten(img)
+	defer contents.Close()
+	tr := tar.NewReader(contents)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(root, header.Name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := header.Linkname
+			if path.IsAbs(link) {
+				if link, err = filepath.Rel(filepath.Dir(target), filepath.Join(root, link)); err != nil {
+					return err
+				}
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeLink:
+			if err := os.Link(filepath.Join(root, header.Linkname), target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeFifo:
+			if err := mkfifo(target); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		// the setuid and sticky bits are dropped by the umask
+		if err := os.Chmod(target, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+}
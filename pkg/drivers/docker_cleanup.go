@@ -0,0 +1,177 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/version"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// The labels of every container and image created by the docker driver, so that
+// the ones left behind by --save or a crash can be found and removed.
+const (
+	LabelRunID   = "com.google.container-structure-test.run-id"
+	LabelTest    = "com.google.container-structure-test.test"
+	LabelVersion = "com.google.container-structure-test.version"
+)
+
+// NewRunID returns an ID for a run of the tests, which starts with the time of
+// the run so that IDs sort by age.
+func NewRunID() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		logrus.Warnf("error generating run ID: %s", err)
+	}
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+}
+
+// resourceLabels returns the labels of the resources created by a driver.
+func resourceLabels(args DriverConfig) map[string]string {
+	runID := args.RunID
+	if runID == "" {
+		runID = NewRunID()
+	}
+	return map[string]string{
+		LabelRunID:   runID,
+		LabelTest:    args.TestName,
+		LabelVersion: version.GetVersion().Version,
+	}
+}
+
+// CleanupOptions select the leftover resources to remove.
+type CleanupOptions struct {
+	RunID     string        // only remove the resources of this run
+	OlderThan time.Duration // only remove resources created at least this long ago
+	DryRun    bool          // find the resources without removing them
+}
+
+// Resource is a container or image created by the docker driver.
+type Resource struct {
+	Kind    string // container or image
+	ID      string
+	RunID   string
+	Test    string
+	Created time.Time
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s %s (run %s, %s, created %s)", r.Kind, shortID(r.ID), r.RunID, r.Test, r.Created.Format(time.RFC3339))
+}
+
+// CleanupDocker removes the containers, and then the images, left behind by the
+// docker driver, and returns the ones it removed. Resources which cannot be removed
+// are logged and skipped.
+func CleanupDocker(ctx context.Context, opts CleanupOptions) ([]Resource, error) {
+	cli, err := docker.NewClientFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	filter := LabelRunID
+	if opts.RunID != "" {
+		filter = fmt.Sprintf("%s=%s", LabelRunID, opts.RunID)
+	}
+	filters := map[string][]string{"label": {filter}}
+	cutoff := time.Now().Add(-opts.OlderThan)
+
+	containers, err := cli.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: filters,
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing containers")
+	}
+	var removed []Resource
+	for _, c := range containers {
+		r := Resource{Kind: "container", ID: c.ID, RunID: c.Labels[LabelRunID], Test: c.Labels[LabelTest], Created: time.Unix(c.Created, 0)}
+		if r.Created.After(cutoff) {
+			continue
+		}
+		if !opts.DryRun {
+			if err := cli.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID, Force: true, Context: ctx}); err != nil {
+				logrus.Warnf("Error when removing container %s: %s", c.ID, err.Error())
+				continue
+			}
+		}
+		removed = append(removed, r)
+	}
+
+	images, err := cli.ListImages(docker.ListImagesOptions{
+		All:     true,
+		Filters: filters,
+		Context: ctx,
+	})
+	if err != nil {
+		return removed, errors.Wrap(err, "Error listing images")
+	}
+	var pending []Resource
+	for _, img := range images {
+		r := Resource{Kind: "image", ID: img.ID, RunID: img.Labels[LabelRunID], Test: img.Labels[LabelTest], Created: time.Unix(img.Created, 0)}
+		if !r.Created.After(cutoff) {
+			pending = append(pending, r)
+		}
+	}
+	if opts.DryRun {
+		return append(removed, pending...), nil
+	}
+	// intermediate images are chained, and an image cannot be removed before the
+	// ones built on top of it, so the newest are removed first, and the ones which
+	// fail are retried as long as others can be removed.
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Created.After(pending[j].Created) })
+	errs := map[string]error{}
+	for len(pending) > 0 {
+		var failed []Resource
+		for _, r := range pending {
+			err := cli.RemoveImageExtended(r.ID, docker.RemoveImageOptions{Force: true, Context: ctx})
+			if err != nil && err != docker.ErrNoSuchImage {
+				errs[r.ID] = err
+				failed = append(failed, r)
+				continue
+			}
+			removed = append(removed, r)
+		}
+		if len(failed) == len(pending) {
+			break
+		}
+		pending = failed
+	}
+	for _, r := range pending {
+		if err, ok := errs[r.ID]; ok {
+			logrus.Warnf("Error when removing image %s: %s", r.ID, err.Error())
+		}
+	}
+	return removed, nil
+}
+
+// shortID returns the abbreviated form of a container or image ID, as printed by docker.
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// fakeDaemon serves the parts of the docker API used to clean up, to commit
+// containers, and to run commands through the exec API (see serveExec). Images
+// cannot be removed before the images built on top of them, nor running containers
+// without forcing it.
+type fakeDaemon struct {
+	mu         sync.Mutex
+	containers []docker.APIContainers
+	images     []docker.APIImages
+	committed  []string // containers committed to an image, in order
+	exec       execState
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var filters map[string][]string
+	json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+	path := r.URL.Path[strings.Index(r.URL.Path, "/"):]
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/containers/json"):
+		var matching []docker.APIContainers
+		for _, c := range f.containers {
+			if matchesLabels(c.Labels, filters["label"]) {
+				matching = append(matching, c)
+			}
+		}
+		json.NewEncoder(w).Encode(matching)
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/images/json"):
+		var matching []docker.APIImages
+		for _, img := range f.images {
+			if matchesLabels(img.Labels, filters["label"]) {
+				matching = append(matching, img)
+			}
+		}
+		json.NewEncoder(w).Encode(matching)
+	case r.Method == http.MethodDelete && strings.Contains(path, "/containers/"):
+		id := path[strings.LastIndex(path, "/")+1:]
+		if f.exec.running[id] && r.URL.Query().Get("force") != "1" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		delete(f.exec.running, id)
+		for i, c := range f.containers {
+			if c.ID == id {
+				f.containers = append(f.containers[:i], f.containers[i+1:]...)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/commit"):
+		var config docker.Config
+		json.NewDecoder(r.Body).Decode(&config)
+		imageID := fmt.Sprintf("sha256:commit%d", len(f.committed)+1)
+		f.committed = append(f.committed, r.URL.Query().Get("container"))
+		f.images = append(f.images, docker.APIImages{ID: imageID, Labels: config.Labels})
+		json.NewEncoder(w).Encode(docker.Image{ID: imageID})
+	case r.Method == http.MethodDelete && strings.Contains(path, "/images/"):
+		id := path[strings.LastIndex(path, "/")+1:]
+		for _, img := range f.images {
+			if img.ParentID == id {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		for i, img := range f.images {
+			if img.ID == id {
+				f.images = append(f.images[:i], f.images[i+1:]...)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		if !f.serveExec(w, r, path) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func matchesLabels(labels map[string]string, filters []string) bool {
+	for _, f := range filters {
+		key, value, hasValue := strings.Cut(f, "=")
+		if v, ok := labels[key]; !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCleanupDocker(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	labels := func(runID string) map[string]string {
+		return map[string]string{LabelRunID: runID, LabelTest: "Command Test: t"}
+	}
+	newDaemon := func() *fakeDaemon {
+		return &fakeDaemon{
+			containers: []docker.APIContainers{
+				{ID: "c1", Created: old, Labels: labels("run1")},
+				{ID: "c2", Created: time.Now().Unix(), Labels: labels("run2")},
+				{ID: "other", Created: old},
+			},
+			// chained images of one test, committed within the same second
+			images: []docker.APIImages{
+				{ID: "sha256:base", Created: old, Labels: labels("run1")},
+				{ID: "sha256:mid", ParentID: "sha256:base", Created: old, Labels: labels("run1")},
+				{ID: "sha256:leaf", ParentID: "sha256:mid", Created: old, Labels: labels("run1")},
+				{ID: "sha256:user"},
+			},
+		}
+	}
+	ids := func(resources []Resource) []string {
+		var ids []string
+		for _, r := range resources {
+			ids = append(ids, r.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	tests := []struct {
+		name      string
+		opts      CleanupOptions
+		removed   []string
+		remaining int
+	}{
+		{
+			name:      "all",
+			opts:      CleanupOptions{},
+			removed:   []string{"c1", "c2", "sha256:base", "sha256:leaf", "sha256:mid"},
+			remaining: 2,
+		},
+		{
+			name:      "older than",
+			opts:      CleanupOptions{OlderThan: 24 * time.Hour},
+			removed:   []string{"c1", "sha256:base", "sha256:leaf", "sha256:mid"},
+			remaining: 3,
+		},
+		{
+			name:      "run id",
+			opts:      CleanupOptions{RunID: "run2"},
+			removed:   []string{"c2"},
+			remaining: 6,
+		},
+		{
+			name:      "dry run",
+			opts:      CleanupOptions{DryRun: true},
+			removed:   []string{"c1", "c2", "sha256:base", "sha256:leaf", "sha256:mid"},
+			remaining: 7,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			daemon := newDaemon()
+			server := httptest.NewServer(daemon)
+			defer server.Close()
+			t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+			t.Setenv("DOCKER_TLS_VERIFY", "")
+			t.Setenv("DOCKER_API_VERSION", "")
+
+			removed, err := CleanupDocker(context.Background(), test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.CheckDeepEqual(t, test.removed, ids(removed))
+			testutil.CheckDeepEqual(t, test.remaining, len(daemon.containers)+len(daemon.images))
+		})
+	}
+}
+
+func TestImageLabels(t *testing.T) {
+	d := &DockerDriver{
+		originalImage: "image",
+		currentImage:  "image",
+		labels:        resourceLabels(DriverConfig{RunID: "run", TestName: "Metadata Test"}),
+	}
+	testutil.CheckDeepEqual(t, "run", d.labels[LabelRunID])
+	testutil.CheckDeepEqual(t, "Metadata Test", d.labels[LabelTest])
+
+	labels := map[string]string{"maintainer": "me", LabelRunID: "run"}
+	// the labels of the original image are left as they are
+	testutil.CheckDeepEqual(t, labels, d.imageLabels(labels))
+	// while the ones added to committed images are hidden
+	d.currentImage = "committed"
+	testutil.CheckDeepEqual(t, map[string]string{"maintainer": "me"}, d.imageLabels(labels))
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// DebugCommand returns the docker command running an interactive shell in the
+// environment of a test. In single container mode, the shell is run in the container
+// of the test; otherwise, in a new container of the image committed by its setup,
+// or from the container of the failing command once kept.
+func (d *DockerDriver) DebugCommand(envVars []unversioned.EnvVar, opts ExecOptions, shell string) []string {
+	var env []string
+	for _, envVar := range envVars {
+		env = append(env, fmt.Sprintf("%s=%s", envVar.Key, envVar.Value))
+	}
+	var cmd []string
+	user := opts.User
+	if d.containerID != "" {
+		cmd = []string{"docker", "exec", "-it"}
+		env = append(append([]string{}, d.execEnv...), env...)
+	} else {
+		cmd = append([]string{"docker", "run", "--rm", "-it", "--entrypoint", ""}, dockerRunFlags(d.runtime, d.platform, d.runOpts)...)
+		if user == "" {
+			user = d.runOpts.User
+		}
+	}
+	if user != "" {
+		cmd = append(cmd, "--user", user)
+	}
+	if opts.WorkingDir != "" {
+		cmd = append(cmd, "--workdir", opts.WorkingDir)
+	}
+	for _, e := range env {
+		cmd = append(cmd, "-e", e)
+	}
+	if d.containerID != "" {
+		return append(cmd, d.containerID, shell)
+	}
+	return append(cmd, d.currentImage, shell)
+}
+
+// Keep makes Destroy leave the containers and images of the driver behind, even
+// without --save, so that a failing test can be debugged. Outside of single container
+// mode, the container of the last command is committed, so that the debug command
+// starts from what the command left behind.
+func (d *DockerDriver) Keep(ctx context.Context) error {
+	d.keep = true
+	if d.containerID != "" || len(d.pending) == 0 {
+		return nil
+	}
+	image, err := d.commitContainer(ctx, d.pending[len(d.pending)-1])
+	if err != nil {
+		return errors.Wrap(err, "Error committing container")
+	}
+	d.currentImage = image.ID
+	return nil
+}
+
+// release removes the container of a command once it has run, or leaves it for
+// Destroy when failing tests are debugged, so that it can be kept.
+func (d *DockerDriver) release(containerID string) {
+	if d.debugOnFailure {
+		d.pending = append(d.pending, containerID)
+		return
+	}
+	d.removeContainer(containerID)
+}
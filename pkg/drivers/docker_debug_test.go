@@ -0,0 +1,84 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestDebugCommand(t *testing.T) {
+	d := &DockerDriver{
+		originalImage: "image",
+		currentImage:  "sha256:setup",
+		runtime:       "runsc",
+		runOpts: unversioned.ContainerRunOptions{
+			User:         "app",
+			Capabilities: []string{"NET_ADMIN"},
+			PidsLimit:    100,
+			Tmpfs:        []string{"/tmp"},
+			Sysctls:      map[string]string{"b": "2", "a": "1"},
+			EnvVars:      []string{"TOKEN"},
+		},
+	}
+	envVars := []unversioned.EnvVar{{Key: "MODE", Value: "debug"}}
+
+	testutil.CheckDeepEqual(t, []string{
+		"docker", "run", "--rm", "-it", "--entrypoint", "",
+		"--runtime", "runsc", "--cap-add", "NET_ADMIN", "--pids-limit", "100", "--tmpfs", "/tmp",
+		"--sysctl", "a=1", "--sysctl", "b=2", "-e", "TOKEN",
+		"--user", "app", "-e", "MODE=debug", "sha256:setup", "/bin/sh",
+	}, d.DebugCommand(envVars, ExecOptions{}, "/bin/sh"))
+
+	// in single container mode, the shell is run in the container of the test
+	d.containerID = "container"
+	d.execEnv = []string{"GLOBAL=1"}
+	testutil.CheckDeepEqual(t, []string{
+		"docker", "exec", "-it", "--user", "root", "--workdir", "/app",
+		"-e", "GLOBAL=1", "-e", "MODE=debug", "container", "bash",
+	}, d.DebugCommand(envVars, ExecOptions{User: "root", WorkingDir: "/app"}, "bash"))
+}
+
+func TestRelease(t *testing.T) {
+	daemon := &fakeDaemon{}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+	cli, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &DockerDriver{cli: *cli, debugOnFailure: true, originalImage: "image", currentImage: "sha256:setup"}
+	d.release("c1")
+	d.release("c2")
+	testutil.CheckDeepEqual(t, []string{"c1", "c2"}, d.pending)
+
+	// the container of the failing command is committed, for the shell to start from
+	if err := d.Keep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{"c2"}, daemon.committed)
+	cmd := d.DebugCommand(nil, ExecOptions{}, "sh")
+	testutil.CheckDeepEqual(t, []string{"sha256:commit1", "sh"}, cmd[len(cmd)-2:])
+
+	// kept containers and images are left behind
+	d.Destroy()
+	testutil.CheckDeepEqual(t, 1, len(daemon.images))
+}
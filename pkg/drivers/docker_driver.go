@@ -18,12 +18,14 @@ import (
 	"archive/tar"
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/joho/godotenv"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -44,6 +46,19 @@ type DockerDriver struct {
 	runtime       string
 	platform      string
 	runOpts       unversioned.ContainerRunOptions
+	hostOpts      *docker.HostConfig // host config of the containers, from the runtime and run options
+
+	singleContainer bool     // run every command of a test in one container, through the exec API
+	containerID     string   // the container of the test, once started in single container mode
+	execEnv         []string // env vars set by SetEnv and Setup, in single container mode
+
+	labels     map[string]string // labels of the created containers and images
+	containers []string          // IDs of the created containers
+	images     []string          // IDs of the committed images
+
+	debugOnFailure bool     // keep the containers of commands until Destroy, so that a failing test can be debugged
+	pending        []string // containers of commands, removed by Destroy unless kept
+	keep           bool     // leave the containers and images of the driver behind
 }
 
 func NewDockerDriver(args DriverConfig) (Driver, error) {
@@ -51,6 +66,10 @@ func NewDockerDriver(args DriverConfig) (Driver, error) {
 	if err != nil {
 		return nil, err
 	}
+	hostConfig, err := newHostConfig(args.Runtime, args.RunOpts)
+	if err != nil {
+		return nil, err
+	}
 	return &DockerDriver{
 		originalImage: args.Image,
 		currentImage:  args.Image,
@@ -60,49 +79,71 @@ func NewDockerDriver(args DriverConfig) (Driver, error) {
 		runtime:       args.Runtime,
 		platform:      args.Platform,
 		runOpts:       args.RunOpts,
+		hostOpts:      hostConfig,
+
+		singleContainer: args.SingleContainer,
+		debugOnFailure:  args.DebugOnFailure,
+
+		labels: resourceLabels(args),
 	}, nil
 }
 
+// hostConfig returns the host config to create containers with, which callers may
+// modify.
 func (d *DockerDriver) hostConfig() *docker.HostConfig {
-	if d.runOpts.IsSet() && d.runtime != "" {
-		return &docker.HostConfig{
-			Capabilities: d.runOpts.Capabilities,
-			Binds:        d.runOpts.BindMounts,
-			Privileged:   d.runOpts.Privileged,
-			Runtime:      d.runtime,
-		}
-	}
-	if d.runOpts.IsSet() {
-		return &docker.HostConfig{
-			Capabilities: d.runOpts.Capabilities,
-			Binds:        d.runOpts.BindMounts,
-			Privileged:   d.runOpts.Privileged,
-		}
-	}
-	if d.runtime != "" {
-		return &docker.HostConfig{
-			Runtime: d.runtime,
-		}
+	if d.hostOpts == nil {
+		return nil
 	}
-	return nil
+	hostConfig := *d.hostOpts
+	return &hostConfig
 }
 
+// Destroy removes the containers and images created by the driver, unless they are
+// saved or kept for debugging. It does not take a context, so that it still cleans
+// up once a run is cancelled.
 func (d *DockerDriver) Destroy() {
+	if d.keep {
+		return
+	}
+	for _, id := range d.pending {
+		d.removeContainer(id)
+	}
+	if d.containerID != "" {
+		d.removeContainer(d.containerID)
+	}
 	// since intermediate images are chained, removing the most current
 	// image (that isn't the original) removes all previous ones as well.
-	if d.currentImage != d.originalImage {
+	if d.currentImage != d.originalImage && !d.save {
 		if err := d.cli.RemoveImage(d.currentImage); err != nil {
 			logrus.Warnf("error removing image: %s", err)
 		}
 	}
 }
 
-func (d *DockerDriver) SetEnv(envVars []unversioned.EnvVar) error {
+func (d *DockerDriver) Capabilities() []Capability {
+	return dockerCapabilities(d.singleContainer)
+}
+
+func dockerCapabilities(singleContainer bool) []Capability {
+	caps := []Capability{CapCommands, CapSetup, CapOwnership, CapMetadata, CapXattrs, CapServices, CapRunOptions}
+	if singleContainer {
+		// otherwise each command runs in a new container, so there is nothing to tear down
+		caps = append(caps, CapTeardown)
+	}
+	return caps
+}
+
+func (d *DockerDriver) SetEnv(ctx context.Context, envVars []unversioned.EnvVar) error {
 	if len(envVars) == 0 {
 		return nil
 	}
+	if d.singleContainer {
+		d.execEnv = append(d.execEnv, d.processEnvVars(envVars)...)
+		return nil
+	}
 	env := d.processEnvVars(envVars)
-	container, err := d.cli.CreateContainer(docker.CreateContainerOptions{
+	container, err := d.createContainer(docker.CreateContainerOptions{
+		Context:  ctx,
 		Platform: d.platform,
 		Config: &docker.Config{
 			Image:        d.currentImage,
@@ -119,9 +160,7 @@ func (d *DockerDriver) SetEnv(envVars []unversioned.EnvVar) error {
 		return errors.Wrap(err, "Error creating container")
 	}
 	defer d.removeContainer(container.ID)
-	image, err := d.cli.CommitContainer(docker.CommitContainerOptions{
-		Container: container.ID,
-	})
+	image, err := d.commitContainer(ctx, container.ID)
 	if err != nil {
 		return errors.Wrap(err, "Error committing container")
 	}
@@ -129,10 +168,14 @@ func (d *DockerDriver) SetEnv(envVars []unversioned.EnvVar) error {
 	return nil
 }
 
-func (d *DockerDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]string) error {
+func (d *DockerDriver) Setup(ctx context.Context, envVars []unversioned.EnvVar, fullCommands [][]string) error {
 	env := d.processEnvVars(envVars)
+	if d.singleContainer {
+		d.execEnv = append(d.execEnv, env...)
+		return d.execAll(ctx, "setup", fullCommands)
+	}
 	for _, cmd := range fullCommands {
-		img, err := d.runAndCommit(env, cmd)
+		img, err := d.runAndCommit(ctx, env, cmd)
 		if err != nil {
 			return err
 		}
@@ -141,18 +184,28 @@ func (d *DockerDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]stri
 	return nil
 }
 
-func (d *DockerDriver) Teardown(_ [][]string) error {
+func (d *DockerDriver) Teardown(ctx context.Context, fullCommands [][]string) error {
+	if d.singleContainer {
+		return d.execAll(ctx, "teardown", fullCommands)
+	}
 	// since we create a new driver for each test, skip teardown commands
 	logrus.Debug("Docker driver does not support teardown commands, since each test gets a new driver. Skipping commands.")
 	return nil
 }
 
-func (d *DockerDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error) {
+func (d *DockerDriver) ProcessCommand(ctx context.Context, envVars []unversioned.EnvVar, fullCommand []string, opts ExecOptions) (string, string, int, error) {
 	var env []string
 	for _, envVar := range envVars {
 		env = append(env, fmt.Sprintf("%s=%s", envVar.Key, envVar.Value))
 	}
-	stdout, stderr, exitCode, err := d.exec(env, fullCommand)
+	var stdout, stderr string
+	var exitCode int
+	var err error
+	if d.singleContainer {
+		stdout, stderr, exitCode, err = d.execInTestContainer(ctx, env, fullCommand, opts)
+	} else {
+		stdout, stderr, exitCode, err = d.exec(ctx, env, fullCommand, opts)
+	}
 	if err != nil {
 		return "", "", -1, err
 	}
@@ -207,10 +260,16 @@ func (d *DockerDriver) processEnvVars(vars []unversioned.EnvVar) []string {
 
 // copies a tar archive starting at the specified path from the image, and returns
 // a tar reader which can be used to iterate through its contents and retrieve metadata
-func (d *DockerDriver) retrieveTar(path string) (*tar.Reader, error) {
+func (d *DockerDriver) retrieveTar(ctx context.Context, path string) (*tar.Reader, error) {
+	if d.containerID != "" {
+		// in single container mode, files are read from the container of the test,
+		// so that the changes of its setup commands are visible.
+		return d.downloadTar(ctx, d.containerID, path)
+	}
 	// this contains a placeholder command which does not get run, since
 	// the client doesn't allow creating a container without a command.
-	container, err := d.cli.CreateContainer(docker.CreateContainerOptions{
+	container, err := d.createContainer(docker.CreateContainerOptions{
+		Context:  ctx,
 		Platform: d.platform,
 		Config: &docker.Config{
 			Image: d.currentImage,
@@ -223,24 +282,31 @@ func (d *DockerDriver) retrieveTar(path string) (*tar.Reader, error) {
 		return nil, errors.Wrap(err, "Error creating container")
 	}
 	defer d.removeContainer(container.ID)
+	return d.downloadTar(ctx, container.ID, path)
+}
 
+// downloadTar copies a tar archive starting at the specified path from a container.
+func (d *DockerDriver) downloadTar(ctx context.Context, containerID string, path string) (*tar.Reader, error) {
 	var b bytes.Buffer
 	stream := bufio.NewWriter(&b)
 
-	if err = d.cli.DownloadFromContainer(container.ID, docker.DownloadFromContainerOptions{
+	if err := d.cli.DownloadFromContainer(containerID, docker.DownloadFromContainerOptions{
+		Context:      ctx,
 		OutputStream: stream,
 		Path:         path,
 	}); err != nil {
 		return nil, errors.Wrap(err, "Error retrieving file from container")
 	}
-	if err = stream.Flush(); err != nil {
+	if err := stream.Flush(); err != nil {
 		return nil, err
 	}
 	return tar.NewReader(bytes.NewReader(b.Bytes())), nil
 }
 
-func (d *DockerDriver) StatFile(target string) (os.FileInfo, error) {
-	reader, err := d.retrieveTar(target)
+// StatFile returns the metadata of a file, without following it if it is a
+// symlink. Files of every type are reported, FIFOs and device nodes included.
+func (d *DockerDriver) StatFile(ctx context.Context, target string) (os.FileInfo, error) {
+	reader, err := d.retrieveTar(ctx, target)
 	if err != nil {
 		return nil, err
 	}
@@ -249,20 +315,24 @@ func (d *DockerDriver) StatFile(target string) (os.FileInfo, error) {
 		if err == io.EOF {
 			break
 		}
-		switch header.Typeflag {
-		case tar.TypeDir, tar.TypeReg, tar.TypeLink, tar.TypeSymlink:
-			if filepath.Clean(header.Name) == path.Base(target) {
-				return header.FileInfo(), nil
-			}
-		default:
-			continue
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading tar")
+		}
+		if filepath.Clean(header.Name) == path.Base(target) {
+			return header.FileInfo(), nil
 		}
 	}
 	return nil, fmt.Errorf("File %s not found in image", target)
 }
 
-func (d *DockerDriver) ReadFile(target string) ([]byte, error) {
-	reader, err := d.retrieveTar(target)
+func (d *DockerDriver) ReadFile(ctx context.Context, target string) ([]byte, error) {
+	return d.readFile(ctx, target, 0)
+}
+
+// readFile reads a file, following it if it is a symlink, after the given number of
+// symlinks were followed to reach it.
+func (d *DockerDriver) readFile(ctx context.Context, target string, hops int) ([]byte, error) {
+	reader, err := d.retrieveTar(ctx, target)
 	if err != nil {
 		return nil, err
 	}
@@ -271,29 +341,43 @@ func (d *DockerDriver) ReadFile(target string) ([]byte, error) {
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading tar")
+		}
+		if filepath.Clean(header.Name) != path.Base(target) {
+			continue
+		}
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if filepath.Clean(header.Name) == path.Base(target) {
-				return nil, fmt.Errorf("Cannot read specified path: %s is a directory, not a file", target)
-			}
+			return nil, fmt.Errorf("Cannot read specified path: %s is a directory, not a file", target)
 		case tar.TypeSymlink:
-			return d.ReadFile(header.Linkname)
-		case tar.TypeReg, tar.TypeLink:
-			if filepath.Clean(header.Name) == path.Base(target) {
-				var b bytes.Buffer
-				stream := bufio.NewWriter(&b)
-				io.Copy(stream, reader)
-				return b.Bytes(), nil
+			if hops == maxSymlinks {
+				return nil, symlinkLoopError(target)
 			}
+			return d.readFile(ctx, linkTarget(target, header.Linkname), hops+1)
+		case tar.TypeReg, tar.TypeLink:
+			var b bytes.Buffer
+			stream := bufio.NewWriter(&b)
+			io.Copy(stream, reader)
+			stream.Flush()
+			return b.Bytes(), nil
 		default:
-			continue
+			return nil, fmt.Errorf("Cannot read specified path: %s is not a regular file", target)
 		}
 	}
 	return nil, fmt.Errorf("File %s not found in image", target)
 }
 
-func (d *DockerDriver) ReadDir(target string) ([]os.FileInfo, error) {
-	reader, err := d.retrieveTar(target)
+// ReadDir returns the metadata of the files of every type in a directory, sorted
+// by name. The directory is followed if it is a symlink.
+func (d *DockerDriver) ReadDir(ctx context.Context, target string) ([]os.FileInfo, error) {
+	return d.readDir(ctx, target, 0)
+}
+
+// readDir reads a directory, following it if it is a symlink, after the given number
+// of symlinks were followed to reach it.
+func (d *DockerDriver) readDir(ctx context.Context, target string, hops int) ([]os.FileInfo, error) {
+	reader, err := d.retrieveTar(ctx, target)
 	if err != nil {
 		return nil, err
 	}
@@ -303,26 +387,55 @@ func (d *DockerDriver) ReadDir(target string) ([]os.FileInfo, error) {
 		if err == io.EOF {
 			break
 		}
-		if header.Typeflag == tar.TypeDir {
-			// we only want top level dirs here, no recursion. to get these, remove
-			// trailing separator and split on separator. there should only be two parts.
-			parts := strings.Split(strings.TrimSuffix(header.Name, string(os.PathSeparator)), string(os.PathSeparator))
-			if len(parts) == 2 {
-				infos = append(infos, header.FileInfo())
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading tar")
+		}
+		name := filepath.Clean(header.Name)
+		if name == path.Base(target) && header.Typeflag == tar.TypeSymlink {
+			if hops == maxSymlinks {
+				return nil, symlinkLoopError(target)
 			}
+			return d.readDir(ctx, linkTarget(target, header.Linkname), hops+1)
+		}
+		// we only want the top level files here, no recursion. the archive is rooted
+		// at the directory itself, so there should only be two parts.
+		if len(strings.Split(name, string(os.PathSeparator))) == 2 {
+			infos = append(infos, header.FileInfo())
 		}
 	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
 	return infos, nil
 }
 
+// maxSymlinks is the number of symlinks followed when reading a file, as on Linux.
+const maxSymlinks = 40
+
+// symlinkLoopError reports a file which is still a symlink after maxSymlinks were
+// followed, most likely as they form a loop.
+func symlinkLoopError(target string) error {
+	return fmt.Errorf("Cannot read specified path: %s: too many levels of symbolic links", target)
+}
+
+// linkTarget returns the path a symlink points to, resolving relative targets
+// against the directory of the symlink.
+func linkTarget(link string, target string) string {
+	if path.IsAbs(target) {
+		return target
+	}
+	return path.Join(path.Dir(link), target)
+}
+
 // This method takes a command (in the form of a list of args), and does the following:
 // 1) creates a container, based on the "current latest" image, with the command set as
 // the command to run when the container starts
 // 2) starts the container
 // 3) commits the container with its changes to a new image,
 // and sets that image as the new "current image"
-func (d *DockerDriver) runAndCommit(env []string, command []string) (string, error) {
+func (d *DockerDriver) runAndCommit(ctx context.Context, env []string, command []string) (string, error) {
 	createOpts := docker.CreateContainerOptions{
+		Context:  ctx,
 		Platform: d.platform,
 		Config: &docker.Config{
 			Image:        d.currentImage,
@@ -338,106 +451,115 @@ func (d *DockerDriver) runAndCommit(env []string, command []string) (string, err
 	if d.runOpts.IsSet() && len(d.runOpts.User) > 0 {
 		createOpts.Config.User = d.runOpts.User
 	}
-	container, err := d.cli.CreateContainer(createOpts)
+	container, err := d.createContainer(createOpts)
 	if err != nil {
 		return "", errors.Wrap(err, "Error creating container")
 	}
+	defer d.removeContainer(container.ID)
 
-	if err = d.cli.StartContainer(container.ID, nil); err != nil {
+	if err = d.cli.StartContainerWithContext(container.ID, nil, ctx); err != nil {
 		return "", errors.Wrap(err, "Error creating container")
 	}
 
-	if _, err = d.cli.WaitContainer(container.ID); err != nil {
+	if _, err = d.cli.WaitContainerWithContext(container.ID, ctx); err != nil {
 		return "", errors.Wrap(err, "Error when waiting for container")
 	}
 
-	image, err := d.cli.CommitContainer(docker.CommitContainerOptions{
-		Container: container.ID,
-	})
-
+	image, err := d.commitContainer(ctx, container.ID)
 	if err != nil {
 		return "", errors.Wrap(err, "Error committing container")
 	}
 
-	if !d.save {
-		if err = d.cli.RemoveContainer(docker.RemoveContainerOptions{
-			ID: container.ID,
-		}); err != nil {
-			logrus.Warnf("Error when removing container %s: %s", container.ID, err.Error())
-		}
-	}
-
 	d.currentImage = image.ID
 	return image.ID, nil
 }
 
-func (d *DockerDriver) exec(env []string, command []string) (string, string, int, error) {
-	createOpts := docker.CreateContainerOptions{
-		Platform: d.platform,
-		Config: &docker.Config{
-			Image:        d.currentImage,
-			Env:          env,
-			Cmd:          command,
-			Entrypoint:   []string{""},
-			AttachStdout: true,
-			AttachStderr: true,
-		},
-		HostConfig:       d.hostConfig(),
-		NetworkingConfig: nil,
+// execConfig returns the config of the container a command is run in. The env vars
+// of the run options are added to the ones of the test.
+func (d *DockerDriver) execConfig(env []string, command []string, opts ExecOptions) *docker.Config {
+	config := &docker.Config{
+		Image:        d.currentImage,
+		Env:          env,
+		Cmd:          command,
+		Entrypoint:   []string{""},
+		AttachStdout: true,
+		AttachStderr: true,
 	}
 	if d.runOpts.IsSet() {
-		createOpts.Config.Tty = d.runOpts.TTY
+		config.Tty = d.runOpts.TTY
 		if len(d.runOpts.User) > 0 {
-			createOpts.Config.User = d.runOpts.User
-		}
-		var envVars []string
-		if d.runOpts.EnvFile != "" {
-			varMap, err := godotenv.Read(d.runOpts.EnvFile)
-			if err != nil {
-				logrus.Warnf("Unable to load envFile %s: %s", d.runOpts.EnvFile, err.Error())
-			} else {
-				var varsFromFile []string
-				for k, v := range varMap {
-					if k != "" && v != "" {
-						varsFromFile = append(varsFromFile, fmt.Sprintf("%s=%s", k, v))
-					}
-				}
-				envVars = append(envVars, varsFromFile...)
-			}
+			config.User = d.runOpts.User
 		}
-		if d.runOpts.EnvVars != nil && len(d.runOpts.EnvVars) > 0 {
-			varsFromEnv := make([]string, len(d.runOpts.EnvVars))
-			for i, e := range d.runOpts.EnvVars {
-				v := os.Getenv(e)
-				if v != "" {
-					varsFromEnv[i] = fmt.Sprintf("%s=%s", e, v)
-				}
-			}
-			envVars = append(envVars, varsFromEnv...)
-		}
-		createOpts.Config.Env = envVars
+		config.Env = append(env, d.runOptsEnv()...)
+	}
+	if opts.User != "" {
+		config.User = opts.User
+	}
+	if opts.WorkingDir != "" {
+		config.WorkingDir = opts.WorkingDir
+	}
+	if opts.UseEntrypoint {
+		// leaving the entrypoint unset runs the command through the one of the image
+		config.Entrypoint = nil
+	}
+	if opts.Stdin != nil {
+		config.AttachStdin = true
+		config.OpenStdin = true
+		config.StdinOnce = true
+	}
+	return config
+}
+
+func (d *DockerDriver) exec(ctx context.Context, env []string, command []string, opts ExecOptions) (string, string, int, error) {
+	createOpts := docker.CreateContainerOptions{
+		Context:          ctx,
+		Platform:         d.platform,
+		Config:           d.execConfig(env, command, opts),
+		HostConfig:       d.hostConfig(),
+		NetworkingConfig: nil,
 	}
 	// first, start container from the current image
-	container, err := d.cli.CreateContainer(createOpts)
+	container, err := d.createContainer(createOpts)
 	if err != nil {
 		return "", "", -1, errors.Wrap(err, "Error creating container")
 	}
-	defer d.removeContainer(container.ID)
+	defer d.release(container.ID)
+
+	if len(opts.Files) > 0 {
+		if err = d.uploadFiles(ctx, container.ID, opts.WorkingDir, opts.Files); err != nil {
+			return "", "", -1, err
+		}
+	}
+
+	if opts.Stdin != nil {
+		// stdin is closed once the input is written, since the container was created with StdinOnce
+		waiter, err := d.cli.AttachToContainerNonBlocking(docker.AttachToContainerOptions{
+			Container:   container.ID,
+			InputStream: bytes.NewReader(opts.Stdin),
+			Stdin:       true,
+			Stream:      true,
+		})
+		if err != nil {
+			return "", "", -1, errors.Wrap(err, "Error attaching stdin to container")
+		}
+		defer waiter.Close()
+	}
 
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
-	if err = d.cli.StartContainer(container.ID, nil); err != nil {
+	if err = d.cli.StartContainerWithContext(container.ID, nil, ctx); err != nil {
 		return "", "", -1, errors.Wrap(err, "Error creating container")
 	}
 
 	//TODO(nkubala): look into adding timeout
-	exitCode, err := d.cli.WaitContainer(container.ID)
+	exitCode, err := d.cli.WaitContainerWithContext(container.ID, ctx)
 	if err != nil {
 		return "", "", -1, errors.Wrap(err, "Error when waiting for container")
 	}
 
 	if err = d.cli.Logs(docker.LogsOptions{
+		Context:      ctx,
 		Container:    container.ID,
 		OutputStream: stdout,
 		ErrorStream:  stderr,
@@ -450,7 +572,85 @@ func (d *DockerDriver) exec(env []string, command []string) (string, string, int
 	return stdout.String(), stderr.String(), exitCode, nil
 }
 
-func (d *DockerDriver) GetConfig() (unversioned.Config, error) {
+// runOptsEnv returns the env vars passed to containers by the run options, read
+// from the env file and from the environment of the host.
+func (d *DockerDriver) runOptsEnv() []string {
+	var envVars []string
+	if d.runOpts.EnvFile != "" {
+		varMap, err := godotenv.Read(d.runOpts.EnvFile)
+		if err != nil {
+			logrus.Warnf("Unable to load envFile %s: %s", d.runOpts.EnvFile, err.Error())
+		} else {
+			var varsFromFile []string
+			for k, v := range varMap {
+				if k != "" && v != "" {
+					varsFromFile = append(varsFromFile, fmt.Sprintf("%s=%s", k, v))
+				}
+			}
+			envVars = append(envVars, varsFromFile...)
+		}
+	}
+	if d.runOpts.EnvVars != nil && len(d.runOpts.EnvVars) > 0 {
+		varsFromEnv := make([]string, len(d.runOpts.EnvVars))
+		for i, e := range d.runOpts.EnvVars {
+			v := os.Getenv(e)
+			if v != "" {
+				varsFromEnv[i] = fmt.Sprintf("%s=%s", e, v)
+			}
+		}
+		envVars = append(envVars, varsFromEnv...)
+	}
+	return envVars
+}
+
+// uploadFiles copies fixture files into a created container, before it is started.
+// Relative targets are resolved against the working directory of the command,
+// which defaults to the one of the image.
+func (d *DockerDriver) uploadFiles(ctx context.Context, containerID string, workdir string, files []File) error {
+	if workdir == "" {
+		img, err := d.cli.InspectImage(d.currentImage)
+		if err != nil {
+			return errors.Wrap(err, "Error when inspecting image")
+		}
+		workdir = "/"
+		if img.Config != nil && img.Config.WorkingDir != "" {
+			workdir = img.Config.WorkingDir
+		}
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		target := f.Target
+		if !path.IsAbs(target) {
+			target = path.Join(workdir, target)
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     strings.TrimPrefix(path.Clean(target), "/"),
+			Mode:     int64(f.Mode.Perm()),
+			Size:     int64(len(f.Contents)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return errors.Wrapf(err, "Error adding file %s to archive", f.Target)
+		}
+		if _, err := tw.Write(f.Contents); err != nil {
+			return errors.Wrapf(err, "Error adding file %s to archive", f.Target)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "Error closing archive")
+	}
+	if err := d.cli.UploadToContainer(containerID, docker.UploadToContainerOptions{
+		Context:     ctx,
+		InputStream: &buf,
+		Path:        "/",
+	}); err != nil {
+		return errors.Wrap(err, "Error copying files to container")
+	}
+	return nil
+}
+
+func (d *DockerDriver) GetConfig(_ context.Context) (unversioned.Config, error) {
 	img, err := d.cli.InspectImage(d.currentImage)
 	if err != nil {
 		return unversioned.Config{}, errors.Wrap(err, "Error when inspecting image")
@@ -475,17 +675,68 @@ func (d *DockerDriver) GetConfig() (unversioned.Config, error) {
 		Volumes:      volumes,
 		Workdir:      img.Config.WorkingDir,
 		ExposedPorts: ports,
-		Labels:       img.Config.Labels,
+		Labels:       d.imageLabels(img.Config.Labels),
 		User:         img.Config.User,
+		Architecture: img.Architecture,
+		OS:           img.OS,
 	}, nil
 }
 
+// createContainer creates a container labelled with the labels of the driver.
+func (d *DockerDriver) createContainer(opts docker.CreateContainerOptions) (*docker.Container, error) {
+	opts.Config.Labels = d.labels
+	container, err := d.cli.CreateContainer(opts)
+	if err != nil {
+		return nil, err
+	}
+	d.containers = append(d.containers, container.ID)
+	return container, nil
+}
+
+// commitContainer commits a container to an image labelled with the labels of the
+// driver. The rest of the config of the image is taken from the container.
+func (d *DockerDriver) commitContainer(ctx context.Context, containerID string) (*docker.Image, error) {
+	image, err := d.cli.CommitContainer(docker.CommitContainerOptions{
+		Context:   ctx,
+		Container: containerID,
+		Run:       &docker.Config{Labels: d.labels},
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.images = append(d.images, image.ID)
+	return image, nil
+}
+
+// imageLabels returns the labels of the current image, without the ones the driver
+// adds to the images it commits.
+func (d *DockerDriver) imageLabels(labels map[string]string) map[string]string {
+	if d.currentImage == d.originalImage {
+		return labels
+	}
+	filtered := map[string]string{}
+	for k, v := range labels {
+		if _, ok := d.labels[k]; !ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// Resources returns the IDs of the containers and images created by the driver.
+func (d *DockerDriver) Resources() ([]string, []string) {
+	return append([]string{}, d.containers...), append([]string{}, d.images...)
+}
+
+// removeContainer removes a container, unless containers are saved. Containers are
+// killed first, as they are left running when a test is cancelled.
 func (d *DockerDriver) removeContainer(containerID string) {
 	if d.save {
 		return
 	}
 	if err := d.cli.RemoveContainer(docker.RemoveContainerOptions{
-		ID: containerID,
+		ID:    containerID,
+		Force: true,
 	}); err != nil {
 		logrus.Warnf("Error when removing container %s: %s", containerID, err.Error())
 	}
@@ -0,0 +1,147 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// keepAliveCommand keeps the container of a test running in single container
+// mode, while its commands are run through the exec API. Docker cannot keep a
+// container running without a process, so the image has to provide it.
+var keepAliveCommand = []string{"sleep", "2147483647"}
+
+// keepAliveHint explains why single container mode failed to start the container
+// of a test, since the errors of docker do not say.
+var keepAliveHint = fmt.Sprintf("single container mode keeps the container running with '%s', which the image must provide; "+
+	"test images without it, such as distroless or scratch images, without --single-container", strings.Join(keepAliveCommand, " "))
+
+// startTestContainer starts the container which the commands of a test are run
+// in, in single container mode, unless it is already running.
+func (d *DockerDriver) startTestContainer(ctx context.Context) error {
+	if d.containerID != "" {
+		return nil
+	}
+	container, err := d.createContainer(docker.CreateContainerOptions{
+		Context:  ctx,
+		Platform: d.platform,
+		Config: &docker.Config{
+			Image:      d.currentImage,
+			Env:        d.runOptsEnv(),
+			Cmd:        keepAliveCommand,
+			Entrypoint: []string{""},
+			User:       d.runOpts.User,
+		},
+		HostConfig: d.hostConfig(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error creating container")
+	}
+	d.containerID = container.ID
+	if err = d.cli.StartContainerWithContext(container.ID, nil, ctx); err != nil {
+		return errors.Wrapf(err, "Error starting container (%s)", keepAliveHint)
+	}
+	// the command may also exist, but not keep running
+	inspected, err := d.cli.InspectContainerWithOptions(docker.InspectContainerOptions{Context: ctx, ID: container.ID})
+	if err != nil {
+		return errors.Wrap(err, "Error inspecting container")
+	}
+	if !inspected.State.Running {
+		return fmt.Errorf("Container exited with code %d right after it started (%s)", inspected.State.ExitCode, keepAliveHint)
+	}
+	return nil
+}
+
+// execAll runs setup or teardown commands in the container of the test. As with
+// the other drivers, their exit codes are not checked.
+func (d *DockerDriver) execAll(ctx context.Context, step string, fullCommands [][]string) error {
+	for _, cmd := range fullCommands {
+		// the env vars of the test are always passed along
+		stdout, stderr, exitCode, err := d.execInTestContainer(ctx, nil, cmd, ExecOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "Error running %s command %v", step, cmd)
+		}
+		if exitCode != 0 {
+			logrus.Warnf("%s command %v exited with code %d\nstdout: %s\nstderr: %s", step, cmd, exitCode, stdout, stderr)
+		}
+	}
+	return nil
+}
+
+func (d *DockerDriver) execInTestContainer(ctx context.Context, env []string, fullCommand []string, opts ExecOptions) (string, string, int, error) {
+	if err := d.startTestContainer(ctx); err != nil {
+		return "", "", -1, err
+	}
+	if opts.UseEntrypoint {
+		config, err := d.GetConfig(ctx)
+		if err != nil {
+			return "", "", -1, err
+		}
+		fullCommand = append(append([]string{}, config.Entrypoint...), fullCommand...)
+	}
+	return d.execIn(ctx, d.containerID, append(append([]string{}, d.execEnv...), env...), fullCommand, opts)
+}
+
+// execIn runs a command in a running container through the exec API.
+func (d *DockerDriver) execIn(ctx context.Context, containerID string, env []string, fullCommand []string, opts ExecOptions) (string, string, int, error) {
+	if len(opts.Files) > 0 {
+		if err := d.uploadFiles(ctx, containerID, opts.WorkingDir, opts.Files); err != nil {
+			return "", "", -1, err
+		}
+	}
+	exec, err := d.cli.CreateExec(docker.CreateExecOptions{
+		Context:      ctx,
+		Container:    containerID,
+		Cmd:          fullCommand,
+		Env:          env,
+		User:         opts.User,
+		WorkingDir:   opts.WorkingDir,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          d.runOpts.TTY,
+	})
+	if err != nil {
+		return "", "", -1, errors.Wrap(err, "Error creating exec")
+	}
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	startOpts := docker.StartExecOptions{
+		Context:      ctx,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Tty:          d.runOpts.TTY,
+	}
+	if opts.Stdin != nil {
+		// stdin is closed once the input is written
+		startOpts.InputStream = bytes.NewReader(opts.Stdin)
+	}
+	if err = d.cli.StartExec(exec.ID, startOpts); err != nil {
+		return "", "", -1, errors.Wrap(err, "Error starting exec")
+	}
+	inspect, err := d.cli.InspectExec(exec.ID)
+	if err != nil {
+		return "", "", -1, errors.Wrap(err, "Error inspecting exec")
+	}
+	return stdout.String(), stderr.String(), inspect.ExitCode, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// execState is the state of the containers a fakeDaemon runs commands in. The
+// output of a command is the command itself, and only false exits with a non-zero
+// code.
+type execState struct {
+	missing  string                    // binary the image lacks, which containers fail to start with
+	exits    bool                      // whether containers exit right after they start
+	configs  map[string]*docker.Config // created containers, by ID
+	running  map[string]bool
+	execs    map[string]*fakeExec
+	commands []*fakeExec // run through the exec API, in order
+}
+
+type fakeExec struct {
+	container string
+	cmd       []string
+	env       []string
+	exitCode  int
+}
+
+// serveExec serves the parts of the docker API used by single container mode, and
+// reports whether the request was one of them.
+func (f *fakeDaemon) serveExec(w http.ResponseWriter, r *http.Request, path string) bool {
+	state := &f.exec
+	if state.configs == nil {
+		state.configs = map[string]*docker.Config{}
+		state.running = map[string]bool{}
+		state.execs = map[string]*fakeExec{}
+	}
+	// the ID follows the kind of resource in the path
+	id := func(kind string) string {
+		parts := strings.Split(path, "/")
+		for i, part := range parts[:len(parts)-1] {
+			if part == kind {
+				return parts[i+1]
+			}
+		}
+		return ""
+	}
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/version"):
+		// the client checks the version of the daemon before passing env vars to exec
+		json.NewEncoder(w).Encode(map[string]string{"ApiVersion": "1.41"})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/containers/create"):
+		var config docker.Config
+		json.NewDecoder(r.Body).Decode(&config)
+		containerID := fmt.Sprintf("container%d", len(state.configs)+1)
+		state.configs[containerID] = &config
+		f.containers = append(f.containers, docker.APIContainers{ID: containerID, Labels: config.Labels})
+		json.NewEncoder(w).Encode(docker.Container{ID: containerID})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/start") && strings.Contains(path, "/containers/"):
+		containerID := id("containers")
+		if cmd := state.configs[containerID].Cmd; state.missing != "" && cmd[0] == state.missing {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": fmt.Sprintf(`exec: "%s": executable file not found in $PATH`, state.missing),
+			})
+			return true
+		}
+		state.running[containerID] = !state.exits
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/json") && strings.Contains(path, "/containers/"):
+		containerID := id("containers")
+		json.NewEncoder(w).Encode(docker.Container{ID: containerID, State: docker.State{Running: state.running[containerID]}})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/exec"):
+		containerID := id("containers")
+		if !state.running[containerID] {
+			w.WriteHeader(http.StatusConflict)
+			return true
+		}
+		var opts docker.CreateExecOptions
+		json.NewDecoder(r.Body).Decode(&opts)
+		exec := &fakeExec{container: containerID, cmd: opts.Cmd, env: opts.Env}
+		if opts.Cmd[0] == "false" {
+			exec.exitCode = 1
+		}
+		execID := fmt.Sprintf("exec%d", len(state.execs)+1)
+		state.execs[execID] = exec
+		state.commands = append(state.commands, exec)
+		json.NewEncoder(w).Encode(docker.Exec{ID: execID})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/start") && strings.Contains(path, "/exec/"):
+		// the output is streamed over the hijacked connection, as stdout frames
+		output := strings.Join(state.execs[id("exec")].cmd, " ")
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return true
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		header := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[4:], uint32(len(output)))
+		buf.Write(header)
+		buf.WriteString(output)
+		buf.Flush()
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/json") && strings.Contains(path, "/exec/"):
+		json.NewEncoder(w).Encode(docker.ExecInspect{ID: id("exec"), ExitCode: state.execs[id("exec")].exitCode})
+	default:
+		return false
+	}
+	return true
+}
+
+// newSingleContainerDriver returns a docker driver in single container mode, which
+// runs commands through the given daemon.
+func newSingleContainerDriver(t *testing.T, daemon *fakeDaemon) *DockerDriver {
+	t.Helper()
+	server := httptest.NewServer(daemon)
+	t.Cleanup(server.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+	t.Setenv("DOCKER_API_VERSION", "")
+	driver, err := NewDockerDriver(DriverConfig{Image: "image", SingleContainer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver.(*DockerDriver)
+}
+
+func TestSingleContainer(t *testing.T) {
+	daemon := &fakeDaemon{}
+	driver := newSingleContainerDriver(t, daemon)
+	ctx := context.Background()
+
+	if err := driver.SetEnv(ctx, []unversioned.EnvVar{{Key: "GLOBAL", Value: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Setup(ctx, []unversioned.EnvVar{{Key: "SETUP", Value: "1"}}, [][]string{{"touch", "/tmp/ready"}}); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, exitCode, err := driver.ProcessCommand(ctx, []unversioned.EnvVar{{Key: "TEST", Value: "1"}}, []string{"cat", "/tmp/ready"}, ExecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "cat /tmp/ready", stdout)
+	testutil.CheckDeepEqual(t, 0, exitCode)
+	if _, _, exitCode, err = driver.ProcessCommand(ctx, nil, []string{"false"}, ExecOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, 1, exitCode)
+	if err := driver.Teardown(ctx, [][]string{{"rm", "/tmp/ready"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every command runs in the one container, kept running without the entrypoint
+	testutil.CheckDeepEqual(t, 1, len(daemon.exec.configs))
+	config := daemon.exec.configs["container1"]
+	testutil.CheckDeepEqual(t, keepAliveCommand, config.Cmd)
+	testutil.CheckDeepEqual(t, []string{""}, config.Entrypoint)
+	var commands []string
+	for _, exec := range daemon.exec.commands {
+		testutil.CheckDeepEqual(t, "container1", exec.container)
+		commands = append(commands, strings.Join(exec.cmd, " "))
+	}
+	testutil.CheckDeepEqual(t, []string{"touch /tmp/ready", "cat /tmp/ready", "false", "rm /tmp/ready"}, commands)
+	// the env of the setup stays for the rest of the test
+	testutil.CheckDeepEqual(t, []string{"GLOBAL=1", "SETUP=1"}, daemon.exec.commands[0].env)
+	testutil.CheckDeepEqual(t, []string{"GLOBAL=1", "SETUP=1", "TEST=1"}, daemon.exec.commands[1].env)
+
+	// the container is still running, so it is removed by force
+	driver.Destroy()
+	testutil.CheckDeepEqual(t, 0, len(daemon.containers))
+}
+
+func TestSingleContainerNotKeptRunning(t *testing.T) {
+	tests := []struct {
+		name     string
+		daemon   *fakeDaemon
+		expected string
+	}{
+		{
+			name:     "no sleep in the image",
+			daemon:   &fakeDaemon{exec: execState{missing: "sleep"}},
+			expected: "executable file not found",
+		},
+		{
+			name:     "exits at once",
+			daemon:   &fakeDaemon{exec: execState{exits: true}},
+			expected: "Container exited with code 0 right after it started",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driver := newSingleContainerDriver(t, test.daemon)
+			_, _, exitCode, err := driver.ProcessCommand(context.Background(), nil, []string{"true"}, ExecOptions{})
+			if err == nil {
+				t.Fatal("expected the command to fail")
+			}
+			for _, expected := range []string{test.expected, "without --single-container"} {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected %q in the error, got %s", expected, err)
+				}
+			}
+			testutil.CheckDeepEqual(t, -1, exitCode)
+			testutil.CheckDeepEqual(t, 0, len(test.daemon.exec.commands))
+			driver.Destroy()
+			testutil.CheckDeepEqual(t, 0, len(test.daemon.containers))
+		})
+	}
+}
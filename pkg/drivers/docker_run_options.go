@@ -0,0 +1,185 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// ValidateRunOptions checks that the run options can be passed to the docker
+// driver, so that mistakes are reported before any tests are run.
+func ValidateRunOptions(opts unversioned.ContainerRunOptions) error {
+	_, err := newHostConfig("", opts)
+	return err
+}
+
+// newHostConfig returns the host config of the containers of the docker driver, or
+// nil if neither a runtime nor run options are set.
+func newHostConfig(runtime string, opts unversioned.ContainerRunOptions) (*docker.HostConfig, error) {
+	if !opts.IsSet() {
+		if runtime == "" {
+			return nil, nil
+		}
+		return &docker.HostConfig{Runtime: runtime}, nil
+	}
+	hostConfig := &docker.HostConfig{
+		Runtime:        runtime,
+		Capabilities:   opts.Capabilities,
+		Binds:          opts.BindMounts,
+		Privileged:     opts.Privileged,
+		NetworkMode:    opts.NetworkMode,
+		ExtraHosts:     opts.ExtraHosts,
+		ReadonlyRootfs: opts.ReadOnlyRootfs,
+		CapDrop:        opts.CapDrop,
+		SecurityOpt:    opts.SecurityOpt,
+		Sysctls:        opts.Sysctls,
+	}
+	var err error
+	if opts.Memory != "" {
+		if hostConfig.Memory, err = units.RAMInBytes(opts.Memory); err != nil {
+			return nil, errors.Wrap(err, "invalid memory")
+		}
+	}
+	if opts.ShmSize != "" {
+		if hostConfig.ShmSize, err = units.RAMInBytes(opts.ShmSize); err != nil {
+			return nil, errors.Wrap(err, "invalid shmSize")
+		}
+	}
+	if opts.CPUs != "" {
+		cpus, err := strconv.ParseFloat(opts.CPUs, 64)
+		if err != nil || cpus <= 0 {
+			return nil, errors.Errorf("invalid cpus %s, expected a positive number", opts.CPUs)
+		}
+		hostConfig.NanoCPUs = int64(cpus * 1e9)
+	}
+	if opts.PidsLimit != 0 {
+		limit := opts.PidsLimit
+		hostConfig.PidsLimit = &limit
+	}
+	for _, u := range opts.Ulimits {
+		ulimit, err := units.ParseUlimit(u)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ulimit")
+		}
+		hostConfig.Ulimits = append(hostConfig.Ulimits, docker.ULimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+	for _, h := range opts.ExtraHosts {
+		host, ip, ok := strings.Cut(h, ":")
+		if !ok || host == "" || (net.ParseIP(ip) == nil && ip != "host-gateway") {
+			return nil, errors.Errorf("invalid extra host %s, expected host:ip", h)
+		}
+	}
+	for _, t := range opts.Tmpfs {
+		path, options, _ := strings.Cut(t, ":")
+		if !strings.HasPrefix(path, "/") {
+			return nil, errors.Errorf("invalid tmpfs %s, expected an absolute path", t)
+		}
+		if hostConfig.Tmpfs == nil {
+			hostConfig.Tmpfs = map[string]string{}
+		}
+		hostConfig.Tmpfs[path] = options
+	}
+	for _, d := range opts.Devices {
+		device, err := parseDevice(d)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig.Devices = append(hostConfig.Devices, device)
+	}
+	return hostConfig, nil
+}
+
+// parseDevice parses a device as passed to docker run --device, i.e.
+// host[:container[:permissions]].
+func parseDevice(d string) (docker.Device, error) {
+	parts := strings.Split(d, ":")
+	device := docker.Device{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[0],
+		CgroupPermissions: "rwm",
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		device.PathInContainer = parts[1]
+	}
+	if len(parts) > 2 {
+		device.CgroupPermissions = parts[2]
+	}
+	if len(parts) > 3 || !strings.HasPrefix(device.PathOnHost, "/") || !strings.HasPrefix(device.PathInContainer, "/") ||
+		device.CgroupPermissions == "" || strings.Trim(device.CgroupPermissions, "rwm") != "" {
+		return docker.Device{}, errors.Errorf("invalid device %s, expected host[:container[:permissions]]", d)
+	}
+	return device, nil
+}
+
+// dockerRunFlags returns the docker run flags which create a container with the
+// runtime, platform and run options of the containers of the docker driver.
+func dockerRunFlags(runtime string, platform string, opts unversioned.ContainerRunOptions) []string {
+	var flags []string
+	add := func(flag string, values ...string) {
+		for _, v := range values {
+			if v != "" {
+				flags = append(flags, flag, v)
+			}
+		}
+	}
+	add("--runtime", runtime)
+	add("--platform", platform)
+	if opts.Privileged {
+		flags = append(flags, "--privileged")
+	}
+	add("--cap-add", opts.Capabilities...)
+	add("--cap-drop", opts.CapDrop...)
+	add("-v", opts.BindMounts...)
+	add("--memory", opts.Memory)
+	add("--cpus", opts.CPUs)
+	if opts.PidsLimit != 0 {
+		add("--pids-limit", strconv.FormatInt(opts.PidsLimit, 10))
+	}
+	add("--shm-size", opts.ShmSize)
+	add("--ulimit", opts.Ulimits...)
+	add("--network", opts.NetworkMode)
+	add("--add-host", opts.ExtraHosts...)
+	if opts.ReadOnlyRootfs {
+		flags = append(flags, "--read-only")
+	}
+	add("--tmpfs", opts.Tmpfs...)
+	add("--security-opt", opts.SecurityOpt...)
+	add("--device", opts.Devices...)
+	var sysctls []string
+	for k, v := range opts.Sysctls {
+		sysctls = append(sysctls, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(sysctls)
+	add("--sysctl", sysctls...)
+	add("--env-file", opts.EnvFile)
+	// like the driver, docker reads the values of these from the environment
+	add("-e", opts.EnvVars...)
+	return flags
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestNewHostConfig(t *testing.T) {
+	pids := int64(100)
+	global := unversioned.ContainerRunOptions{
+		Memory:         "512m",
+		CPUs:           "1.5",
+		PidsLimit:      100,
+		ShmSize:        "64m",
+		Ulimits:        []string{"nofile=1024:2048"},
+		NetworkMode:    "none",
+		ExtraHosts:     []string{"db:10.0.0.2"},
+		ReadOnlyRootfs: true,
+		Tmpfs:          []string{"/tmp:rw,size=64m", "/run"},
+		CapDrop:        []string{"ALL"},
+		SecurityOpt:    []string{"no-new-privileges"},
+		Devices:        []string{"/dev/fuse", "/dev/sda:/dev/xvda:r"},
+		Sysctls:        map[string]string{"net.ipv4.ip_forward": "0"},
+	}
+	hostConfig, err := newHostConfig("runsc", global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, &docker.HostConfig{
+		Runtime:        "runsc",
+		Memory:         512 * 1024 * 1024,
+		NanoCPUs:       1500000000,
+		PidsLimit:      &pids,
+		ShmSize:        64 * 1024 * 1024,
+		Ulimits:        []docker.ULimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+		NetworkMode:    "none",
+		ExtraHosts:     []string{"db:10.0.0.2"},
+		ReadonlyRootfs: true,
+		Tmpfs:          map[string]string{"/tmp": "rw,size=64m", "/run": ""},
+		CapDrop:        []string{"ALL"},
+		SecurityOpt:    []string{"no-new-privileges"},
+		Devices: []docker.Device{
+			{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"},
+			{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "r"},
+		},
+		Sysctls: map[string]string{"net.ipv4.ip_forward": "0"},
+	}, hostConfig)
+
+	// a test overrides the options it sets
+	overridden := global.Override(&unversioned.ContainerRunOptions{Memory: "1g", NetworkMode: "bridge"})
+	testutil.CheckDeepEqual(t, "1g", overridden.Memory)
+	testutil.CheckDeepEqual(t, "bridge", overridden.NetworkMode)
+	testutil.CheckDeepEqual(t, global.CPUs, overridden.CPUs)
+
+	hostConfig, err = newHostConfig("", unversioned.ContainerRunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostConfig != nil {
+		t.Errorf("expected no host config without a runtime or run options, got %+v", hostConfig)
+	}
+
+	for _, invalid := range []unversioned.ContainerRunOptions{
+		{Memory: "lots"},
+		{CPUs: "-1"},
+		{Ulimits: []string{"nofile"}},
+		{ExtraHosts: []string{"db"}},
+		{Tmpfs: []string{"tmp"}},
+		{Devices: []string{"/dev/fuse:/dev/fuse:x"}},
+	} {
+		if err := ValidateRunOptions(invalid); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
+
+func TestExecConfigEnv(t *testing.T) {
+	t.Setenv("HOST_VAR", "host")
+	tests := []struct {
+		name     string
+		runOpts  unversioned.ContainerRunOptions
+		expected []string
+	}{
+		{
+			name:     "no run options",
+			expected: []string{"FOO=bar"},
+		},
+		{
+			// a test overriding only its memory keeps its own env vars
+			name:     "memory",
+			runOpts:  unversioned.ContainerRunOptions{Memory: "512m"},
+			expected: []string{"FOO=bar"},
+		},
+		{
+			name:     "env vars",
+			runOpts:  unversioned.ContainerRunOptions{EnvVars: []string{"HOST_VAR"}},
+			expected: []string{"FOO=bar", "HOST_VAR=host"},
+		},
+		{
+			// the hardened run options of compatibility mode
+			name: "compatibility",
+			runOpts: unversioned.ContainerRunOptions{
+				User:           "1000000000:0",
+				ReadOnlyRootfs: true,
+				CapDrop:        []string{"ALL"},
+				NetworkMode:    "none",
+			},
+			expected: []string{"FOO=bar"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &DockerDriver{currentImage: "image", runOpts: test.runOpts}
+			config := d.execConfig([]string{"FOO=bar"}, []string{"env"}, ExecOptions{})
+			testutil.CheckDeepEqual(t, test.expected, config.Env)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// dockerService is a container started from the current image of a docker driver.
+type dockerService struct {
+	driver      *DockerDriver
+	containerID string
+	host        string // where the published ports are reached
+}
+
+// StartService starts a container with the entrypoint and command of the image,
+// publishing the ports on random ports of the daemon host (see serviceHost).
+func (d *DockerDriver) StartService(ctx context.Context, envVars []unversioned.EnvVar, ports []string) (Service, error) {
+	bindIP, host := serviceHost(d.cli.Endpoint())
+	hostConfig := d.hostConfig()
+	if hostConfig == nil {
+		hostConfig = &docker.HostConfig{}
+	}
+	exposedPorts := map[docker.Port]struct{}{}
+	hostConfig.PortBindings = map[docker.Port][]docker.PortBinding{}
+	for _, p := range ports {
+		port := docker.Port(p + "/tcp")
+		exposedPorts[port] = struct{}{}
+		hostConfig.PortBindings[port] = []docker.PortBinding{{HostIP: bindIP}}
+	}
+	createOpts := docker.CreateContainerOptions{
+		Context:  ctx,
+		Platform: d.platform,
+		Config: &docker.Config{
+			Image:        d.currentImage,
+			Env:          append(d.runOptsEnv(), d.processEnvVars(envVars)...),
+			ExposedPorts: exposedPorts,
+			Tty:          d.runOpts.TTY,
+			User:         d.runOpts.User,
+		},
+		HostConfig: hostConfig,
+	}
+	container, err := d.createContainer(createOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating container")
+	}
+	s := &dockerService{driver: d, containerID: container.ID, host: host}
+	if err = d.cli.StartContainerWithContext(container.ID, nil, ctx); err != nil {
+		s.Remove()
+		return nil, errors.Wrap(err, "Error starting container")
+	}
+	return s, nil
+}
+
+func (s *dockerService) Logs() (string, string, error) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if err := s.driver.cli.Logs(docker.LogsOptions{
+		Container:    s.containerID,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Stdout:       true,
+		Stderr:       true,
+	}); err != nil {
+		return "", "", errors.Wrap(err, "Error retrieving container logs")
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+func (s *dockerService) Exec(ctx context.Context, fullCommand []string) (string, string, int, error) {
+	return s.driver.execIn(ctx, s.containerID, nil, fullCommand, ExecOptions{})
+}
+
+func (s *dockerService) Address(port string) (string, error) {
+	container, err := s.driver.cli.InspectContainerWithOptions(docker.InspectContainerOptions{ID: s.containerID})
+	if err != nil {
+		return "", errors.Wrap(err, "Error inspecting container")
+	}
+	bindings := container.NetworkSettings.Ports[docker.Port(port+"/tcp")]
+	if len(bindings) == 0 {
+		return "", fmt.Errorf("port %s is not published", port)
+	}
+	return net.JoinHostPort(s.host, bindings[0].HostPort), nil
+}
+
+// serviceHost returns the address the ports of services are published on, and the
+// host they are then reached at. A local daemon publishes them on its loopback
+// interface only. A remote daemon, such as a docker-in-docker sidecar in CI, is
+// reached through the host of DOCKER_HOST, which need not be one of its own
+// addresses, so the ports are published on all of its interfaces.
+func serviceHost(endpoint string) (string, string) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "tcp" && u.Scheme != "http" && u.Scheme != "https") {
+		return "127.0.0.1", "127.0.0.1"
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "127.0.0.1", "127.0.0.1"
+	}
+	return "", host
+}
+
+func (s *dockerService) State() (ServiceState, error) {
+	container, err := s.driver.cli.InspectContainerWithOptions(docker.InspectContainerOptions{ID: s.containerID})
+	if err != nil {
+		return ServiceState{}, errors.Wrap(err, "Error inspecting container")
+	}
+	return ServiceState{
+		Running:  container.State.Running,
+		ExitCode: container.State.ExitCode,
+		Health:   container.State.Health.Status,
+	}, nil
+}
+
+func (s *dockerService) Stop(timeout time.Duration) (int, error) {
+	// docker sends SIGKILL once the timeout, in whole seconds, has passed
+	seconds := uint(math.Ceil(timeout.Seconds()))
+	if err := s.driver.cli.StopContainer(s.containerID, seconds); err != nil {
+		var notRunning *docker.ContainerNotRunning
+		if !errors.As(err, &notRunning) {
+			return -1, errors.Wrap(err, "Error stopping container")
+		}
+	}
+	exitCode, err := s.driver.cli.WaitContainer(s.containerID)
+	if err != nil {
+		return -1, errors.Wrap(err, "Error when waiting for container")
+	}
+	return exitCode, nil
+}
+
+func (s *dockerService) Remove() {
+	s.driver.removeContainer(s.containerID)
+}
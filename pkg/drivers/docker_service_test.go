@@ -0,0 +1,45 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestServiceHost(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		bindIP   string
+		host     string
+	}{
+		{endpoint: "unix:///var/run/docker.sock", bindIP: "127.0.0.1", host: "127.0.0.1"},
+		{endpoint: "npipe:////./pipe/docker_engine", bindIP: "127.0.0.1", host: "127.0.0.1"},
+		{endpoint: "tcp://localhost:2375", bindIP: "127.0.0.1", host: "127.0.0.1"},
+		{endpoint: "tcp://127.0.0.1:2375", bindIP: "127.0.0.1", host: "127.0.0.1"},
+		{endpoint: "tcp://[::1]:2375", bindIP: "127.0.0.1", host: "127.0.0.1"},
+		// a docker-in-docker sidecar
+		{endpoint: "tcp://docker:2376", bindIP: "", host: "docker"},
+		{endpoint: "https://10.0.0.5:2376", bindIP: "", host: "10.0.0.5"},
+	}
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			bindIP, host := serviceHost(test.endpoint)
+			testutil.CheckDeepEqual(t, test.bindIP, bindIP)
+			testutil.CheckDeepEqual(t, test.host, host)
+		})
+	}
+}
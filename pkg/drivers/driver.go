@@ -15,10 +15,13 @@
 package drivers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/GoogleContainerTools/container-structure-test/internal/pkgutil"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 )
 
@@ -29,39 +32,155 @@ const (
 )
 
 type DriverConfig struct {
-	Image    string                          // used by Docker/Tar drivers
-	Save     bool                            // used by Docker/Tar drivers
-	Metadata string                          // used by Host driver
-	Runtime  string                          // used by Docker driver
-	Platform string                          // used by Docker driver
-	RunOpts  unversioned.ContainerRunOptions // used by Docker driver
+	Driver        string                          // name of the driver, whose capabilities are then known without creating it
+	Image         string                          // used by Docker/Tar drivers
+	Save          bool                            // used by Docker/Tar drivers
+	Metadata      string                          // used by Host driver
+	Runtime       string                          // used by Docker driver
+	Platform      string                          // used by Docker driver
+	RunOpts       unversioned.ContainerRunOptions // used by Docker driver
+	BaselineImage string                          // used by diff tests
+
+	SingleContainer bool                // used by Docker driver
+	ImageCache      *pkgutil.ImageCache // used by Tar driver and its diff tests, shared by all tests of a run
+	Compatibility   bool                // used by command tests, which are re-run in compatibility mode
+
+	RunID    string // used by Docker driver to label the created resources, generated if empty
+	TestName string // used by Docker driver to label the created resources
+
+	DebugOnFailure bool // used by Docker driver, which keeps the containers of a failing test
+	Strict         bool // used by the runner, which fails the tests needing capabilities the driver lacks
 }
 
+// ExecOptions are the optional inputs of a command processed by a driver.
+type ExecOptions struct {
+	Stdin         []byte // data piped into the command
+	Files         []File // files placed in the environment before the command runs
+	User          string // user to run the command as, overriding the run options
+	WorkingDir    string // directory to run the command from
+	UseEntrypoint bool   // pass the command as arguments to the image entrypoint
+}
+
+// File is a fixture file placed in the environment of a command. Relative
+// target paths are resolved against the working directory of the command.
+type File struct {
+	Target   string
+	Mode     os.FileMode
+	Contents []byte
+}
+
+// Capability is a feature of a driver, which some tests need.
+type Capability string
+
+const (
+	CapCommands   Capability = "commands"   // runs commands in the image
+	CapSetup      Capability = "setup"      // runs setup commands before a test
+	CapTeardown   Capability = "teardown"   // runs teardown commands after a test
+	CapOwnership  Capability = "ownership"  // reports the uid and gid of files
+	CapMetadata   Capability = "metadata"   // reports the config of the image
+	CapXattrs     Capability = "xattrs"     // reports the extended attributes of files
+	CapServices   Capability = "services"   // runs the image as a service
+	CapRunOptions Capability = "runOptions" // applies container run options to the commands it runs
+)
+
+// Driver runs the tests against an image. Every method but Destroy takes a context,
+// which cancels the work in flight once done. Destroy must clean up everything the
+// driver created, even once the context of the run is cancelled.
 type Driver interface {
-	Setup(envVars []unversioned.EnvVar, fullCommands [][]string) error
+	Setup(ctx context.Context, envVars []unversioned.EnvVar, fullCommands [][]string) error
 
 	// Teardown is optional and is only used in the host driver
-	Teardown(fullCommands [][]string) error
+	Teardown(ctx context.Context, fullCommands [][]string) error
 
-	SetEnv(envVars []unversioned.EnvVar) error
+	SetEnv(ctx context.Context, envVars []unversioned.EnvVar) error
 
 	// given an array of command parts, construct a full command and execute it against the
 	// current environment. a list of environment variables can be passed to be set in the
 	// environment before the command is executed. additionally, a boolean flag is passed
-	// to specify whether or not we care about the output of the command.
-	ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error)
+	// to specify whether or not we care about the output of the command. the exec options
+	// provide the stdin of the command and the files to create before it is run.
+	ProcessCommand(ctx context.Context, envVars []unversioned.EnvVar, fullCommand []string, opts ExecOptions) (string, string, int, error)
+
+	StatFile(ctx context.Context, path string) (os.FileInfo, error)
 
-	StatFile(path string) (os.FileInfo, error)
+	ReadFile(ctx context.Context, path string) ([]byte, error)
 
-	ReadFile(path string) ([]byte, error)
+	ReadDir(ctx context.Context, path string) ([]os.FileInfo, error)
 
-	ReadDir(path string) ([]os.FileInfo, error)
+	GetConfig(ctx context.Context) (unversioned.Config, error)
 
-	GetConfig() (unversioned.Config, error)
+	// Capabilities returns the features the driver supports, so that the tests which
+	// need others can be skipped.
+	Capabilities() []Capability
 
 	Destroy()
 }
 
+// XattrDriver is implemented by drivers which stat files without a tar header, and
+// read their extended attributes from the filesystem instead. Other drivers report
+// extended attributes as SCHILY.xattr PAX records in the tar header of a file.
+type XattrDriver interface {
+	// Xattrs returns the extended attributes of a file, without following symlinks.
+	Xattrs(ctx context.Context, path string) (map[string]string, error)
+}
+
+// ResourceDriver is implemented by drivers which create containers and images,
+// so that the ones kept with --save can be listed in the report.
+type ResourceDriver interface {
+	// Resources returns the IDs of the containers and images created by the driver.
+	Resources() (containers []string, images []string)
+}
+
+// DebugDriver is implemented by drivers which can open a shell in the environment
+// of a test, as left by its setup commands.
+type DebugDriver interface {
+	// DebugCommand returns the command running an interactive shell in the
+	// environment, with the env vars and options of a command of the test.
+	DebugCommand(envVars []unversioned.EnvVar, opts ExecOptions, shell string) []string
+
+	// Keep makes Destroy leave the containers and images of the driver behind, so
+	// that the debug command can still be run. The debug command then opens the
+	// shell in the state left by the last command run, rather than by the setup.
+	Keep(ctx context.Context) error
+}
+
+// ServiceDriver is implemented by drivers which can run the image as a long-lived
+// service, started with its own entrypoint and command. Drivers which do not
+// implement it do not support service tests.
+type ServiceDriver interface {
+	// StartService starts the service with the given env vars, publishing the
+	// given ports so that they can be reached from the host.
+	StartService(ctx context.Context, envVars []unversioned.EnvVar, ports []string) (Service, error)
+}
+
+// Service is a running instance of the image.
+type Service interface {
+	// Logs returns the stdout and stderr of the service so far.
+	Logs() (string, string, error)
+
+	// Exec runs a command alongside the service, and returns its stdout, stderr and exit code.
+	Exec(ctx context.Context, fullCommand []string) (string, string, int, error)
+
+	// Address returns the host:port on which a port of the service can be reached.
+	Address(port string) (string, error)
+
+	State() (ServiceState, error)
+
+	// Stop stops the service gracefully, killing it once the timeout has passed,
+	// and returns its exit code.
+	Stop(timeout time.Duration) (int, error)
+
+	// Remove cleans up the service once it has stopped.
+	Remove()
+}
+
+// ServiceState is the state of a service.
+type ServiceState struct {
+	Running  bool
+	ExitCode int    // exit code of the service, once it has stopped
+	Health   string // status of the image healthcheck: starting, healthy or unhealthy, if it has one
+}
+
 func InitDriverImpl(driver string) func(DriverConfig) (Driver, error) {
 	switch driver {
 	// future drivers will be added here
@@ -76,6 +195,22 @@ func InitDriverImpl(driver string) func(DriverConfig) (Driver, error) {
 	}
 }
 
+// Capabilities returns the capabilities of the driver named in the config, as the
+// driver would report them once created. It returns false if the config does not
+// name a known driver.
+func (args DriverConfig) Capabilities() ([]Capability, bool) {
+	switch args.Driver {
+	case Docker:
+		return dockerCapabilities(args.SingleContainer), true
+	case Tar:
+		return tarCapabilities(), true
+	case Host:
+		return hostCapabilities(args.Metadata), true
+	default:
+		return nil, false
+	}
+}
+
 func convertSliceToMap(slice []string) map[string]string {
 	// convert slice to map for processing
 	res := make(map[string]string)
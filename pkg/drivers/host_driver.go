@@ -15,10 +15,12 @@
 package drivers
 
 import (
+	"context"
 	"encoding/json"
 	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -46,13 +48,30 @@ func (d *HostDriver) Destroy() {
 	// since we're running on the host, don't do anything
 }
 
-func (d *HostDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]string) error {
+func (d *HostDriver) Capabilities() []Capability {
+	return hostCapabilities(d.ConfigPath)
+}
+
+// hostCapabilities do not include ownership, which is only read from tar headers,
+// nor metadata without a metadata file, nor extended attributes outside of linux.
+func hostCapabilities(configPath string) []Capability {
+	caps := []Capability{CapCommands, CapSetup, CapTeardown, CapServices}
+	if hostXattrs {
+		caps = append(caps, CapXattrs)
+	}
+	if configPath != "" {
+		caps = append(caps, CapMetadata)
+	}
+	return caps
+}
+
+func (d *HostDriver) Setup(ctx context.Context, envVars []unversioned.EnvVar, fullCommands [][]string) error {
 	// since we're running on the host, we'll provide an optional teardown field for
 	// each test that will allow users to undo the setup they did.
 	// keep track of the original env vars so we can reset later.
 	d.GlobalVars = SetEnvVars(envVars)
 	for _, cmd := range fullCommands {
-		_, _, _, err := d.ProcessCommand(nil, cmd)
+		_, _, _, err := d.ProcessCommand(ctx, nil, cmd, ExecOptions{})
 		if err != nil {
 			return err
 		}
@@ -60,12 +79,12 @@ func (d *HostDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]string
 	return nil
 }
 
-func (d *HostDriver) Teardown(fullCommands [][]string) error {
+func (d *HostDriver) Teardown(ctx context.Context, fullCommands [][]string) error {
 	// since we're running on the host, we'll provide an optional teardown field for each test that
 	// will allow users to undo the setup they did.
 	ResetEnvVars(d.GlobalVars)
 	for _, cmd := range fullCommands {
-		_, _, _, err := d.ProcessCommand(nil, cmd)
+		_, _, _, err := d.ProcessCommand(ctx, nil, cmd, ExecOptions{})
 		if err != nil {
 			return err
 		}
@@ -73,7 +92,7 @@ func (d *HostDriver) Teardown(fullCommands [][]string) error {
 	return nil
 }
 
-func (d *HostDriver) SetEnv(envVars []unversioned.EnvVar) error {
+func (d *HostDriver) SetEnv(_ context.Context, envVars []unversioned.EnvVar) error {
 	for _, envVar := range envVars {
 		if err := os.Setenv(envVar.Key, os.ExpandEnv(envVar.Value)); err != nil {
 			return err
@@ -112,21 +131,58 @@ func ResetEnvVars(envVars []unversioned.EnvVar) {
 	}
 }
 
-func (d *HostDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error) {
+func (d *HostDriver) ProcessCommand(ctx context.Context, envVars []unversioned.EnvVar, fullCommand []string, opts ExecOptions) (string, string, int, error) {
+	if opts.User != "" {
+		return "", "", -1, errors.New("host driver does not support running commands as a different user")
+	}
+	if opts.UseEntrypoint {
+		config, err := d.GetConfig(ctx)
+		if err != nil {
+			return "", "", -1, err
+		}
+		fullCommand = append(append([]string{}, config.Entrypoint...), fullCommand...)
+	}
+	if len(fullCommand) == 0 {
+		return "", "", -1, errors.New("no command to run")
+	}
 	originalVars := SetEnvVars(envVars)
 	defer ResetEnvVars(originalVars)
-	cmd := exec.Command(fullCommand[0], fullCommand[1:]...)
+	cmd := exec.CommandContext(ctx, fullCommand[0], fullCommand[1:]...)
+	cmd.Dir = opts.WorkingDir
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if opts.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(opts.Stdin)
+	}
+	if len(opts.Files) > 0 {
+		if opts.WorkingDir != "" {
+			return "", "", -1, errors.New("host driver does not support files along with a working directory")
+		}
+		// files are never written outside of a temp dir, so that the host is left untouched.
+		// the command is run from there, so relative targets can be found.
+		dir, err := os.MkdirTemp("", "structure-test")
+		if err != nil {
+			return "", "", -1, errors.Wrap(err, "Error creating temp dir for files")
+		}
+		defer os.RemoveAll(dir)
+		if err := writeFiles(dir, opts.Files); err != nil {
+			return "", "", -1, err
+		}
+		cmd.Dir = dir
+	}
 
 	exitCode := 0
 
 	if err := cmd.Start(); err != nil {
-		logrus.Fatalf("error starting command: %v", err)
+		return "", "", -1, errors.Wrap(err, "Error starting command")
 	}
 
 	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			// the command was killed as the run was cancelled
+			return "", "", -1, ctx.Err()
+		}
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 				exitCode = status.ExitStatus()
@@ -139,15 +195,42 @@ func (d *HostDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []
 	return stdout.String(), stderr.String(), exitCode, nil
 }
 
-func (d *HostDriver) StatFile(path string) (os.FileInfo, error) {
+func writeFiles(dir string, files []File) error {
+	for _, f := range files {
+		if filepath.IsAbs(f.Target) {
+			return errors.Errorf("host driver only supports relative targets for files, got %s", f.Target)
+		}
+		target := filepath.Join(dir, f.Target)
+		if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return errors.Errorf("file target %s is outside of the working directory", f.Target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return errors.Wrapf(err, "Error creating directory for %s", f.Target)
+		}
+		if err := os.WriteFile(target, f.Contents, f.Mode); err != nil {
+			return errors.Wrapf(err, "Error writing file %s", f.Target)
+		}
+		// the mode passed to WriteFile is subject to the umask
+		if err := os.Chmod(target, f.Mode); err != nil {
+			return errors.Wrapf(err, "Error setting mode of file %s", f.Target)
+		}
+	}
+	return nil
+}
+
+func (d *HostDriver) StatFile(_ context.Context, path string) (os.FileInfo, error) {
 	return os.Lstat(path)
 }
 
-func (d *HostDriver) ReadFile(path string) ([]byte, error) {
+func (d *HostDriver) Xattrs(_ context.Context, path string) (map[string]string, error) {
+	return readXattrs(path)
+}
+
+func (d *HostDriver) ReadFile(_ context.Context, path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
-func (d *HostDriver) ReadDir(path string) ([]os.FileInfo, error) {
+func (d *HostDriver) ReadDir(_ context.Context, path string) ([]os.FileInfo, error) {
 	entries, err := os.ReadDir(path)
 	if err != nil {
 		return nil, err
@@ -163,7 +246,7 @@ func (d *HostDriver) ReadDir(path string) ([]os.FileInfo, error) {
 	return infos, nil
 }
 
-func (d *HostDriver) GetConfig() (unversioned.Config, error) {
+func (d *HostDriver) GetConfig(_ context.Context) (unversioned.Config, error) {
 	file, err := os.ReadFile(d.ConfigPath)
 	if err != nil {
 		return unversioned.Config{}, errors.Wrap(err, "Error retrieving config")
@@ -196,5 +279,7 @@ func (d *HostDriver) GetConfig() (unversioned.Config, error) {
 		ExposedPorts: ports,
 		Labels:       config.Labels,
 		User:         config.User,
+		Architecture: metadata.Architecture,
+		OS:           metadata.OS,
 	}, nil
 }
@@ -0,0 +1,60 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestHostDriverMissingCommand(t *testing.T) {
+	driver, err := NewHostDriver(DriverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a command which cannot be started fails the test, rather than the whole run
+	_, _, exitCode, err := driver.ProcessCommand(context.Background(), nil, []string{"/nonexistent/command"}, ExecOptions{})
+	if err == nil || !strings.Contains(err.Error(), "Error starting command") {
+		t.Errorf("expected an error starting the command, got %v", err)
+	}
+	if exitCode != -1 {
+		t.Errorf("expected exit code -1, got %d", exitCode)
+	}
+}
+
+func TestHostDriverCapabilities(t *testing.T) {
+	for _, metadata := range []string{"", "config.json"} {
+		args := DriverConfig{Driver: Host, Metadata: metadata}
+		driver, err := NewHostDriver(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caps, ok := args.Capabilities()
+		if !ok {
+			t.Fatalf("expected the capabilities of the host driver to be known")
+		}
+		testutil.CheckDeepEqual(t, driver.Capabilities(), caps)
+		xattrs := false
+		for _, c := range caps {
+			xattrs = xattrs || c == CapXattrs
+		}
+		// extended attributes are only read on linux
+		testutil.CheckDeepEqual(t, runtime.GOOS == "linux", xattrs)
+	}
+}
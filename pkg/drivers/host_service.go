@@ -0,0 +1,160 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// hostService is a process started on the host from the entrypoint and command
+// in the metadata of the image.
+type hostService struct {
+	driver   *HostDriver
+	cmd      *exec.Cmd
+	stdout   *lockedBuffer
+	stderr   *lockedBuffer
+	done     chan struct{} // closed once the process has exited
+	exitCode int
+}
+
+// lockedBuffer is a buffer which can be read while a process writes to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// StartService runs the entrypoint and command of the image on the host. Ports
+// are not remapped, so the service has to be able to listen on them.
+func (d *HostDriver) StartService(ctx context.Context, envVars []unversioned.EnvVar, _ []string) (Service, error) {
+	config, err := d.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fullCommand := append(append([]string{}, config.Entrypoint...), config.Cmd...)
+	if len(fullCommand) == 0 {
+		return nil, errors.New("no entrypoint or command in the metadata to start the service with")
+	}
+	cmd := exec.Command(fullCommand[0], fullCommand[1:]...)
+	cmd.Dir = config.Workdir
+	cmd.Env = os.Environ()
+	for _, envVar := range envVars {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", envVar.Key, os.ExpandEnv(envVar.Value)))
+	}
+	s := &hostService{
+		driver: d,
+		cmd:    cmd,
+		stdout: &lockedBuffer{},
+		stderr: &lockedBuffer{},
+		done:   make(chan struct{}),
+	}
+	cmd.Stdout = s.stdout
+	cmd.Stderr = s.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "Error starting service")
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			s.exitCode = -1
+			if exiterr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+					s.exitCode = status.ExitStatus()
+					if status.Signaled() {
+						// report signals the way a shell, and docker, would
+						s.exitCode = 128 + int(status.Signal())
+					}
+				}
+			}
+		}
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *hostService) Logs() (string, string, error) {
+	return s.stdout.String(), s.stderr.String(), nil
+}
+
+func (s *hostService) Exec(ctx context.Context, fullCommand []string) (string, string, int, error) {
+	return s.driver.ProcessCommand(ctx, nil, fullCommand, ExecOptions{})
+}
+
+func (s *hostService) Address(port string) (string, error) {
+	return net.JoinHostPort("127.0.0.1", port), nil
+}
+
+func (s *hostService) State() (ServiceState, error) {
+	select {
+	case <-s.done:
+		return ServiceState{ExitCode: s.exitCode}, nil
+	default:
+		return ServiceState{Running: true}, nil
+	}
+}
+
+func (s *hostService) Stop(timeout time.Duration) (int, error) {
+	select {
+	case <-s.done:
+		return s.exitCode, nil
+	default:
+	}
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		// signals other than kill are not supported on every platform
+		if err := s.cmd.Process.Kill(); err != nil {
+			return -1, errors.Wrap(err, "Error stopping service")
+		}
+	}
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		if err := s.cmd.Process.Kill(); err != nil {
+			return -1, errors.Wrap(err, "Error killing service")
+		}
+		<-s.done
+	}
+	return s.exitCode, nil
+}
+
+func (s *hostService) Remove() {
+	select {
+	case <-s.done:
+	default:
+		s.cmd.Process.Kill()
+		<-s.done
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package drivers
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// hostXattrs is whether the host driver can read extended attributes.
+const hostXattrs = true
+
+func readXattrs(path string) (map[string]string, error) {
+	xattrs := map[string]string{}
+	names, err := getXattr(func(buf []byte) (int, error) {
+		return unix.Llistxattr(path, buf)
+	})
+	if err == unix.ENOTSUP {
+		// the filesystem does not support extended attributes, so the file has none
+		return xattrs, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing extended attributes of %s", path)
+	}
+	for _, name := range strings.Split(string(names), "\x00") {
+		if name == "" {
+			continue
+		}
+		value, err := getXattr(func(buf []byte) (int, error) {
+			return unix.Lgetxattr(path, name, buf)
+		})
+		if err == unix.ENODATA {
+			// removed since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading extended attribute %s of %s", name, path)
+		}
+		xattrs[name] = string(value)
+	}
+	return xattrs, nil
+}
+
+// getXattr calls a getxattr or listxattr syscall, first to get the size of the
+// value and then to read it, retrying if the value grows in between.
+func getXattr(call func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := call(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		size, err = call(buf)
+		if err == unix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
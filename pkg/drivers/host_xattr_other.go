@@ -0,0 +1,28 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package drivers
+
+import (
+	"github.com/pkg/errors"
+)
+
+// hostXattrs is whether the host driver can read extended attributes.
+const hostXattrs = false
+
+func readXattrs(path string) (map[string]string, error) {
+	return nil, errors.New("reading extended attributes with the host driver is only supported on linux")
+}
@@ -15,13 +15,14 @@
 package drivers
 
 import (
+	"context"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/internal/pkgutil"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
@@ -30,37 +31,26 @@ import (
 )
 
 type TarDriver struct {
-	Image pkgutil.Image
-	Save  bool
+	Image  pkgutil.Image
+	Save   bool
+	Cached bool // the image filesystem is owned by the image cache
 }
 
 func NewTarDriver(args DriverConfig) (Driver, error) {
-	if pkgutil.IsTar(args.Image) {
-		// tar provided, so don't provide any prefix. container-diff can figure this out.
-		image, err := pkgutil.GetImageForName(args.Image)
+	if args.ImageCache != nil {
+		image, err := args.ImageCache.Get(args.Image)
 		if err != nil {
-			return nil, errors.Wrap(err, "processing tar image reference")
+			return nil, err
 		}
 		return &TarDriver{
-			Image: image,
-			Save:  args.Save,
+			Image:  image,
+			Save:   args.Save,
+			Cached: true,
 		}, nil
 	}
-	// try the local docker daemon first
-	image, err := pkgutil.GetImageForName("daemon://" + args.Image)
-	if err == nil {
-		logrus.Debugf("image found in local docker daemon")
-		return &TarDriver{
-			Image: image,
-			Save:  args.Save,
-		}, nil
-	}
-
-	// image not found in local daemon, so try remote.
-	logrus.Infof("unable to retrieve image locally: %s", err)
-	image, err = pkgutil.GetImageForName("remote://" + args.Image)
+	image, err := pkgutil.ResolveImage(args.Image)
 	if err != nil {
-		return nil, errors.Wrap(err, "retrieving image")
+		return nil, err
 	}
 	return &TarDriver{
 		Image: image,
@@ -69,12 +59,20 @@ func NewTarDriver(args DriverConfig) (Driver, error) {
 }
 
 func (d *TarDriver) Destroy() {
-	if !d.Save {
+	if !d.Save && !d.Cached {
 		pkgutil.CleanupImage(d.Image)
 	}
 }
 
-func (d *TarDriver) SetEnv(envVars []unversioned.EnvVar) error {
+func (d *TarDriver) Capabilities() []Capability {
+	return tarCapabilities()
+}
+
+func tarCapabilities() []Capability {
+	return []Capability{CapOwnership, CapMetadata, CapXattrs}
+}
+
+func (d *TarDriver) SetEnv(_ context.Context, envVars []unversioned.EnvVar) error {
 	configFile, err := d.Image.Image.ConfigFile()
 	if err != nil {
 		return errors.Wrap(err, "retrieving image config")
@@ -119,50 +117,80 @@ func (d *TarDriver) SetEnv(envVars []unversioned.EnvVar) error {
 		FSPath: d.Image.FSPath,
 		Digest: d.Image.Digest,
 		Layers: d.Image.Layers,
+		Files:  d.Image.Files,
 	}
 	d.Image = newImage
 	return nil
 }
 
-func (d *TarDriver) Setup(_ []unversioned.EnvVar, _ [][]string) error {
+func (d *TarDriver) Setup(_ context.Context, _ []unversioned.EnvVar, _ [][]string) error {
 	// this driver is unable to process commands, inform user and fail.
 	return errors.New("Tar driver is unable to process commands, please use a different driver")
 }
 
-func (d *TarDriver) Teardown(_ [][]string) error {
+func (d *TarDriver) Teardown(_ context.Context, _ [][]string) error {
 	return errors.New("Tar driver is unable to process commands, please use a different driver")
 }
 
-func (d *TarDriver) ProcessCommand(_ []unversioned.EnvVar, _ []string) (string, string, int, error) {
+func (d *TarDriver) ProcessCommand(_ context.Context, _ []unversioned.EnvVar, _ []string, _ ExecOptions) (string, string, int, error) {
 	// this driver is unable to process commands, inform user and fail.
 	return "", "", -1, errors.New("Tar driver is unable to process commands, please use a different driver")
 }
 
-func (d *TarDriver) StatFile(path string) (os.FileInfo, error) {
+// StatFile returns the metadata of a file as recorded in the layers of the image,
+// so that its ownership, permissions and type are the ones it has in a container.
+// Images unpacked without an index are read from disk.
+func (d *TarDriver) StatFile(_ context.Context, path string) (os.FileInfo, error) {
+	if d.Image.Files != nil {
+		if info, ok := d.Image.Files.Stat(path); ok {
+			return info, nil
+		}
+	}
 	return os.Lstat(filepath.Join(d.Image.FSPath, path))
 }
 
-func (d *TarDriver) ReadFile(path string) ([]byte, error) {
-	return os.ReadFile(filepath.Join(d.Image.FSPath, path))
+func (d *TarDriver) ReadFile(_ context.Context, path string) ([]byte, error) {
+	return os.ReadFile(d.resolve(path))
 }
 
-func (d *TarDriver) ReadDir(path string) ([]os.FileInfo, error) {
-	entries, err := os.ReadDir(filepath.Join(d.Image.FSPath, path))
+func (d *TarDriver) ReadDir(ctx context.Context, path string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(d.resolve(path))
 	if err != nil {
 		return nil, err
 	}
 	infos := make([]fs.FileInfo, 0, len(entries))
 	for _, entry := range entries {
-		info, err := entry.Info()
+		info, err := d.StatFile(ctx, filepath.Join(path, entry.Name()))
 		if err != nil {
 			return nil, err
 		}
 		infos = append(infos, info)
 	}
+	if d.Image.Files == nil {
+		return infos, nil
+	}
+	// device nodes and FIFOs are not unpacked, so they are only in the index
+	for _, info := range d.Image.Files.ReadDir(path) {
+		if info.Mode()&(fs.ModeDevice|fs.ModeNamedPipe) != 0 {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
 	return infos, nil
 }
 
-func (d *TarDriver) GetConfig() (unversioned.Config, error) {
+// resolve returns where a path of the image is unpacked. Symlinks are followed
+// within the image, as the absolute ones would otherwise point into the host.
+func (d *TarDriver) resolve(path string) string {
+	if d.Image.Files != nil {
+		path = d.Image.Files.Resolve(path)
+	}
+	return filepath.Join(d.Image.FSPath, path)
+}
+
+func (d *TarDriver) GetConfig(_ context.Context) (unversioned.Config, error) {
 	configFile, err := d.Image.Image.ConfigFile()
 	if err != nil {
 		return unversioned.Config{}, errors.Wrap(err, "retrieving config file")
@@ -191,5 +219,7 @@ func (d *TarDriver) GetConfig() (unversioned.Config, error) {
 		ExposedPorts: ports,
 		Labels:       config.Labels,
 		User:         config.User,
+		Architecture: configFile.Architecture,
+		OS:           configFile.OS,
 	}, nil
 }
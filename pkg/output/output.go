@@ -42,6 +42,11 @@ func getJunitSuiteName(junitSuiteName string) string {
 
 func OutputResult(out io.Writer, result *types.TestResult) {
 	color.Default.Fprintf(out, "=== RUN: %s\n", result.Name)
+	if result.Skipped {
+		color.Yellow.Fprintln(out, "--- SKIP")
+		color.Default.Fprintf(out, "reason: %s\n", result.SkipReason)
+		return
+	}
 	if result.Pass {
 		color.Green.Fprintln(out, "--- PASS")
 	} else {
@@ -57,6 +62,15 @@ func OutputResult(out io.Writer, result *types.TestResult) {
 	for _, s := range result.Errors {
 		color.Yellow.Fprintf(out, "Error: %s\n", s)
 	}
+	if len(result.Containers) > 0 {
+		color.Default.Fprintf(out, "containers: %s\n", strings.Join(result.Containers, ", "))
+	}
+	if len(result.Images) > 0 {
+		color.Default.Fprintf(out, "images: %s\n", strings.Join(result.Images, ", "))
+	}
+	if result.Debug != "" {
+		color.Default.Fprintf(out, "debug: %s\n", result.Debug)
+	}
 }
 
 func Banner(out io.Writer, filename string) {
@@ -82,31 +96,40 @@ func FinalResults(out io.Writer, format types.OutputValue, junitSuiteName string
 		junit_cases := []*types.JUnitTestCase{}
 		for elem := range result.Results {
 			r := result.Results[elem]
-			junit_cases = append(junit_cases, &types.JUnitTestCase{
+			junit_case := &types.JUnitTestCase{
 				Name:     r.Name,
 				Errors:   r.Errors,
 				Duration: r.Duration.Seconds(),
 				Stdout:   r.Stdout,
 				Stderr:   r.Stderr,
-			})
+			}
+			if r.Skipped {
+				junit_case.Skipped = &types.JUnitSkipped{Message: r.SkipReason}
+			}
+			junit_cases = append(junit_cases, junit_case)
 		}
 		junit_result := struct {
 			XMLName   xml.Name             `xml:"testsuites"`
 			Pass      int                  `xml:"-"`
 			Fail      int                  `xml:"failures,attr"`
+			Skipped   int                  `xml:"skipped,attr,omitempty"`
 			Total     int                  `xml:"tests,attr"`
 			Duration  float64              `xml:"time,attr"`
 			TestSuite types.JUnitTestSuite `xml:"testsuite"`
+
+			Interrupted bool `xml:"interrupted,attr,omitempty"`
 		}{
 			XMLName:  result.XMLName,
 			Pass:     result.Pass,
 			Fail:     result.Fail,
+			Skipped:  result.Skipped,
 			Total:    result.Total,
 			Duration: time.Duration.Seconds(result.Duration), // JUnit expects durations as float of seconds
 			TestSuite: types.JUnitTestSuite{
 				Name:    getJunitSuiteName(junitSuiteName),
 				Results: junit_cases,
 			},
+			Interrupted: result.Interrupted,
 		}
 		res := []byte(strings.ReplaceAll(xml.Header, "\n", ""))
 		marshalled, err := xml.Marshal(junit_result)
@@ -122,7 +145,7 @@ func FinalResults(out io.Writer, format types.OutputValue, junitSuiteName string
 	if bannerLength%2 == 0 {
 		bannerLength++
 	}
-	if result.Total == 0 {
+	if result.Total == 0 && !result.Interrupted {
 		color.Red.Fprintln(out, "No tests run! Check config file format.")
 		return nil
 	}
@@ -132,10 +155,15 @@ func FinalResults(out io.Writer, format types.OutputValue, junitSuiteName string
 	color.Default.Fprintln(out, strings.Repeat("=", bannerLength))
 	color.LightGreen.Fprintf(out, "Passes:      %d\n", result.Pass)
 	color.LightRed.Fprintf(out, "Failures:    %d\n", result.Fail)
+	if result.Skipped > 0 {
+		color.Yellow.Fprintf(out, "Skipped:     %d\n", result.Skipped)
+	}
 	color.Default.Fprintf(out, "Duration:    %s\n", result.Duration.String())
 	color.Cyan.Fprintf(out, "Total tests: %d\n", result.Total)
 	color.Default.Fprintln(out, "")
-	if result.Fail == 0 {
+	if result.Interrupted {
+		color.Red.Fprintln(out, "INTERRUPTED: the run was cancelled before every test ran")
+	} else if result.Fail == 0 {
 		color.Green.Fprintln(out, "PASS")
 	} else {
 		color.Red.Fprintln(out, "FAIL")
@@ -83,3 +83,84 @@ func TestFinalResults(t *testing.T) {
 		})
 	}
 }
+
+func TestFinalResultsSkipped(t *testing.T) {
+	result := unversioned.SummaryObject{
+		Pass:     1,
+		Skipped:  1,
+		Total:    2,
+		Duration: time.Duration(1),
+		Results: []*unversioned.TestResult{
+			{
+				Name:     "my first test",
+				Pass:     true,
+				Duration: time.Duration(1),
+			},
+			{
+				Name:       "my slow test",
+				Skipped:    true,
+				SkipReason: "tagged with excluded tag slow",
+			},
+		},
+	}
+
+	var finalResultsTests = []struct {
+		format   unversioned.OutputValue
+		expected string
+	}{
+		{
+			format:   unversioned.Junit,
+			expected: `<?xml version="1.0" encoding="UTF-8"?><testsuites failures="0" skipped="1" tests="2" time="1e-09"><testsuite name="container-structure-test.test"><testcase name="my first test" time="1e-09"><system-out></system-out><system-err></system-err></testcase><testcase name="my slow test" time="0"><skipped message="tagged with excluded tag slow"></skipped><system-out></system-out><system-err></system-err></testcase></testsuite></testsuites>`,
+		},
+		{
+			format:   unversioned.Json,
+			expected: `{"Pass":1,"Fail":0,"Skipped":1,"Total":2,"Duration":1,"Results":[{"Name":"my first test","Pass":true,"Duration":1},{"Name":"my slow test","Pass":false,"Skipped":true,"SkipReason":"tagged with excluded tag slow","Duration":0}]}`,
+		},
+	}
+
+	for _, test := range finalResultsTests {
+		actual := bytes.NewBuffer([]byte{})
+		FinalResults(actual, test.format, "", result)
+		if strings.TrimSpace(actual.String()) != test.expected {
+			t.Errorf("expected %s but got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestFinalResultsInterrupted(t *testing.T) {
+	result := unversioned.SummaryObject{
+		Pass:        1,
+		Total:       1,
+		Duration:    time.Duration(1),
+		Interrupted: true,
+		Results: []*unversioned.TestResult{
+			{
+				Name:     "my first test",
+				Pass:     true,
+				Duration: time.Duration(1),
+			},
+		},
+	}
+
+	var finalResultsTests = []struct {
+		format   unversioned.OutputValue
+		expected string
+	}{
+		{
+			format:   unversioned.Junit,
+			expected: `<?xml version="1.0" encoding="UTF-8"?><testsuites failures="0" tests="1" time="1e-09" interrupted="true"><testsuite name="container-structure-test.test"><testcase name="my first test" time="1e-09"><system-out></system-out><system-err></system-err></testcase></testsuite></testsuites>`,
+		},
+		{
+			format:   unversioned.Json,
+			expected: `{"Pass":1,"Fail":0,"Total":1,"Duration":1,"Results":[{"Name":"my first test","Pass":true,"Duration":1}],"Interrupted":true}`,
+		},
+	}
+
+	for _, test := range finalResultsTests {
+		actual := bytes.NewBuffer([]byte{})
+		FinalResults(actual, test.format, "", result)
+		if strings.TrimSpace(actual.String()) != test.expected {
+			t.Errorf("expected %s but got %s", test.expected, actual)
+		}
+	}
+}
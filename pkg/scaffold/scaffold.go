@@ -0,0 +1,249 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// The types below mirror the v2 config schema, but only contain the fields
+// that are generated, so that the resulting file stays minimal.
+
+type config struct {
+	SchemaVersion      string              `yaml:"schemaVersion"`
+	MetadataTest       metadataTest        `yaml:"metadataTest"`
+	FileExistenceTests []fileExistenceTest `yaml:"fileExistenceTests,omitempty"`
+	FileContentTests   []fileContentTest   `yaml:"fileContentTests,omitempty"`
+}
+
+type metadataTest struct {
+	EnvVars      []keyValue `yaml:"envVars,omitempty"`
+	Labels       []keyValue `yaml:"labels,omitempty"`
+	ExposedPorts []string   `yaml:"exposedPorts,omitempty"`
+	Volumes      []string   `yaml:"volumes,omitempty"`
+	Entrypoint   []string   `yaml:"entrypoint"`
+	Cmd          []string   `yaml:"cmd"`
+	Workdir      string     `yaml:"workdir,omitempty"`
+	User         string     `yaml:"user,omitempty"`
+}
+
+type fileExistenceTest struct {
+	Name        string `yaml:"name"`
+	Path        string `yaml:"path"`
+	ShouldExist bool   `yaml:"shouldExist"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Uid         *int   `yaml:"uid,omitempty"`
+	Gid         *int   `yaml:"gid,omitempty"`
+}
+
+type fileContentTest struct {
+	Name             string   `yaml:"name"`
+	Path             string   `yaml:"path"`
+	ExpectedContents []string `yaml:"expectedContents"`
+}
+
+type commandTest struct {
+	Name           string   `yaml:"name"`
+	Command        string   `yaml:"command"`
+	Args           []string `yaml:"args,omitempty"`
+	ExitCode       int      `yaml:"exitCode"`
+	ExpectedOutput []string `yaml:"expectedOutput"`
+}
+
+type keyValue struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+// Generate inspects the image through the provided driver and returns a v2 test
+// config which matches its current state.
+func Generate(ctx context.Context, driver drivers.Driver) ([]byte, error) {
+	imageConfig, err := driver.GetConfig(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving image config")
+	}
+
+	c := config{
+		SchemaVersion: "2.0.0",
+		MetadataTest:  generateMetadataTest(imageConfig),
+	}
+
+	seen := map[string]bool{}
+	addFile := func(name, target string) {
+		if target == "" || seen[target] {
+			return
+		}
+		seen[target] = true
+		if t, ok := generateFileExistenceTest(ctx, driver, name, target); ok {
+			c.FileExistenceTests = append(c.FileExistenceTests, t)
+		}
+	}
+	for _, binary := range []string{firstArg(imageConfig.Entrypoint), firstArg(imageConfig.Cmd)} {
+		addFile("binary", resolveBinary(ctx, driver, binary, imageConfig.Env["PATH"]))
+	}
+	addFile("workdir", imageConfig.Workdir)
+	for _, dir := range strings.Split(imageConfig.Env["PATH"], ":") {
+		addFile("PATH directory", dir)
+	}
+
+	if contents, err := driver.ReadFile(ctx, utils.DpkgStatusFile); err == nil {
+		c.FileContentTests = append(c.FileContentTests, generatePackageTest(utils.DpkgStatusFile, "(?m)^Package: %s$", utils.ParseDpkgStatus(contents)))
+	}
+	if contents, err := driver.ReadFile(ctx, utils.ApkInstalledFile); err == nil {
+		c.FileContentTests = append(c.FileContentTests, generatePackageTest(utils.ApkInstalledFile, "(?m)^P:%s$", utils.ParseApkInstalled(contents)))
+	}
+
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling config")
+	}
+	stubs, err := generateCommandStubs(imageConfig)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, stubs...), nil
+}
+
+func generateMetadataTest(imageConfig unversioned.Config) metadataTest {
+	mt := metadataTest{
+		Entrypoint: imageConfig.Entrypoint,
+		Cmd:        imageConfig.Cmd,
+		Workdir:    imageConfig.Workdir,
+		User:       imageConfig.User,
+	}
+	if mt.Entrypoint == nil {
+		mt.Entrypoint = []string{}
+	}
+	if mt.Cmd == nil {
+		mt.Cmd = []string{}
+	}
+	for _, key := range sortedKeys(imageConfig.Env) {
+		mt.EnvVars = append(mt.EnvVars, keyValue{Key: key, Value: imageConfig.Env[key]})
+	}
+	for _, key := range sortedKeys(imageConfig.Labels) {
+		mt.Labels = append(mt.Labels, keyValue{Key: key, Value: imageConfig.Labels[key]})
+	}
+	mt.ExposedPorts = append(mt.ExposedPorts, imageConfig.ExposedPorts...)
+	sort.Strings(mt.ExposedPorts)
+	mt.Volumes = append(mt.Volumes, imageConfig.Volumes...)
+	sort.Strings(mt.Volumes)
+	return mt
+}
+
+func generateFileExistenceTest(ctx context.Context, driver drivers.Driver, kind, target string) (fileExistenceTest, bool) {
+	info, err := driver.StatFile(ctx, target)
+	if err != nil {
+		return fileExistenceTest{}, false
+	}
+	t := fileExistenceTest{
+		Name:        fmt.Sprintf("%s %s", kind, target),
+		Path:        target,
+		ShouldExist: true,
+		Permissions: info.Mode().String(),
+	}
+	if header, ok := info.Sys().(*tar.Header); ok {
+		uid, gid := header.Uid, header.Gid
+		t.Uid, t.Gid = &uid, &gid
+	}
+	return t, true
+}
+
+func generatePackageTest(database string, format string, packages map[string]string) fileContentTest {
+	t := fileContentTest{
+		Name: "installed packages",
+		Path: database,
+	}
+	for _, name := range sortedKeys(packages) {
+		t.ExpectedContents = append(t.ExpectedContents, fmt.Sprintf(format, regexp.QuoteMeta(name)))
+	}
+	return t
+}
+
+// generateCommandStubs returns commented out command tests for the entrypoint of
+// the image, since their expected output cannot be inferred.
+func generateCommandStubs(imageConfig unversioned.Config) ([]byte, error) {
+	command := append(append([]string{}, imageConfig.Entrypoint...), imageConfig.Cmd...)
+	if len(command) == 0 {
+		return nil, nil
+	}
+	stubs := struct {
+		CommandTests []commandTest `yaml:"commandTests"`
+	}{
+		CommandTests: []commandTest{{
+			Name:           "entrypoint",
+			Command:        command[0],
+			Args:           command[1:],
+			ExpectedOutput: []string{""},
+		}},
+	}
+	out, err := yaml.Marshal(stubs)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling command test stubs")
+	}
+	var b bytes.Buffer
+	b.WriteString("\n# Fill in the expected output and uncomment to test the entrypoint of the image.\n")
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		b.WriteString("# " + line + "\n")
+	}
+	return b.Bytes(), nil
+}
+
+// resolveBinary returns the absolute path of a binary in the image, looking it up
+// in the directories of the image's PATH if necessary.
+func resolveBinary(ctx context.Context, driver drivers.Driver, binary string, pathEnv string) string {
+	if binary == "" || path.IsAbs(binary) {
+		return binary
+	}
+	for _, dir := range strings.Split(pathEnv, ":") {
+		if dir == "" {
+			continue
+		}
+		candidate := path.Join(dir, binary)
+		if _, err := driver.StatFile(ctx, candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
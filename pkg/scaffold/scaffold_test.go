@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// fakeDriver serves the config and files of an image with a dpkg database.
+type fakeDriver struct {
+	drivers.Driver
+	files map[string]*tar.Header
+}
+
+func (d fakeDriver) GetConfig(context.Context) (unversioned.Config, error) {
+	return unversioned.Config{
+		Env:          map[string]string{"PATH": "/usr/bin:/bin"},
+		Labels:       map[string]string{"variant": "debug"},
+		ExposedPorts: []string{"8080"},
+		Volumes:      []string{"/data"},
+		Entrypoint:   []string{"server"},
+		Cmd:          []string{"--port", "8080"},
+		Workdir:      "/app",
+		User:         "1000",
+	}, nil
+}
+
+func (d fakeDriver) StatFile(_ context.Context, target string) (os.FileInfo, error) {
+	if header, ok := d.files[target]; ok {
+		return header.FileInfo(), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (d fakeDriver) ReadFile(_ context.Context, target string) ([]byte, error) {
+	if target == utils.DpkgStatusFile {
+		return []byte("Package: libc6\nStatus: install ok installed\nVersion: 2.36\n\nPackage: bash+extra\nStatus: install ok installed\nVersion: 5.2\n"), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func TestGenerateLoads(t *testing.T) {
+	driver := fakeDriver{files: map[string]*tar.Header{
+		"/usr/bin/server": {Name: "usr/bin/server", Typeflag: tar.TypeReg, Mode: 0755, Uid: 1000, Gid: 1000},
+		"/app":            {Name: "app/", Typeflag: tar.TypeDir, Mode: 0750},
+		"/usr/bin":        {Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		"/bin":            {Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "usr/bin", Mode: 0777},
+	}}
+	out, err := Generate(context.Background(), driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the command test stubs are checked too, once uncommented as the note above
+	// them asks
+	note := "# Fill in the expected output and uncomment to test the entrypoint of the image.\n"
+	config, stubs, ok := strings.Cut(string(out), note)
+	if !ok {
+		t.Fatalf("expected command test stubs, got %s", out)
+	}
+	uncommented := config + strings.ReplaceAll(strings.TrimPrefix(stubs, "# "), "\n# ", "\n")
+	tests := []struct {
+		name         string
+		contents     string
+		commandTests int
+	}{
+		{name: "generated", contents: string(out)},
+		{name: "uncommented", contents: uncommented, commandTests: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contents := test.contents
+			st := &v2.StructureTest{}
+			if err := yaml.UnmarshalStrict([]byte(contents), st); err != nil {
+				t.Fatalf("parsing generated config: %s\n%s", err, contents)
+			}
+			if errs := st.Validate(); len(errs) > 0 {
+				t.Errorf("expected the generated config to be valid, got %v\n%s", errs, contents)
+			}
+			testutil.CheckDeepEqual(t, 4, len(st.FileExistenceTests))
+			testutil.CheckDeepEqual(t, 1, len(st.FileContentTests))
+			testutil.CheckDeepEqual(t, test.commandTests, len(st.CommandTests))
+		})
+	}
+}
+
+func TestGenerateMetadataTest(t *testing.T) {
+	mt := generateMetadataTest(unversioned.Config{
+		Env:          map[string]string{"PATH": "/bin", "HOME": "/root"},
+		Labels:       map[string]string{"variant": "debug"},
+		ExposedPorts: []string{"8080", "443"},
+		Workdir:      "/app",
+	})
+	testutil.CheckDeepEqual(t, metadataTest{
+		EnvVars:      []keyValue{{Key: "HOME", Value: "/root"}, {Key: "PATH", Value: "/bin"}},
+		Labels:       []keyValue{{Key: "variant", Value: "debug"}},
+		ExposedPorts: []string{"443", "8080"},
+		Entrypoint:   []string{},
+		Cmd:          []string{},
+		Workdir:      "/app",
+	}, mt)
+}
+
+func TestGenerateCommandStubs(t *testing.T) {
+	stubs, err := generateCommandStubs(unversioned.Config{
+		Entrypoint: []string{"/bin/server"},
+		Cmd:        []string{"--port", "8080"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# Fill in the expected output and uncomment to test the entrypoint of the image.
+# commandTests:
+# - name: entrypoint
+#   command: /bin/server
+#   args:
+#   - --port
+#   - "8080"
+#   exitCode: 0
+#   expectedOutput:
+#   - ""
+`
+	testutil.CheckDeepEqual(t, expected, string(stubs))
+
+	stubs, err = generateCommandStubs(unversioned.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stubs != nil {
+		t.Errorf("expected no stubs for an image without entrypoint, got %s", stubs)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+const draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema document, as generated from a config struct.
+type Schema map[string]interface{}
+
+// Generate returns the JSON Schema describing the YAML and JSON representation of
+// the given config struct. Field names follow the yaml struct tags, the same way
+// they are resolved when a config file is parsed.
+func Generate(title string, v interface{}) Schema {
+	s := forType(reflect.TypeOf(v))
+	s["$schema"] = draft
+	s["title"] = title
+	return s
+}
+
+func forType(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		// durations can be given as a string such as "5s"
+		return Schema{"type": []string{"string", "integer"}}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": forType(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": forType(t.Elem())}
+	case reflect.Struct:
+		properties := Schema{}
+		addProperties(properties, t)
+		return Schema{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+	// interfaces and other dynamic values accept anything
+	return Schema{}
+}
+
+func addProperties(properties Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name, inline, skip := yamlName(field)
+		if skip {
+			continue
+		}
+		if inline {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			addProperties(properties, ft)
+			continue
+		}
+		properties[name] = forType(field.Type)
+	}
+}
+
+// yamlName resolves the key of a struct field the same way gopkg.in/yaml.v2 does.
+func yamlName(field reflect.StructField) (name string, inline bool, skip bool) {
+	switch field.Type.Kind() {
+	case reflect.Func, reflect.Chan:
+		return "", false, true
+	}
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, flag := range parts[1:] {
+		if flag == "inline" {
+			return "", true, false
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], false, false
+	}
+	return strings.ToLower(field.Name), false, false
+}
@@ -0,0 +1,303 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// Options control which parts of an image are recorded in a snapshot.
+type Options struct {
+	Paths   []string `yaml:"paths"`             // roots of the file tree to record
+	Digests []string `yaml:"digests,omitempty"` // patterns of files to record the digest of
+	Ignore  []string `yaml:"ignore,omitempty"`  // patterns of files to leave out of the file tree
+}
+
+// File is a single entry of the recorded file tree.
+type File struct {
+	Path   string `yaml:"path"`
+	Mode   string `yaml:"mode"`
+	Uid    *int   `yaml:"uid,omitempty"`
+	Gid    *int   `yaml:"gid,omitempty"`
+	Link   string `yaml:"link,omitempty"`
+	Digest string `yaml:"digest,omitempty"`
+}
+
+// Manifest is the normalized state of an image, as stored in a golden file.
+type Manifest struct {
+	Options  Options            `yaml:"options"`
+	Files    []File             `yaml:"files"`
+	Config   unversioned.Config `yaml:"config"`
+	Packages map[string]string  `yaml:"packages,omitempty"`
+}
+
+// Record walks the file tree of the image through the provided driver, and records
+// it along with the image config and installed packages.
+func Record(ctx context.Context, driver drivers.Driver, opts Options) (*Manifest, error) {
+	if len(opts.Paths) == 0 {
+		opts.Paths = []string{"/"}
+	}
+	m := &Manifest{
+		Options: opts,
+		Files:   []File{},
+	}
+	for _, root := range opts.Paths {
+		info, err := driver.StatFile(ctx, root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "retrieving snapshot root %s", root)
+		}
+		if err := m.walk(ctx, driver, path.Clean(root), info); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+
+	config, err := driver.GetConfig(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving image config")
+	}
+	// volumes and ports are retrieved from maps, so their order is not stable
+	sort.Strings(config.Volumes)
+	sort.Strings(config.ExposedPorts)
+	m.Config = config
+	m.Packages = utils.GetPackages(func(path string) ([]byte, error) {
+		return driver.ReadFile(ctx, path)
+	})
+	return m, nil
+}
+
+func (m *Manifest) walk(ctx context.Context, driver drivers.Driver, target string, info os.FileInfo) error {
+	if matchesAny(m.Options.Ignore, target) {
+		return nil
+	}
+	// the root directory itself carries no information about the image
+	if target != "/" {
+		f, err := m.record(ctx, driver, target, info)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, f)
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	infos, err := driver.ReadDir(ctx, target)
+	if err != nil {
+		return errors.Wrapf(err, "reading directory %s", target)
+	}
+	for _, child := range infos {
+		if err := m.walk(ctx, driver, path.Join(target, child.Name()), child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) record(ctx context.Context, driver drivers.Driver, target string, info os.FileInfo) (File, error) {
+	f := File{
+		Path: target,
+		Mode: info.Mode().String(),
+	}
+	if header, ok := info.Sys().(*tar.Header); ok {
+		uid, gid := header.Uid, header.Gid
+		f.Uid, f.Gid = &uid, &gid
+		f.Link = header.Linkname
+	}
+	if info.Mode().IsRegular() && matchesAny(m.Options.Digests, target) {
+		contents, err := driver.ReadFile(ctx, target)
+		if err != nil {
+			return File{}, errors.Wrapf(err, "reading %s", target)
+		}
+		f.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(contents))
+	}
+	return f, nil
+}
+
+// Load reads a manifest from a golden file.
+func Load(fp string) (*Manifest, error) {
+	contents, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := yaml.UnmarshalStrict(contents, m); err != nil {
+		return nil, errors.Wrapf(err, "parsing golden file %s", fp)
+	}
+	return m, nil
+}
+
+// Write stores the manifest as a golden file.
+func (m *Manifest) Write(fp string) error {
+	contents, err := yaml.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "marshalling snapshot")
+	}
+	return os.WriteFile(fp, contents, 0644)
+}
+
+// Diff compares a recorded manifest against its golden counterpart and returns a
+// human readable line for every difference. Files are ignored if they match one of
+// the ignore patterns. Config fields and packages are ignored by key,
+// e.g. "config.labels.build-date" or "packages.*".
+func Diff(golden, actual *Manifest, ignore []string) []string {
+	var diffs []string
+
+	goldenFiles := map[string]File{}
+	for _, f := range golden.Files {
+		goldenFiles[f.Path] = f
+	}
+	actualFiles := map[string]File{}
+	for _, f := range actual.Files {
+		actualFiles[f.Path] = f
+	}
+	for _, f := range golden.Files {
+		if matchesAny(ignore, f.Path) {
+			continue
+		}
+		a, ok := actualFiles[f.Path]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("- %s", f.Path))
+			continue
+		}
+		if changes := diffFile(f, a); len(changes) > 0 {
+			diffs = append(diffs, fmt.Sprintf("~ %s: %s", f.Path, strings.Join(changes, ", ")))
+		}
+	}
+	for _, f := range actual.Files {
+		if _, ok := goldenFiles[f.Path]; !ok && !matchesAny(ignore, f.Path) {
+			diffs = append(diffs, fmt.Sprintf("+ %s (%s)", f.Path, f.Mode))
+		}
+	}
+
+	diffs = append(diffs, diffMaps("config.env", golden.Config.Env, actual.Config.Env, ignore)...)
+	diffs = append(diffs, diffMaps("config.labels", golden.Config.Labels, actual.Config.Labels, ignore)...)
+	fields := []struct {
+		key             string
+		golden, current interface{}
+	}{
+		{"config.entrypoint", golden.Config.Entrypoint, actual.Config.Entrypoint},
+		{"config.cmd", golden.Config.Cmd, actual.Config.Cmd},
+		{"config.volumes", golden.Config.Volumes, actual.Config.Volumes},
+		{"config.workdir", golden.Config.Workdir, actual.Config.Workdir},
+		{"config.exposedPorts", golden.Config.ExposedPorts, actual.Config.ExposedPorts},
+		{"config.user", golden.Config.User, actual.Config.User},
+	}
+	for _, field := range fields {
+		if matchesAny(ignore, field.key) {
+			continue
+		}
+		if !reflect.DeepEqual(normalize(field.golden), normalize(field.current)) {
+			diffs = append(diffs, fmt.Sprintf("~ %s: %v -> %v", field.key, field.golden, field.current))
+		}
+	}
+	diffs = append(diffs, diffMaps("packages", golden.Packages, actual.Packages, ignore)...)
+	return diffs
+}
+
+func diffFile(golden, actual File) []string {
+	var changes []string
+	if golden.Mode != actual.Mode {
+		changes = append(changes, fmt.Sprintf("mode %s -> %s", golden.Mode, actual.Mode))
+	}
+	if golden.Uid != nil && actual.Uid != nil && *golden.Uid != *actual.Uid {
+		changes = append(changes, fmt.Sprintf("uid %d -> %d", *golden.Uid, *actual.Uid))
+	}
+	if golden.Gid != nil && actual.Gid != nil && *golden.Gid != *actual.Gid {
+		changes = append(changes, fmt.Sprintf("gid %d -> %d", *golden.Gid, *actual.Gid))
+	}
+	if golden.Link != actual.Link {
+		changes = append(changes, fmt.Sprintf("link %s -> %s", golden.Link, actual.Link))
+	}
+	if golden.Digest != actual.Digest {
+		changes = append(changes, fmt.Sprintf("digest %s -> %s", golden.Digest, actual.Digest))
+	}
+	return changes
+}
+
+func diffMaps(prefix string, golden, actual map[string]string, ignore []string) []string {
+	var diffs []string
+	keys := map[string]bool{}
+	for k := range golden {
+		keys[k] = true
+	}
+	for k := range actual {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		key := prefix + "." + k
+		if matchesAny(ignore, key) {
+			continue
+		}
+		g, inGolden := golden[k]
+		a, inActual := actual[k]
+		switch {
+		case !inGolden:
+			diffs = append(diffs, fmt.Sprintf("+ %s: %s", key, a))
+		case !inActual:
+			diffs = append(diffs, fmt.Sprintf("- %s: %s", key, g))
+		case g != a:
+			diffs = append(diffs, fmt.Sprintf("~ %s: %s -> %s", key, g, a))
+		}
+	}
+	return diffs
+}
+
+// normalize treats nil and empty slices as equal, since the golden file omits both.
+func normalize(v interface{}) interface{} {
+	if s, ok := v.([]string); ok && len(s) == 0 {
+		return nil
+	}
+	return v
+}
+
+// matchesAny reports whether one of the patterns selects a file or a key of the
+// manifest. Digest, ignore and key patterns are all matched this way: as shell
+// patterns (see path.Match), where `*` matches within a single path element and
+// `**` is not supported. A pattern matching a directory also selects everything
+// beneath it, as one matching a key selects its fields.
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(key, "/") {
+			if utils.MatchesPath(pattern, key) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, key); matched || strings.HasPrefix(key, pattern+".") {
+			return true
+		}
+	}
+	return false
+}
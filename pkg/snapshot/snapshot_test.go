@@ -0,0 +1,88 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestDiff(t *testing.T) {
+	golden := &Manifest{
+		Files: []File{
+			{Path: "/app/main", Mode: "-rwxr-xr-x", Digest: "sha256:aaa"},
+			{Path: "/etc/passwd", Mode: "-rw-r--r--"},
+			{Path: "/var/cache/apt", Mode: "drwxr-xr-x"},
+		},
+		Config: unversioned.Config{
+			Env:    map[string]string{"PATH": "/bin"},
+			Labels: map[string]string{"build-date": "2020-01-01"},
+			Cmd:    []string{"/app/main"},
+		},
+		Packages: map[string]string{"libc6": "2.36"},
+	}
+	actual := &Manifest{
+		Files: []File{
+			{Path: "/app/main", Mode: "-rwxr-xr-x", Digest: "sha256:bbb"},
+			{Path: "/app/VERSION", Mode: "-rw-r--r--"},
+			{Path: "/var/cache/apt/pkgcache.bin", Mode: "-rw-r--r--"},
+		},
+		Config: unversioned.Config{
+			Env:    map[string]string{"PATH": "/usr/bin"},
+			Labels: map[string]string{"build-date": "2021-01-01"},
+			Cmd:    []string{"/app/main"},
+			// an empty list is recorded the same as a missing one
+			Volumes: []string{},
+		},
+		Packages: map[string]string{"libc6": "2.37", "jq": "1.6"},
+	}
+
+	diffs := Diff(golden, actual, []string{"/var/cache", "config.labels.*"})
+	testutil.CheckDeepEqual(t, []string{
+		"~ /app/main: digest sha256:aaa -> sha256:bbb",
+		"- /etc/passwd",
+		"+ /app/VERSION (-rw-r--r--)",
+		"~ config.env.PATH: /bin -> /usr/bin",
+		"+ packages.jq: 1.6",
+		"~ packages.libc6: 2.36 -> 2.37",
+	}, diffs)
+}
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		key      string
+		expected bool
+	}{
+		{pattern: "/usr/bin/*", key: "/usr/bin/jq", expected: true},
+		{pattern: "/usr/bin/*", key: "/usr/bin/sub/tool", expected: true},
+		{pattern: "/usr/bin", key: "/usr/bin/jq", expected: true},
+		{pattern: "/usr/bin", key: "/usr/bin2/jq", expected: false},
+		// ** is not supported, so it is the same as *
+		{pattern: "/usr/**/jq", key: "/usr/bin/jq", expected: true},
+		{pattern: "/usr/**/jq", key: "/usr/local/bin/jq", expected: false},
+		{pattern: "*.so", key: "/lib/libc.so", expected: false},
+		{pattern: "config.labels.*", key: "config.labels.build-date", expected: true},
+		{pattern: "packages", key: "packages.jq", expected: true},
+		{pattern: "config.env", key: "config.environment", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.key, func(t *testing.T) {
+			testutil.CheckDeepEqual(t, test.expected, matchesAny([]string{test.pattern}, test.key))
+		})
+	}
+}
@@ -15,15 +15,20 @@
 package types
 
 import (
+	"context"
+
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/v1"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
 )
 
 type StructureTest interface {
 	SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error), drivers.DriverConfig)
+	SetFilter(unversioned.TestFilter)
 	NewDriver() (drivers.Driver, error)
-	RunAll(chan interface{}, string)
+	RunAll(context.Context, chan interface{}, string)
+	Validate() []unversioned.ValidationError
 }
 
 var SchemaVersions map[string]func() StructureTest = map[string]func() StructureTest{
@@ -17,6 +17,8 @@ package unversioned
 import (
 	"encoding/xml"
 	"fmt"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -34,14 +36,16 @@ type Label struct {
 }
 
 type Config struct {
-	Env          map[string]string
-	Entrypoint   []string
-	Cmd          []string
-	Volumes      []string
-	Workdir      string
-	ExposedPorts []string
-	Labels       map[string]string
-	User         string
+	Env          map[string]string `yaml:"env,omitempty"`
+	Entrypoint   []string          `yaml:"entrypoint,omitempty"`
+	Cmd          []string          `yaml:"cmd,omitempty"`
+	Volumes      []string          `yaml:"volumes,omitempty"`
+	Workdir      string            `yaml:"workdir,omitempty"`
+	ExposedPorts []string          `yaml:"exposedPorts,omitempty"`
+	Labels       map[string]string `yaml:"labels,omitempty"`
+	User         string            `yaml:"user,omitempty"`
+	Architecture string            `yaml:"architecture,omitempty"`
+	OS           string            `yaml:"os,omitempty"`
 }
 
 type ContainerRunOptions struct {
@@ -52,6 +56,21 @@ type ContainerRunOptions struct {
 	EnvFile      string   `yaml:"envFile"`
 	Capabilities []string
 	BindMounts   []string `yaml:"bindMounts"`
+
+	// resource limits and security settings, used by the docker driver
+	Memory         string            `yaml:"memory"`         // memory limit, e.g. 512m
+	CPUs           string            `yaml:"cpus"`           // number of CPUs, e.g. 1.5
+	PidsLimit      int64             `yaml:"pidsLimit"`      // maximum number of processes, -1 for unlimited
+	ShmSize        string            `yaml:"shmSize"`        // size of /dev/shm, e.g. 64m
+	Ulimits        []string          `yaml:"ulimits"`        // e.g. nofile=1024:2048
+	NetworkMode    string            `yaml:"networkMode"`    // e.g. none, host or bridge
+	ExtraHosts     []string          `yaml:"extraHosts"`     // host:ip entries added to /etc/hosts
+	ReadOnlyRootfs bool              `yaml:"readOnlyRootfs"` // mount the root filesystem read-only
+	Tmpfs          []string          `yaml:"tmpfs"`          // tmpfs mounts as path[:options], e.g. /tmp:rw,size=64m
+	CapDrop        []string          `yaml:"capDrop"`        // capabilities to drop, e.g. ALL
+	SecurityOpt    []string          `yaml:"securityOpt"`    // e.g. no-new-privileges, seccomp=profile.json
+	Devices        []string          `yaml:"devices"`        // host devices as host[:container[:permissions]]
+	Sysctls        map[string]string `yaml:"sysctls"`        // namespaced kernel parameters
 }
 
 func (opts *ContainerRunOptions) IsSet() bool {
@@ -61,22 +80,74 @@ func (opts *ContainerRunOptions) IsSet() bool {
 		len(opts.EnvFile) > 0 ||
 		(opts.EnvVars != nil && len(opts.EnvVars) > 0) ||
 		(opts.Capabilities != nil && len(opts.Capabilities) > 0) ||
-		(opts.BindMounts != nil && len(opts.BindMounts) > 0)
+		(opts.BindMounts != nil && len(opts.BindMounts) > 0) ||
+		opts.Memory != "" ||
+		opts.CPUs != "" ||
+		opts.PidsLimit != 0 ||
+		opts.ShmSize != "" ||
+		len(opts.Ulimits) > 0 ||
+		opts.NetworkMode != "" ||
+		len(opts.ExtraHosts) > 0 ||
+		opts.ReadOnlyRootfs ||
+		len(opts.Tmpfs) > 0 ||
+		len(opts.CapDrop) > 0 ||
+		len(opts.SecurityOpt) > 0 ||
+		len(opts.Devices) > 0 ||
+		len(opts.Sysctls) > 0
+}
+
+// Override returns the options with the ones set in overrides replacing them, as
+// the options of a test override the global ones. Boolean options can only be
+// turned on, and lists and maps are replaced rather than appended to.
+func (opts ContainerRunOptions) Override(overrides *ContainerRunOptions) ContainerRunOptions {
+	if overrides == nil {
+		return opts
+	}
+	merged := reflect.ValueOf(&opts).Elem()
+	set := reflect.ValueOf(overrides).Elem()
+	for i := 0; i < set.NumField(); i++ {
+		if !set.Field(i).IsZero() {
+			merged.Field(i).Set(set.Field(i))
+		}
+	}
+	return opts
+}
+
+// ValidationError is a problem with a test config, found before any tests are run.
+type ValidationError struct {
+	Section string // config section the test is declared in, e.g. commandTests
+	Index   int    // index of the test within its section, or -1 if the section is not a list
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%s: %s", e.Section, e.Message)
+	}
+	return fmt.Sprintf("%s[%d]: %s", e.Section, e.Index, e.Message)
 }
 
 type TestResult struct {
-	Name     string        `xml:"name,attr"`
-	Pass     bool          `xml:"-"`
-	Stdout   string        `json:",omitempty" xml:"-"`
-	Stderr   string        `json:",omitempty" xml:"-"`
-	Errors   []string      `json:",omitempty" xml:"failure"`
-	Duration time.Duration `xml:"time,attr"`
+	Name       string        `xml:"name,attr"`
+	Pass       bool          `xml:"-"`
+	Skipped    bool          `json:",omitempty" xml:"-"`
+	SkipReason string        `json:",omitempty" xml:"-"`
+	Stdout     string        `json:",omitempty" xml:"-"`
+	Stderr     string        `json:",omitempty" xml:"-"`
+	Errors     []string      `json:",omitempty" xml:"failure"`
+	Duration   time.Duration `xml:"time,attr"`
+
+	Containers []string `json:",omitempty" xml:"-"` // containers kept with --save or --debug-on-failure
+	Images     []string `json:",omitempty" xml:"-"` // images kept with --save or --debug-on-failure
+	Debug      string   `json:",omitempty" xml:"-"` // command opening a shell in the kept environment of a failing test
 }
 
 func (t *TestResult) String() string {
 	strRepr := fmt.Sprintf("\nTest Name:%s", t.Name)
 	testStatus := "Fail"
-	if t.IsPass() {
+	if t.Skipped {
+		testStatus = "Skip"
+	} else if t.IsPass() {
 		testStatus = "Pass"
 	}
 	strRepr += fmt.Sprintf("\nTest Status:%s", testStatus)
@@ -111,9 +182,19 @@ type SummaryObject struct {
 	XMLName  xml.Name      `json:"-" xml:"testsuites"`
 	Pass     int           `xml:"-"`
 	Fail     int           `xml:"failures,attr"`
+	Skipped  int           `json:",omitempty" xml:"skipped,attr,omitempty"`
 	Total    int           `xml:"tests,attr"`
 	Duration time.Duration `xml:"time,attr"`
 	Results  []*TestResult `json:",omitempty" xml:"testsuite>testcase"`
+
+	Interrupted bool `json:",omitempty" xml:"interrupted,attr,omitempty"` // the run was cancelled before every test ran
+}
+
+// TestFilter selects the tests to run, as set from the command line.
+type TestFilter struct {
+	IncludeTags []string       // if set, only tests with one of these tags are run
+	ExcludeTags []string       // tests with one of these tags are skipped
+	Run         *regexp.Regexp // if set, only tests with a matching name are run
 }
 
 type JUnitTestSuite struct {
@@ -122,11 +203,16 @@ type JUnitTestSuite struct {
 }
 
 type JUnitTestCase struct {
-	Name     string   `xml:"name,attr"`
-	Errors   []string `xml:"failure"`
-	Duration float64  `xml:"time,attr"`
-	Stdout   string   `xml:"system-out"`
-	Stderr   string   `xml:"system-err"`
+	Name     string        `xml:"name,attr"`
+	Errors   []string      `xml:"failure"`
+	Skipped  *JUnitSkipped `xml:"skipped"`
+	Duration float64       `xml:"time,attr"`
+	Stdout   string        `xml:"system-out"`
+	Stderr   string        `xml:"system-err"`
+}
+
+type JUnitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
 }
 
 type OutputValue int
@@ -15,6 +15,7 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -69,14 +70,14 @@ func (ct *CommandTest) Validate() error {
 	return nil
 }
 
-func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
+func (ct *CommandTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	logrus.Debug(ct.LogName())
-	config, err := driver.GetConfig()
+	config, err := driver.GetConfig(ctx)
 	if err != nil {
 		logrus.Errorf("error retrieving image config: %s", err.Error())
 	}
 	start := time.Now()
-	stdout, stderr, exitcode, err := driver.ProcessCommand(ct.EnvVars, utils.SubstituteEnvVars(ct.Command, config.Env))
+	stdout, stderr, exitcode, err := driver.ProcessCommand(ctx, ct.EnvVars, utils.SubstituteEnvVars(ct.Command, config.Env), drivers.ExecOptions{})
 	end := time.Now()
 	duration := end.Sub(start)
 	result := &types.TestResult{
@@ -15,6 +15,7 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
@@ -43,13 +44,13 @@ func (ft FileContentTest) LogName() string {
 	return fmt.Sprintf("File Content Test: %s", ft.Name)
 }
 
-func (ft FileContentTest) Run(driver drivers.Driver) *types.TestResult {
+func (ft FileContentTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name:   ft.LogName(),
 		Pass:   true,
 		Errors: make([]string, 0),
 	}
-	actualContents, err := driver.ReadFile(ft.Path)
+	actualContents, err := driver.ReadFile(ctx, ft.Path)
 	if err != nil {
 		result.Errorf("Failed to open %s. Error: %s", ft.Path, err)
 		result.Fail()
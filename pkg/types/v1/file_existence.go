@@ -15,6 +15,7 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -56,7 +57,7 @@ func (ft FileExistenceTest) Validate() error {
 		return fmt.Errorf("Please provide a valid name for every test")
 	}
 	if ft.Path == "" {
-		fmt.Errorf("Please provide a valid file path for test %s", ft.Name)
+		return fmt.Errorf("Please provide a valid file path for test %s", ft.Name)
 	}
 	return nil
 }
@@ -65,7 +66,7 @@ func (ft FileExistenceTest) LogName() string {
 	return fmt.Sprintf("File Existence Test: %s", ft.Name)
 }
 
-func (ft FileExistenceTest) Run(driver drivers.Driver) *types.TestResult {
+func (ft FileExistenceTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name:   ft.LogName(),
 		Pass:   true,
@@ -73,7 +74,7 @@ func (ft FileExistenceTest) Run(driver drivers.Driver) *types.TestResult {
 	}
 	logrus.Info(ft.LogName())
 	var info os.FileInfo
-	info, err := driver.StatFile(ft.Path)
+	info, err := driver.StatFile(ctx, ft.Path)
 	if info == nil && ft.ShouldExist {
 		result.Errorf(errors.Wrap(err, "Error examining file in container").Error())
 		result.Fail()
@@ -15,6 +15,7 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
@@ -41,9 +42,9 @@ var (
 	blacklist = []string{"AGPL", "WTFPL"}
 )
 
-func checkFile(licenseFile string, driver drivers.Driver) error {
+func checkFile(ctx context.Context, licenseFile string, driver drivers.Driver) error {
 	// Read through the copyright file and make sure don't have an unauthorized license
-	license, err := driver.ReadFile(licenseFile)
+	license, err := driver.ReadFile(ctx, licenseFile)
 	if err != nil {
 		return fmt.Errorf("Error reading license file for %s: %s", licenseFile, err.Error())
 	}
@@ -56,7 +57,7 @@ func checkFile(licenseFile string, driver drivers.Driver) error {
 	return nil
 }
 
-func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
+func (lt LicenseTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name:   lt.LogName(),
 		Pass:   true,
@@ -65,7 +66,7 @@ func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
 	logrus.Info(lt.LogName())
 	if lt.Debian {
 		root := utils.DebianRoot
-		packages, err := driver.ReadDir(root)
+		packages, err := driver.ReadDir(ctx, root)
 		if err != nil {
 			result.Errorf("Error reading directory: %s", err)
 			result.Fail()
@@ -90,13 +91,13 @@ func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
 
 			// If package doesn't have copyright file, log an error.
 			licenseFile := path.Join(root, p.Name(), utils.LicenseFile)
-			_, err := driver.StatFile(licenseFile)
+			_, err := driver.StatFile(ctx, licenseFile)
 			if err != nil {
 				result.Errorf("Error reading license file for %s: %s", p.Name(), err.Error())
 				result.Pass = false
 			}
 
-			if err = checkFile(licenseFile, driver); err != nil {
+			if err = checkFile(ctx, licenseFile, driver); err != nil {
 				result.Error(err.Error())
 				result.Pass = false
 			}
@@ -104,7 +105,7 @@ func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
 	}
 
 	for _, file := range lt.Files {
-		if err := checkFile(file, driver); err != nil {
+		if err := checkFile(ctx, file, driver); err != nil {
 			result.Error(err.Error())
 			result.Pass = false
 		}
@@ -15,6 +15,8 @@
 package v1
 
 import (
+	"context"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
@@ -22,14 +24,14 @@ import (
 )
 
 type StructureTest struct {
-	DriverImpl         func(drivers.DriverConfig) (drivers.Driver, error)
-	DriverArgs         drivers.DriverConfig
-	SchemaVersion      string              `yaml:"schemaVersion"`
-	GlobalEnvVars      []types.EnvVar      `yaml:"globalEnvVars"`
-	CommandTests       []CommandTest       `yaml:"commandTests"`
-	FileExistenceTests []FileExistenceTest `yaml:"fileExistenceTests"`
-	FileContentTests   []FileContentTest   `yaml:"fileContentTests"`
-	LicenseTests       []LicenseTest       `yaml:"licenseTests"`
+	DriverImpl         func(drivers.DriverConfig) (drivers.Driver, error) `yaml:"-" json:"-"`
+	DriverArgs         drivers.DriverConfig                               `yaml:"-" json:"-"`
+	SchemaVersion      string                                             `yaml:"schemaVersion"`
+	GlobalEnvVars      []types.EnvVar                                     `yaml:"globalEnvVars"`
+	CommandTests       []CommandTest                                      `yaml:"commandTests"`
+	FileExistenceTests []FileExistenceTest                                `yaml:"fileExistenceTests"`
+	FileContentTests   []FileContentTest                                  `yaml:"fileContentTests"`
+	LicenseTests       []LicenseTest                                      `yaml:"licenseTests"`
 }
 
 func (st *StructureTest) NewDriver() (drivers.Driver, error) {
@@ -41,23 +43,54 @@ func (st *StructureTest) SetDriverImpl(f func(drivers.DriverConfig) (drivers.Dri
 	st.DriverArgs = args
 }
 
-func (st *StructureTest) RunAll(channel chan interface{}, file string) {
+// SetFilter is a no-op, since test selection is only supported from schema version 2.0.0.
+func (st *StructureTest) SetFilter(filter types.TestFilter) {
+	if filter.Run != nil || len(filter.IncludeTags) > 0 || len(filter.ExcludeTags) > 0 {
+		logrus.Warn("test selection is not supported by schema version 1.0.0, running all tests")
+	}
+}
+
+// Validate checks every test in the config, without creating any drivers.
+func (st *StructureTest) Validate() []types.ValidationError {
+	var errs []types.ValidationError
+	for i, test := range st.CommandTests {
+		if err := test.Validate(); err != nil {
+			errs = append(errs, types.ValidationError{Section: "commandTests", Index: i, Message: err.Error()})
+		}
+	}
+	for i, test := range st.FileExistenceTests {
+		if err := test.Validate(); err != nil {
+			errs = append(errs, types.ValidationError{Section: "fileExistenceTests", Index: i, Message: err.Error()})
+		}
+	}
+	for i, test := range st.FileContentTests {
+		if err := test.Validate(); err != nil {
+			errs = append(errs, types.ValidationError{Section: "fileContentTests", Index: i, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+func (st *StructureTest) RunAll(ctx context.Context, channel chan interface{}, file string) {
 	// Wait till the file is Processed so we can display the results per file.
 	fileProcessed := make(chan bool, 1)
-	go st.runAll(channel, fileProcessed)
+	go st.runAll(ctx, channel, fileProcessed)
 	<-fileProcessed
 }
 
-func (st *StructureTest) runAll(channel chan interface{}, fileProcessed chan bool) {
-	st.RunCommandTests(channel)
-	st.RunFileContentTests(channel)
-	st.RunFileExistenceTests(channel)
-	st.RunLicenseTests(channel)
+func (st *StructureTest) runAll(ctx context.Context, channel chan interface{}, fileProcessed chan bool) {
+	st.RunCommandTests(ctx, channel)
+	st.RunFileContentTests(ctx, channel)
+	st.RunFileExistenceTests(ctx, channel)
+	st.RunLicenseTests(ctx, channel)
 	fileProcessed <- true
 }
 
-func (st *StructureTest) RunCommandTests(channel chan interface{}) {
+func (st *StructureTest) RunCommandTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.CommandTests {
+		if ctx.Err() != nil {
+			return
+		}
 		if err := test.Validate(); err != nil {
 			logrus.Error(err.Error())
 			continue
@@ -67,23 +100,26 @@ func (st *StructureTest) RunCommandTests(channel chan interface{}) {
 			logrus.Fatal(err.Error())
 		}
 		vars := append(st.GlobalEnvVars, test.EnvVars...)
-		if err = driver.Setup(vars, test.Setup); err != nil {
+		if err = driver.Setup(ctx, vars, test.Setup); err != nil {
 			logrus.Error(err.Error())
 			driver.Destroy()
 			continue
 		}
 		defer func() {
-			if err := driver.Teardown(test.Teardown); err != nil {
+			if err := driver.Teardown(context.WithoutCancel(ctx), test.Teardown); err != nil {
 				logrus.Error(err.Error())
 			}
 			driver.Destroy()
 		}()
-		channel <- test.Run(driver)
+		channel <- test.Run(ctx, driver)
 	}
 }
 
-func (st *StructureTest) RunFileExistenceTests(channel chan interface{}) {
+func (st *StructureTest) RunFileExistenceTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.FileExistenceTests {
+		if ctx.Err() != nil {
+			return
+		}
 		if err := test.Validate(); err != nil {
 			logrus.Error(err.Error())
 			continue
@@ -92,13 +128,16 @@ func (st *StructureTest) RunFileExistenceTests(channel chan interface{}) {
 		if err != nil {
 			logrus.Fatal(err.Error())
 		}
-		channel <- test.Run(driver)
+		channel <- test.Run(ctx, driver)
 		driver.Destroy()
 	}
 
 }
-func (st *StructureTest) RunFileContentTests(channel chan interface{}) {
+func (st *StructureTest) RunFileContentTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.FileContentTests {
+		if ctx.Err() != nil {
+			return
+		}
 		if err := test.Validate(); err != nil {
 			logrus.Error(err.Error())
 			continue
@@ -107,18 +146,21 @@ func (st *StructureTest) RunFileContentTests(channel chan interface{}) {
 		if err != nil {
 			logrus.Fatal(err.Error())
 		}
-		channel <- test.Run(driver)
+		channel <- test.Run(ctx, driver)
 		driver.Destroy()
 	}
 }
 
-func (st *StructureTest) RunLicenseTests(channel chan interface{}) {
+func (st *StructureTest) RunLicenseTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.LicenseTests {
+		if ctx.Err() != nil {
+			return
+		}
 		driver, err := st.NewDriver()
 		if err != nil {
 			logrus.Fatal(err.Error())
 		}
-		channel <- test.Run(driver)
+		channel <- test.Run(ctx, driver)
 		driver.Destroy()
 	}
 }
@@ -0,0 +1,222 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+)
+
+const (
+	capabilityXattr = "security.capability"
+	paxXattrPrefix  = "SCHILY.xattr."
+
+	noCapabilities = "none"
+
+	// revisions of the security.capability value, see linux/capability.h
+	vfsCapRevision1 = 0x01000000
+	vfsCapRevision2 = 0x02000000
+	vfsCapRevision3 = 0x03000000
+	vfsCapRevMask   = 0xFF000000
+	vfsCapEffective = 0x000001
+)
+
+// capabilityNames are the names of capabilities, indexed by their number.
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid", "cap_setpcap",
+	"cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// capabilities are the file capabilities of a file, as the flags (a subset of
+// "eip") of each capability it has.
+type capabilities map[int]string
+
+// decodeCapabilities decodes the value of the security.capability xattr.
+func decodeCapabilities(value []byte) (capabilities, error) {
+	if len(value) < 4 {
+		return nil, fmt.Errorf("%s is too short", capabilityXattr)
+	}
+	magic := binary.LittleEndian.Uint32(value)
+	words := 0
+	switch magic & vfsCapRevMask {
+	case vfsCapRevision1:
+		words = 1
+	case vfsCapRevision2, vfsCapRevision3:
+		words = 2
+	default:
+		return nil, fmt.Errorf("unknown %s revision %#x", capabilityXattr, magic&vfsCapRevMask)
+	}
+	if len(value) < 4+8*words {
+		return nil, fmt.Errorf("%s is too short", capabilityXattr)
+	}
+	caps := capabilities{}
+	for w := 0; w < words; w++ {
+		permitted := binary.LittleEndian.Uint32(value[4+8*w:])
+		inheritable := binary.LittleEndian.Uint32(value[8+8*w:])
+		for bit := 0; bit < 32; bit++ {
+			flags := ""
+			// the effective flag of a file raises all of its permitted and
+			// inheritable capabilities
+			if magic&vfsCapEffective != 0 && (permitted|inheritable)&(1<<bit) != 0 {
+				flags += "e"
+			}
+			if inheritable&(1<<bit) != 0 {
+				flags += "i"
+			}
+			if permitted&(1<<bit) != 0 {
+				flags += "p"
+			}
+			if flags != "" {
+				caps[32*w+bit] = flags
+			}
+		}
+	}
+	return caps, nil
+}
+
+// parseCapabilities parses capabilities in the text form of getcap, e.g.
+// "cap_net_raw+ep" or "cap_chown,cap_kill=ep cap_setuid=i", or "none".
+func parseCapabilities(text string) (capabilities, error) {
+	caps := capabilities{}
+	if strings.TrimSpace(text) == noCapabilities {
+		return caps, nil
+	}
+	for _, clause := range strings.Fields(text) {
+		i := strings.IndexAny(clause, "+=")
+		if i <= 0 {
+			return nil, fmt.Errorf("expected capabilities and flags separated by + or = in %q", clause)
+		}
+		flags := clause[i+1:]
+		if strings.Trim(flags, "eip") != "" || flags == "" {
+			return nil, fmt.Errorf("expected flags made of e, i and p in %q", clause)
+		}
+		for _, name := range strings.Split(clause[:i], ",") {
+			n, err := capabilityNumber(name)
+			if err != nil {
+				return nil, err
+			}
+			caps[n] = sortFlags(caps[n] + flags)
+		}
+	}
+	return caps, nil
+}
+
+func capabilityNumber(name string) (int, error) {
+	name = strings.ToLower(name)
+	for n, capName := range capabilityNames {
+		if name == capName {
+			return n, nil
+		}
+	}
+	// capabilities newer than the ones known are named after their number
+	if n, err := strconv.Atoi(strings.TrimPrefix(name, "cap_")); err == nil && n >= 0 && n < 64 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown capability %s", name)
+}
+
+func capabilityName(n int) string {
+	if n < len(capabilityNames) {
+		return capabilityNames[n]
+	}
+	return fmt.Sprintf("cap_%d", n)
+}
+
+// sortFlags orders flags as eip, removing duplicates.
+func sortFlags(flags string) string {
+	sorted := ""
+	for _, f := range "eip" {
+		if strings.ContainsRune(flags, f) {
+			sorted += string(f)
+		}
+	}
+	return sorted
+}
+
+// String formats capabilities as getcap does, grouping the capabilities which
+// have the same flags.
+func (c capabilities) String() string {
+	if len(c) == 0 {
+		return noCapabilities
+	}
+	numbers := make([]int, 0, len(c))
+	for n := range c {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	var groups []string
+	names := map[string][]string{}
+	for _, n := range numbers {
+		flags := c[n]
+		if _, ok := names[flags]; !ok {
+			groups = append(groups, flags)
+		}
+		names[flags] = append(names[flags], capabilityName(n))
+	}
+	clauses := make([]string, 0, len(groups))
+	for _, flags := range groups {
+		clauses = append(clauses, strings.Join(names[flags], ",")+"="+flags)
+	}
+	return strings.Join(clauses, " ")
+}
+
+func (c capabilities) equals(other capabilities) bool {
+	if len(c) != len(other) {
+		return false
+	}
+	for n, flags := range c {
+		if other[n] != flags {
+			return false
+		}
+	}
+	return true
+}
+
+// fileXattrs returns the extended attributes of a file, from the tar header the
+// driver stats it with, or from the filesystem for drivers which read them there.
+func fileXattrs(ctx context.Context, driver drivers.Driver, path string, info os.FileInfo) (map[string]string, error) {
+	if header, ok := info.Sys().(*tar.Header); ok {
+		xattrs := map[string]string{}
+		for key, value := range header.PAXRecords {
+			if strings.HasPrefix(key, paxXattrPrefix) {
+				xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = value
+			}
+		}
+		return xattrs, nil
+	}
+	if xattrDriver, ok := driver.(drivers.XattrDriver); ok {
+		return xattrDriver.Xattrs(ctx, path)
+	}
+	return nil, errors.New("extended attributes are not supported by this driver")
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// capabilityXattrValue encodes a security.capability value of the given revision.
+func capabilityXattrValue(magic uint32, words ...uint32) string {
+	value := binary.LittleEndian.AppendUint32(nil, magic)
+	for _, w := range words {
+		value = binary.LittleEndian.AppendUint32(value, w)
+	}
+	return string(value)
+}
+
+func TestDecodeCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{
+			name:     "net raw effective",
+			value:    capabilityXattrValue(vfsCapRevision2|vfsCapEffective, 1<<13, 0, 0, 0),
+			expected: "cap_net_raw=ep",
+		},
+		{
+			name:     "grouped by flags",
+			value:    capabilityXattrValue(vfsCapRevision2, 1<<0|1<<5|1<<7, 1<<7, 1<<(38-32), 0),
+			expected: "cap_chown,cap_kill,cap_perfmon=p cap_setuid=ip",
+		},
+		{
+			name:     "revision 3 with rootid",
+			value:    capabilityXattrValue(vfsCapRevision3|vfsCapEffective, 1<<10, 0, 0, 0, 1000),
+			expected: "cap_net_bind_service=ep",
+		},
+		{
+			name:     "unknown capability",
+			value:    capabilityXattrValue(vfsCapRevision2, 0, 0, 1<<(50-32), 0),
+			expected: "cap_50=p",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			caps, err := decodeCapabilities([]byte(test.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.CheckDeepEqual(t, test.expected, caps.String())
+		})
+	}
+	if _, err := decodeCapabilities([]byte(capabilityXattrValue(vfsCapRevision2, 0))); err == nil {
+		t.Error("expected an error decoding a truncated value")
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "cap_net_raw+ep", expected: "cap_net_raw=ep"},
+		{text: "CAP_NET_RAW=pe", expected: "cap_net_raw=ep"},
+		{text: "cap_kill,cap_chown=p cap_kill+e", expected: "cap_chown=p cap_kill=ep"},
+		{text: "none", expected: "none"},
+	}
+	for _, test := range tests {
+		caps, err := parseCapabilities(test.text)
+		if err != nil {
+			t.Fatalf("parsing %s: %s", test.text, err)
+		}
+		testutil.CheckDeepEqual(t, test.expected, caps.String())
+	}
+	for _, invalid := range []string{"cap_net_raw", "cap_net_raw+x", "cap_nothing+ep", "+ep"} {
+		if _, err := parseCapabilities(invalid); err == nil {
+			t.Errorf("expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestFileExistenceXattrs(t *testing.T) {
+	info := (&tar.Header{
+		Name:     "bin/ping",
+		Typeflag: tar.TypeReg,
+		Mode:     0755,
+		PAXRecords: map[string]string{
+			"SCHILY.xattr.security.capability": capabilityXattrValue(vfsCapRevision2|vfsCapEffective, 1<<13, 0, 0, 0),
+			"SCHILY.xattr.user.origin":         "vendor",
+			"mtime":                            "0",
+		},
+	}).FileInfo()
+	tests := []struct {
+		name     string
+		test     FileExistenceTest
+		expected []string
+	}{
+		{
+			name: "matching",
+			test: FileExistenceTest{
+				Capabilities: "cap_net_raw+ep",
+				Xattrs:       map[string]string{"user.origin": "^vendor$"},
+			},
+			expected: []string{},
+		},
+		{
+			name: "mismatching",
+			test: FileExistenceTest{
+				Capabilities: "cap_net_raw,cap_net_admin+ep",
+				Xattrs:       map[string]string{"user.origin": "^local$", "user.missing": ".*"},
+			},
+			expected: []string{
+				"/bin/ping has incorrect capabilities. Expected: cap_net_admin,cap_net_raw=ep, Actual: cap_net_raw=ep",
+				"/bin/ping has no extended attribute user.missing",
+				`/bin/ping has incorrect extended attribute user.origin. Expected: ^local$, Actual: "vendor"`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &types.TestResult{Pass: true, Errors: []string{}}
+			test.test.Path = "/bin/ping"
+			test.test.checkXattrs(context.Background(), nil, test.test.Path, info, result)
+			testutil.CheckDeepEqual(t, test.expected, result.Errors)
+		})
+	}
+}
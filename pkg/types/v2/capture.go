@@ -0,0 +1,258 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+var variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Capture stores part of the result of a command test into a variable, which later
+// tests can refer to as ${NAME}.
+type Capture struct {
+	Name  string `yaml:"name"`  // name of the variable
+	From  string `yaml:"from"`  // stdout (default), stderr or exitCode
+	Regex string `yaml:"regex"` // if set, the first group of the regex is captured, or the whole match if it has none
+}
+
+func (c Capture) validate(res *types.TestResult) {
+	if !variableNameRegex.MatchString(c.Name) {
+		res.Errorf("Invalid capture name '%s', expected e.g. PYTHON_PREFIX", c.Name)
+	}
+	switch c.From {
+	case "", "stdout", "stderr", "exitCode":
+	default:
+		res.Errorf("%s not recognised as a valid option for capture from, please use one of stdout, stderr or exitCode", c.From)
+	}
+	if c.Regex != "" {
+		validateRegexes(res, "capture", []string{c.Regex})
+	}
+}
+
+// value returns the captured value from the result of a command.
+func (c Capture) value(stdout, stderr string, exitCode int) (string, error) {
+	var value string
+	switch c.From {
+	case "stderr":
+		value = stderr
+	case "exitCode":
+		value = strconv.Itoa(exitCode)
+	default:
+		value = stdout
+	}
+	if c.Regex == "" {
+		return strings.TrimSpace(value), nil
+	}
+	r, err := regexp.Compile(c.Regex)
+	if err != nil {
+		return "", err
+	}
+	match := r.FindStringSubmatch(value)
+	if match == nil {
+		return "", fmt.Errorf("regex '%s' did not match '%s'", c.Regex, excerpt(value))
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
+
+// expand returns a copy of the test with the captured variables expanded in its
+// command, arguments, setup, teardown and env vars.
+func (ct CommandTest) expand(vars map[string]string) CommandTest {
+	ct.Command = utils.SubstituteVars(ct.Command, vars)
+	ct.Args = substituteAll(ct.Args, vars)
+	ct.Setup = substituteCommands(ct.Setup, vars)
+	ct.Teardown = substituteCommands(ct.Teardown, vars)
+	if ct.EnvVars != nil {
+		envVars := make([]types.EnvVar, len(ct.EnvVars))
+		for i, envVar := range ct.EnvVars {
+			envVar.Value = utils.SubstituteVars(envVar.Value, vars)
+			envVars[i] = envVar
+		}
+		ct.EnvVars = envVars
+	}
+	return ct
+}
+
+// references returns the names of all variables the test refers to.
+func (ct CommandTest) references() []string {
+	fields := append([]string{ct.Command}, ct.Args...)
+	for _, command := range append(append([][]string{}, ct.Setup...), ct.Teardown...) {
+		fields = append(fields, command...)
+	}
+	for _, envVar := range ct.EnvVars {
+		fields = append(fields, envVar.Value)
+	}
+	return references(fields...)
+}
+
+// references returns the names of all variables the test refers to.
+func (ft FileExistenceTest) references() []string {
+	return references(ft.Path)
+}
+
+// references returns the names of all variables the test refers to.
+func (ft FileContentTest) references() []string {
+	return references(ft.Path)
+}
+
+// references returns the names of all variables referred to in the given fields.
+func references(fields ...string) []string {
+	var names []string
+	for _, field := range fields {
+		os.Expand(field, func(key string) string {
+			names = append(names, key)
+			return ""
+		})
+	}
+	return names
+}
+
+// expand returns a copy of the test with the captured variables expanded in its path.
+func (ft FileExistenceTest) expand(vars map[string]string) FileExistenceTest {
+	ft.Path = utils.SubstituteVars(ft.Path, vars)
+	return ft
+}
+
+// expand returns a copy of the test with the captured variables expanded in its path.
+func (ft FileContentTest) expand(vars map[string]string) FileContentTest {
+	ft.Path = utils.SubstituteVars(ft.Path, vars)
+	return ft
+}
+
+// capturedBy returns the index of the first command test capturing each variable.
+func capturedBy(tests []CommandTest) map[string]int {
+	captured := map[string]int{}
+	for i, test := range tests {
+		for _, c := range test.Capture {
+			if _, ok := captured[c.Name]; !ok {
+				captured[c.Name] = i
+			}
+		}
+	}
+	return captured
+}
+
+// validateCaptures checks that command tests only refer to variables captured by
+// earlier tests, since they are run in order. The paths of file tests are never
+// expanded by anything else, so they may only refer to captured variables.
+func (st *StructureTest) validateCaptures() []types.ValidationError {
+	var errs []types.ValidationError
+	captured := capturedBy(st.CommandTests)
+	for i, test := range st.CommandTests {
+		for _, name := range test.references() {
+			if j, ok := captured[name]; ok && j >= i {
+				errs = append(errs, types.ValidationError{
+					Section: "commandTests",
+					Index:   i,
+					Message: fmt.Sprintf("${%s} is captured by test %s, which does not run before this one", name, st.CommandTests[j].Name),
+				})
+			}
+		}
+	}
+	uncaptured := func(section string, i int, references []string) {
+		for _, name := range references {
+			if _, ok := captured[name]; !ok {
+				errs = append(errs, types.ValidationError{
+					Section: section,
+					Index:   i,
+					Message: fmt.Sprintf("${%s} is not captured by any command test", name),
+				})
+			}
+		}
+	}
+	for i, test := range st.FileExistenceTests {
+		uncaptured("fileExistenceTests", i, test.references())
+	}
+	for i, test := range st.FileContentTests {
+		uncaptured("fileContentTests", i, test.references())
+	}
+	return errs
+}
+
+// skipCaptures records that the variables of a command test are not captured, as
+// the test is not run.
+func (st *StructureTest) skipCaptures(test CommandTest) {
+	if st.skippedVars == nil {
+		st.skippedVars = map[string]bool{}
+	}
+	for _, c := range test.Capture {
+		st.skippedVars[c.Name] = true
+	}
+}
+
+// uncaptured returns the result of a test which refers to variables a command test
+// should have captured, but did not, rather than running it with the literal
+// references. The test is skipped if the command tests capturing them were skipped,
+// and fails if they failed to run or to capture a value. It returns nil if every
+// variable was captured.
+func (st *StructureTest) uncaptured(logName string, references []string) *types.TestResult {
+	captured := capturedBy(st.CommandTests)
+	var errs, skipReasons []string
+	seen := map[string]bool{}
+	for _, name := range references {
+		i, ok := captured[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, ok := st.vars[name]; ok {
+			continue
+		}
+		if st.skippedVars[name] {
+			skipReasons = append(skipReasons, fmt.Sprintf("${%s} was not captured, as test %s was skipped", name, st.CommandTests[i].Name))
+		} else {
+			errs = append(errs, fmt.Sprintf("${%s} was not captured by test %s", name, st.CommandTests[i].Name))
+		}
+	}
+	switch {
+	case len(errs) > 0:
+		return &types.TestResult{Name: logName, Errors: append(errs, skipReasons...)}
+	case len(skipReasons) > 0:
+		return &types.TestResult{Name: logName, Skipped: true, SkipReason: strings.Join(skipReasons, ", ")}
+	}
+	return nil
+}
+
+func substituteAll(args []string, vars map[string]string) []string {
+	if args == nil {
+		return nil
+	}
+	subbed := make([]string, len(args))
+	for i, arg := range args {
+		subbed[i] = utils.SubstituteVars(arg, vars)
+	}
+	return subbed
+}
+
+func substituteCommands(commands [][]string, vars map[string]string) [][]string {
+	if commands == nil {
+		return nil
+	}
+	subbed := make([][]string, len(commands))
+	for i, command := range commands {
+		subbed[i] = substituteAll(command, vars)
+	}
+	return subbed
+}
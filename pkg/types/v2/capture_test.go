@@ -0,0 +1,149 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestCaptureValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		capture  Capture
+		expected string
+	}{
+		{
+			name:     "stdout is trimmed",
+			capture:  Capture{Name: "PREFIX"},
+			expected: "/usr/local",
+		},
+		{
+			name:     "regex group",
+			capture:  Capture{Name: "VERSION", From: "stderr", Regex: `Python (\d+\.\d+)`},
+			expected: "3.11",
+		},
+		{
+			name:     "exit code",
+			capture:  Capture{Name: "CODE", From: "exitCode"},
+			expected: "3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := test.capture.value("/usr/local\n", "Python 3.11.2\n", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.CheckDeepEqual(t, test.expected, value)
+		})
+	}
+}
+
+func TestCommandTestExpand(t *testing.T) {
+	test := CommandTest{
+		Command: "ls",
+		Args:    []string{"${PREFIX}/lib", "$HOME"},
+		EnvVars: []types.EnvVar{{Key: "PYTHONHOME", Value: "$PREFIX"}},
+	}
+	expanded := test.expand(map[string]string{"PREFIX": "/usr/local"})
+	// variables which were not captured are left for the image env substitution
+	testutil.CheckDeepEqual(t, []string{"/usr/local/lib", "${HOME}"}, expanded.Args)
+	testutil.CheckDeepEqual(t, "/usr/local", expanded.EnvVars[0].Value)
+	testutil.CheckDeepEqual(t, "$PREFIX", test.EnvVars[0].Value)
+}
+
+func TestValidateCaptures(t *testing.T) {
+	st := &StructureTest{
+		CommandTests: []CommandTest{
+			{Name: "uses prefix", Command: "ls", Args: []string{"${PREFIX}"}},
+			{Name: "prefix", Command: "python", Capture: []Capture{{Name: "PREFIX"}}},
+			{Name: "uses prefix again", Command: "ls", Args: []string{"${PREFIX}", "$HOME"}},
+		},
+		FileExistenceTests: []FileExistenceTest{
+			{Name: "site-packages", Path: "${PREFIX}/lib"},
+			{Name: "home", Path: "${HOME}/.profile"},
+		},
+		FileContentTests: []FileContentTest{{Name: "version", Path: "${VERSION_FILE}"}},
+	}
+	testutil.CheckDeepEqual(t, []types.ValidationError{
+		{
+			Section: "commandTests",
+			Index:   0,
+			Message: "${PREFIX} is captured by test prefix, which does not run before this one",
+		},
+		{
+			Section: "fileExistenceTests",
+			Index:   1,
+			Message: "${HOME} is not captured by any command test",
+		},
+		{
+			Section: "fileContentTests",
+			Index:   0,
+			Message: "${VERSION_FILE} is not captured by any command test",
+		},
+	}, st.validateCaptures())
+}
+
+func TestUncapturedVariables(t *testing.T) {
+	st := &StructureTest{
+		CommandTests: []CommandTest{
+			{Name: "version", Command: "cat", Capture: []Capture{{Name: "VERSION", Regex: "v([0-9]+)"}}},
+			{Name: "prefix", Command: "python", Capture: []Capture{{Name: "PREFIX"}}, Selection: Selection{Skip: true}},
+			{Name: "uses version", Command: "ls", Args: []string{"/opt/${VERSION}"}},
+			{Name: "lib", Command: "ls", Args: []string{"${PREFIX}/lib"}, Capture: []Capture{{Name: "LIB"}}},
+			{Name: "uses lib", Command: "ls", Args: []string{"${LIB}", "$HOME"}},
+			{Name: "uses both", Command: "ls", Args: []string{"${PREFIX}", "${VERSION}"}},
+		},
+		FileExistenceTests: []FileExistenceTest{{Name: "removed", Path: "${PREFIX}/lib", ShouldExist: false, Uid: defaultOwnership, Gid: defaultOwnership}},
+		FileContentTests:   []FileContentTest{{Name: "versioned", Path: "/opt/${VERSION}/README"}},
+	}
+	st.SetDriverImpl(func(args drivers.DriverConfig) (drivers.Driver, error) {
+		return fakeCommandDriver{runOpts: args.RunOpts}, nil
+	}, drivers.DriverConfig{})
+
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(context.Background(), channel, "")
+	st.RunFileExistenceTests(context.Background(), channel)
+	st.RunFileContentTests(context.Background(), channel)
+	close(channel)
+	var results []string
+	for r := range channel {
+		res := r.(*types.TestResult)
+		switch {
+		case res.Skipped:
+			results = append(results, fmt.Sprintf("%s: skipped: %s", res.Name, res.SkipReason))
+		case res.IsPass():
+			results = append(results, fmt.Sprintf("%s: pass", res.Name))
+		default:
+			results = append(results, fmt.Sprintf("%s: fail: %v", res.Name, res.Errors))
+		}
+	}
+	testutil.CheckDeepEqual(t, []string{
+		"Command Test: version: fail: [Error capturing VERSION: regex 'v([0-9]+)' did not match 'ok']",
+		"Command Test: prefix: skipped: skipped in config",
+		"Command Test: uses version: fail: [${VERSION} was not captured by test version]",
+		"Command Test: lib: skipped: ${PREFIX} was not captured, as test prefix was skipped",
+		"Command Test: uses lib: skipped: ${LIB} was not captured, as test lib was skipped",
+		"Command Test: uses both: fail: [${VERSION} was not captured by test version ${PREFIX} was not captured, as test prefix was skipped]",
+		"File Existence Test: removed: skipped: ${PREFIX} was not captured, as test prefix was skipped",
+		"File Content Test: versioned: fail: [${VERSION} was not captured by test version]",
+	}, results)
+}
@@ -15,7 +15,9 @@
 package v2
 
 import (
+	"context"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -37,6 +39,19 @@ type CommandTest struct {
 	ExcludedOutput []string       `yaml:"excludedOutput"`
 	ExpectedError  []string       `yaml:"expectedError"`
 	ExcludedError  []string       `yaml:"excludedError"` // excluded error from running command
+	OutputMatchers []Matcher      `yaml:"outputMatchers"`
+	ErrorMatchers  []Matcher      `yaml:"errorMatchers"`
+	Capture        []Capture      `yaml:"capture"`       // variables to store the result in, for later tests
+	Stdin          string         `yaml:"stdin"`         // data piped into the command
+	StdinFile      string         `yaml:"stdinFile"`     // host file piped into the command
+	Files          []FileFixture  `yaml:"files"`         // host files placed in the container before the command runs
+	User           string         `yaml:"user"`          // user to run the command as
+	WorkingDir     string         `yaml:"workingDir"`    // directory to run the command from
+	UseEntrypoint  bool           `yaml:"useEntrypoint"` // run the command and args through the image entrypoint
+
+	ContainerRunOptions *types.ContainerRunOptions `yaml:"containerRunOptions"` // overrides of the global run options
+
+	Selection `yaml:",inline"` // tags and skipping
 }
 
 func (ct *CommandTest) Validate(channel chan interface{}) bool {
@@ -45,9 +60,12 @@ func (ct *CommandTest) Validate(channel chan interface{}) bool {
 		res.Error("Please provide a valid name for every test")
 	}
 	res.Name = ct.Name
-	if ct.Command == "" {
+	if ct.Command == "" && !ct.UseEntrypoint {
 		res.Errorf("Please provide a valid command to run for test %s", ct.Name)
 	}
+	if ct.WorkingDir != "" && !path.IsAbs(ct.WorkingDir) {
+		res.Errorf("Please provide an absolute workingDir for test %s", ct.Name)
+	}
 	if ct.Setup != nil {
 		for _, c := range ct.Setup {
 			if len(c) == 0 {
@@ -69,6 +87,23 @@ func (ct *CommandTest) Validate(channel chan interface{}) bool {
 			}
 		}
 	}
+	validateRegexes(res, "expectedOutput", ct.ExpectedOutput)
+	validateRegexes(res, "excludedOutput", ct.ExcludedOutput)
+	validateRegexes(res, "expectedError", ct.ExpectedError)
+	validateRegexes(res, "excludedError", ct.ExcludedError)
+	validateMatchers(res, "outputMatchers", ct.OutputMatchers)
+	validateMatchers(res, "errorMatchers", ct.ErrorMatchers)
+	for _, c := range ct.Capture {
+		c.validate(res)
+	}
+	if ct.Stdin != "" && ct.StdinFile != "" {
+		res.Errorf("Please provide only one of stdin and stdinFile for test %s", ct.Name)
+	}
+	for _, f := range ct.Files {
+		f.validate(res)
+	}
+	validateRunOptions(res, ct.ContainerRunOptions)
+	ct.Selection.validate(res)
 	if len(res.Errors) > 0 {
 		channel <- res
 		return false
@@ -80,15 +115,24 @@ func (ct *CommandTest) LogName() string {
 	return fmt.Sprintf("Command Test: %s", ct.Name)
 }
 
-func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
+// Run runs the command of the test, storing the variables it captures into vars.
+func (ct *CommandTest) Run(ctx context.Context, driver drivers.Driver, vars map[string]string) *types.TestResult {
 	logrus.Debug(ct.LogName())
-	config, err := driver.GetConfig()
+	config := envConfig(ctx, driver)
+	fullCommand := ct.Args
+	if ct.Command != "" {
+		fullCommand = append([]string{ct.Command}, ct.Args...)
+	}
+	fullCommand = utils.SubstituteEnvVars(fullCommand, config.Env)
+	opts, err := ct.execOptions()
 	if err != nil {
-		logrus.Errorf("error retrieving image config: %s", err.Error())
+		return &types.TestResult{
+			Name:   ct.LogName(),
+			Errors: []string{err.Error()},
+		}
 	}
-	fullCommand := utils.SubstituteEnvVars(append([]string{ct.Command}, ct.Args...), config.Env)
 	start := time.Now()
-	stdout, stderr, exitcode, err := driver.ProcessCommand(ct.EnvVars, fullCommand)
+	stdout, stderr, exitcode, err := driver.ProcessCommand(ctx, ct.EnvVars, fullCommand, opts)
 	end := time.Now()
 	duration := end.Sub(start)
 	result := &types.TestResult{
@@ -106,6 +150,15 @@ func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
 	}
 
 	ct.CheckOutput(result, stdout, stderr, exitcode)
+	for _, c := range ct.Capture {
+		value, err := c.value(stdout, stderr, exitcode)
+		if err != nil {
+			result.Errorf("Error capturing %s: %s", c.Name, err.Error())
+			result.Fail()
+			continue
+		}
+		vars[c.Name] = value
+	}
 	return result
 }
 
@@ -134,6 +187,8 @@ func (ct *CommandTest) CheckOutput(result *types.TestResult, stdout string, stde
 			result.Fail()
 		}
 	}
+	checkMatchers(result, "output", stdout, ct.OutputMatchers)
+	checkMatchers(result, "error", stderr, ct.ErrorMatchers)
 	if ct.ExitCode != exitCode {
 		result.Errorf("Test '%s' exited with incorrect error code. Expected: %d, Actual: %d", ct.Name, ct.ExitCode, exitCode)
 		result.Fail()
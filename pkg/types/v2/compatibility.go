@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// compatibilityUID is the arbitrary UID command tests are re-run as in compatibility
+// mode. It is picked once per run, from the range OpenShift assigns UIDs from.
+var compatibilityUID = 1000000000 + rand.Intn(100000000)
+
+// compatibilityRunOptions hardens run options the way OpenShift and similar clusters
+// run images: as an arbitrary UID in the root group, with a read-only root
+// filesystem, no capabilities and no network.
+func compatibilityRunOptions(opts types.ContainerRunOptions) types.ContainerRunOptions {
+	opts.User = fmt.Sprintf("%d:0", compatibilityUID)
+	opts.Privileged = false
+	opts.ReadOnlyRootfs = true
+	opts.Capabilities = nil
+	opts.CapDrop = []string{"ALL"}
+	opts.NetworkMode = "none"
+	return opts
+}
+
+// runCompatibilityTest re-runs a command test which passes in the default run in
+// compatibility mode, and reports whether it still passes. All tests are skipped if
+// the driver ignores run options, since the rerun would then be the same as the
+// default run.
+func (st *StructureTest) runCompatibilityTest(ctx context.Context, test CommandTest) *types.TestResult {
+	name := fmt.Sprintf("Compatibility Test: %s", test.Name)
+	missing, err := st.missingCapabilities([]drivers.Capability{drivers.CapRunOptions})
+	if err != nil {
+		return &types.TestResult{
+			Name:   name,
+			Errors: []string{fmt.Sprintf("error creating driver: %s", err.Error())},
+		}
+	}
+	if len(missing) > 0 {
+		reason := "the driver does not apply container run options"
+		if st.DriverArgs.Strict {
+			return &types.TestResult{Name: name, Errors: []string{reason}}
+		}
+		return &types.TestResult{Name: name, Skipped: true, SkipReason: reason}
+	}
+	// the arbitrary UID replaces the user the test asks for
+	test.User = ""
+	runOpts := compatibilityRunOptions(st.ContainerRunOptions.Override(test.ContainerRunOptions))
+	// variables are only captured in the default run
+	result := st.runCommandTest(ctx, test, runOpts, map[string]string{})
+	result.Name = name
+	if !result.IsPass() {
+		result.Errors = append([]string{
+			fmt.Sprintf("Test passes in the default run, but fails as user %s with a read-only root filesystem, no capabilities and no network", runOpts.User),
+		}, result.Errors...)
+	}
+	return result
+}
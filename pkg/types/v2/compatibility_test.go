@@ -0,0 +1,175 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// fakeCommandDriver runs commands which write to the root filesystem, and so fail
+// when it is read-only.
+type fakeCommandDriver struct {
+	drivers.Driver
+	runOpts types.ContainerRunOptions
+}
+
+func (d fakeCommandDriver) SetEnv(context.Context, []types.EnvVar) error { return nil }
+
+func (d fakeCommandDriver) Setup(context.Context, []types.EnvVar, [][]string) error { return nil }
+
+func (d fakeCommandDriver) Teardown(context.Context, [][]string) error { return nil }
+
+func (d fakeCommandDriver) GetConfig(context.Context) (types.Config, error) {
+	return types.Config{}, nil
+}
+
+func (d fakeCommandDriver) Destroy() {}
+
+func (d fakeCommandDriver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{drivers.CapCommands, drivers.CapSetup, drivers.CapTeardown, drivers.CapMetadata, drivers.CapRunOptions}
+}
+
+func (d fakeCommandDriver) ProcessCommand(_ context.Context, _ []types.EnvVar, cmd []string, _ drivers.ExecOptions) (string, string, int, error) {
+	if cmd[0] == "write" && d.runOpts.ReadOnlyRootfs {
+		return "", "read-only file system", 1, nil
+	}
+	return "ok", "", 0, nil
+}
+
+func TestCompatibilityMode(t *testing.T) {
+	st := &StructureTest{
+		CommandTests: []CommandTest{
+			{Name: "reads", Command: "read"},
+			{Name: "writes", Command: "write"},
+			{Name: "fails", Command: "read", ExitCode: 2},
+		},
+		ContainerRunOptions: types.ContainerRunOptions{Capabilities: []string{"NET_ADMIN"}},
+	}
+	var runs []types.ContainerRunOptions
+	st.SetDriverImpl(func(args drivers.DriverConfig) (drivers.Driver, error) {
+		runs = append(runs, args.RunOpts)
+		return fakeCommandDriver{runOpts: args.RunOpts}, nil
+	}, drivers.DriverConfig{Compatibility: true})
+
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(context.Background(), channel, "")
+	close(channel)
+	var results []string
+	var failed *types.TestResult
+	for r := range channel {
+		res := r.(*types.TestResult)
+		status := "pass"
+		if res.Skipped {
+			status = "skip"
+		} else if !res.IsPass() {
+			status = "fail"
+		}
+		results = append(results, fmt.Sprintf("%s: %s", res.Name, status))
+		if res.Name == "Command Test: fails" {
+			failed = res
+		}
+	}
+	testutil.CheckDeepEqual(t, []string{
+		"Command Test: reads: pass",
+		"Compatibility Test: reads: pass",
+		"Command Test: writes: pass",
+		"Compatibility Test: writes: fail",
+		"Command Test: fails: fail",
+	}, results)
+	// a test which already fails is not re-run, and says so in its own result
+	testutil.CheckDeepEqual(t, "Not compared in compatibility mode, as the test fails in the default run", failed.Errors[len(failed.Errors)-1])
+
+	// the first driver is only created to retrieve the capabilities of the driver
+	hardened := runs[2]
+	testutil.CheckDeepEqual(t, fmt.Sprintf("%d:0", compatibilityUID), hardened.User)
+	testutil.CheckDeepEqual(t, []string{"ALL"}, hardened.CapDrop)
+	testutil.CheckDeepEqual(t, "none", hardened.NetworkMode)
+	if !hardened.ReadOnlyRootfs || hardened.Capabilities != nil {
+		t.Errorf("expected a read-only root filesystem and no capabilities, got %+v", hardened)
+	}
+}
+
+// envDriver records the env vars of the commands it runs.
+type envDriver struct {
+	fakeCommandDriver
+	envs *[][]types.EnvVar
+}
+
+func (d envDriver) ProcessCommand(_ context.Context, envVars []types.EnvVar, _ []string, _ drivers.ExecOptions) (string, string, int, error) {
+	*d.envs = append(*d.envs, envVars)
+	return "ok", "", 0, nil
+}
+
+func TestCompatibilityModeKeepsEnv(t *testing.T) {
+	st := &StructureTest{
+		CommandTests: []CommandTest{{
+			Name:    "env",
+			Command: "env",
+			EnvVars: []types.EnvVar{{Key: "FOO", Value: "bar"}},
+		}},
+	}
+	var envs [][]types.EnvVar
+	st.SetDriverImpl(func(args drivers.DriverConfig) (drivers.Driver, error) {
+		return envDriver{fakeCommandDriver: fakeCommandDriver{runOpts: args.RunOpts}, envs: &envs}, nil
+	}, drivers.DriverConfig{Compatibility: true})
+
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(context.Background(), channel, "")
+	close(channel)
+	expected := []types.EnvVar{{Key: "FOO", Value: "bar"}}
+	testutil.CheckDeepEqual(t, [][]types.EnvVar{expected, expected}, envs)
+}
+
+// runOptionsIgnoringDriver runs commands without applying container run options, as
+// the tar and host drivers do.
+type runOptionsIgnoringDriver struct {
+	fakeCommandDriver
+}
+
+func (d runOptionsIgnoringDriver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{drivers.CapCommands, drivers.CapSetup, drivers.CapTeardown}
+}
+
+func TestCompatibilityModeUnsupported(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		st := &StructureTest{CommandTests: []CommandTest{{Name: "reads", Command: "read"}}}
+		st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+			return runOptionsIgnoringDriver{}, nil
+		}, drivers.DriverConfig{Compatibility: true, Strict: strict})
+
+		channel := make(chan interface{}, 10)
+		st.RunCommandTests(context.Background(), channel, "")
+		close(channel)
+		var results []*types.TestResult
+		for r := range channel {
+			results = append(results, r.(*types.TestResult))
+		}
+		testutil.CheckDeepEqual(t, 2, len(results))
+		res := results[1]
+		testutil.CheckDeepEqual(t, "Compatibility Test: reads", res.Name)
+		if strict {
+			testutil.CheckDeepEqual(t, []string{"the driver does not apply container run options"}, res.Errors)
+		} else {
+			testutil.CheckDeepEqual(t, true, res.Skipped)
+			testutil.CheckDeepEqual(t, "the driver does not apply container run options", res.SkipReason)
+		}
+	}
+}
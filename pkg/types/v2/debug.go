@@ -0,0 +1,90 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// DebugShell is the shell opened in the environment of a test, unless another one
+// is given.
+const DebugShell = "/bin/sh"
+
+// DebugCommandTest rebuilds the environment of the named command test, as left by
+// its setup commands, and returns its driver along with the command which opens a
+// shell in it. The caller destroys the driver once done. Variables captured by
+// other tests are only available once those have run.
+func (st *StructureTest) DebugCommandTest(ctx context.Context, name string, shell string) (drivers.Driver, []string, error) {
+	var names []string
+	for _, test := range st.CommandTests {
+		names = append(names, test.Name)
+	}
+	for _, test := range st.CommandTests {
+		if test.Name != name {
+			continue
+		}
+		test = test.expand(st.vars)
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions.Override(test.ContainerRunOptions))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "creating driver")
+		}
+		debugDriver, ok := driver.(drivers.DebugDriver)
+		if !ok {
+			driver.Destroy()
+			return nil, nil, errors.New("the driver cannot open a shell in the environment of a test, use the docker driver")
+		}
+		if err = driver.SetEnv(ctx, st.GlobalEnvVars); err != nil {
+			driver.Destroy()
+			return nil, nil, errors.Wrap(err, "setting env vars")
+		}
+		if err = driver.Setup(ctx, test.EnvVars, test.Setup); err != nil {
+			driver.Destroy()
+			return nil, nil, errors.Wrap(err, "running setup")
+		}
+		return driver, debugDriver.DebugCommand(test.EnvVars, debugExecOptions(test), shell), nil
+	}
+	return nil, nil, errors.Errorf("no command test named %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// keepForDebugging leaves the environment of a failing command test behind, as its
+// command left it, and sets the command which opens a shell in it in the result of
+// the test.
+func (st *StructureTest) keepForDebugging(ctx context.Context, driver drivers.Driver, test CommandTest, res *types.TestResult) {
+	debugDriver, ok := driver.(drivers.DebugDriver)
+	if !ok {
+		return
+	}
+	if err := debugDriver.Keep(ctx); err != nil {
+		res.Errorf("error keeping the environment of the test for debugging: %s", err.Error())
+		return
+	}
+	res.Debug = utils.ShellJoin(debugDriver.DebugCommand(test.EnvVars, debugExecOptions(test), DebugShell))
+}
+
+// debugExecOptions returns the options of the shell opened in the environment of a
+// command test. Stdin and fixture files only exist for the command of the test.
+func debugExecOptions(test CommandTest) drivers.ExecOptions {
+	return drivers.ExecOptions{
+		User:       test.User,
+		WorkingDir: test.WorkingDir,
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// debuggingDriver records the steps run in it, and opens shells with echo.
+type debuggingDriver struct {
+	savingDriver
+	steps *[]string
+}
+
+func (d debuggingDriver) Setup(_ context.Context, _ []types.EnvVar, cmds [][]string) error {
+	for _, cmd := range cmds {
+		*d.steps = append(*d.steps, "setup "+strings.Join(cmd, " "))
+	}
+	return nil
+}
+
+func (d debuggingDriver) Teardown(context.Context, [][]string) error {
+	*d.steps = append(*d.steps, "teardown")
+	return nil
+}
+
+func (d debuggingDriver) DebugCommand(envVars []types.EnvVar, opts drivers.ExecOptions, shell string) []string {
+	cmd := []string{"echo"}
+	for _, e := range envVars {
+		cmd = append(cmd, e.Key+"="+e.Value)
+	}
+	return append(cmd, opts.User, shell)
+}
+
+func (d debuggingDriver) Keep(context.Context) error {
+	*d.steps = append(*d.steps, "keep")
+	return nil
+}
+
+func TestDebugCommandTest(t *testing.T) {
+	var steps []string
+	st := &StructureTest{
+		CommandTests: []CommandTest{
+			{Name: "other", Command: "true"},
+			{
+				Name:    "failing",
+				Command: "true",
+				Setup:   [][]string{{"touch", "/${FILE}"}},
+				EnvVars: []types.EnvVar{{Key: "MODE", Value: "debug"}},
+				User:    "app",
+			},
+		},
+	}
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		return debuggingDriver{steps: &steps}, nil
+	}, drivers.DriverConfig{})
+	st.vars = map[string]string{"FILE": "marker"}
+
+	_, cmd, err := st.DebugCommandTest(context.Background(), "failing", "bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{"echo", "MODE=debug", "app", "bash"}, cmd)
+	testutil.CheckDeepEqual(t, []string{"setup touch /marker"}, steps)
+
+	if _, _, err := st.DebugCommandTest(context.Background(), "missing", "bash"); err == nil || !strings.Contains(err.Error(), "other, failing") {
+		t.Errorf("expected the names of the tests in the error, got %v", err)
+	}
+
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		return fakeCommandDriver{}, nil
+	}, drivers.DriverConfig{})
+	if _, _, err := st.DebugCommandTest(context.Background(), "failing", "bash"); err == nil {
+		t.Error("expected an error with a driver which cannot debug")
+	}
+}
+
+func TestDebugOnFailure(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		var steps []string
+		st := &StructureTest{
+			CommandTests: []CommandTest{
+				{Name: "passes", Command: "read"},
+				{Name: "fails", Command: "read", ExitCode: 2, User: "app"},
+			},
+		}
+		st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+			return debuggingDriver{steps: &steps}, nil
+		}, drivers.DriverConfig{DebugOnFailure: debug})
+
+		channel := make(chan interface{}, 2)
+		st.RunCommandTests(context.Background(), channel, "")
+		passed, failed := (<-channel).(*types.TestResult), (<-channel).(*types.TestResult)
+		testutil.CheckDeepEqual(t, "", passed.Debug)
+		if !debug {
+			testutil.CheckDeepEqual(t, "", failed.Debug)
+			testutil.CheckDeepEqual(t, []string{"teardown", "teardown"}, steps)
+			continue
+		}
+		// the failing test is kept as it is, without running its teardown
+		testutil.CheckDeepEqual(t, "echo app /bin/sh", failed.Debug)
+		testutil.CheckDeepEqual(t, []string{"container"}, failed.Containers)
+		testutil.CheckDeepEqual(t, []string{"teardown", "keep"}, steps)
+	}
+}
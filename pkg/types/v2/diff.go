@@ -0,0 +1,148 @@
+// Copyright 2017 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/internal/pkgutil"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+type DiffTest struct {
+	Name             string   `yaml:"name"`             // name of test
+	BaselineImage    string   `yaml:"baselineImage"`    // image to compare against, defaults to --baseline-image
+	AllowedPaths     []string `yaml:"allowedPaths"`     // if set, any change outside of these paths is a violation
+	NoAdditions      []string `yaml:"noAdditions"`      // paths under which no files may be added
+	NoRemovals       []string `yaml:"noRemovals"`       // paths under which no files may be removed
+	NoModifications  []string `yaml:"noModifications"`  // paths under which no files may be modified
+	MaxAddedPackages *int     `yaml:"maxAddedPackages"` // maximum number of packages added on top of the baseline
+
+	Selection `yaml:",inline"` // tags and skipping
+}
+
+func (dt DiffTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if dt.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = dt.Name
+	if dt.MaxAddedPackages != nil && *dt.MaxAddedPackages < 0 {
+		res.Errorf("maxAddedPackages cannot be negative for test %s", dt.Name)
+	}
+	dt.Selection.validate(res)
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (dt DiffTest) LogName() string {
+	return fmt.Sprintf("Diff Test: %s", dt.Name)
+}
+
+// Run compares the filesystem and packages of the image under test against the baseline image.
+func (dt DiffTest) Run(image, baseline pkgutil.Image) *types.TestResult {
+	result := &types.TestResult{
+		Name:   dt.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(dt.LogName())
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	baselineDir, err := pkgutil.GetDirectory(baseline.FSPath, true)
+	if err != nil {
+		result.Errorf("Error reading baseline image filesystem: %s", err)
+		result.Fail()
+		return result
+	}
+	imageDir, err := pkgutil.GetDirectory(image.FSPath, true)
+	if err != nil {
+		result.Errorf("Error reading image filesystem: %s", err)
+		result.Fail()
+		return result
+	}
+	diff, err := pkgutil.DiffDirectory(baselineDir, imageDir)
+	if err != nil {
+		result.Errorf("Error diffing image filesystems: %s", err)
+		result.Fail()
+		return result
+	}
+
+	dt.checkPaths(result, "Added", diff.Adds, dt.NoAdditions)
+	dt.checkPaths(result, "Removed", diff.Dels, dt.NoRemovals)
+	dt.checkPaths(result, "Modified", diff.Mods, dt.NoModifications)
+
+	if dt.MaxAddedPackages != nil {
+		readFrom := func(root string) func(string) ([]byte, error) {
+			return func(path string) ([]byte, error) {
+				return os.ReadFile(filepath.Join(root, path))
+			}
+		}
+		baselinePackages := utils.GetPackages(readFrom(baseline.FSPath))
+		imagePackages := utils.GetPackages(readFrom(image.FSPath))
+		added := []string{}
+		for name := range imagePackages {
+			if _, ok := baselinePackages[name]; !ok {
+				added = append(added, name)
+			}
+		}
+		sort.Strings(added)
+		if len(added) > *dt.MaxAddedPackages {
+			result.Errorf("%d packages added, expected at most %d: %v", len(added), *dt.MaxAddedPackages, added)
+			result.Fail()
+		}
+	}
+	return result
+}
+
+// checkPaths records a violation for every changed path which is either under one of
+// the forbidden paths, or outside of all allowed paths.
+func (dt DiffTest) checkPaths(result *types.TestResult, change string, paths []string, forbidden []string) {
+	for _, p := range paths {
+		if prefix, ok := underAnyPath(p, forbidden); ok {
+			result.Errorf("%s: %s (no changes of this kind allowed under %s)", change, p, prefix)
+			result.Fail()
+			continue
+		}
+		if len(dt.AllowedPaths) > 0 {
+			if _, ok := underAnyPath(p, dt.AllowedPaths); !ok {
+				result.Errorf("%s: %s (not under any allowed path)", change, p)
+				result.Fail()
+			}
+		}
+	}
+}
+
+func underAnyPath(path string, prefixes []string) (string, bool) {
+	for _, prefix := range prefixes {
+		if pkgutil.HasFilepathPrefix(path, prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
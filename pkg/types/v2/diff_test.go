@@ -0,0 +1,91 @@
+// Copyright 2017 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestUnderAnyPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		prefixes []string
+		expected string
+		ok       bool
+	}{
+		{name: "root", path: "/etc/foo", prefixes: []string{"/"}, expected: "/", ok: true},
+		{name: "same path", path: "/usr", prefixes: []string{"/usr"}, expected: "/usr", ok: true},
+		{name: "nested", path: "/usr/lib/libc.so", prefixes: []string{"/usr"}, expected: "/usr", ok: true},
+		{name: "trailing slash", path: "/usr/lib", prefixes: []string{"/usr/"}, expected: "/usr/", ok: true},
+		{name: "sibling", path: "/usrlocal/bin", prefixes: []string{"/usr"}},
+		{name: "parent", path: "/usr", prefixes: []string{"/usr/lib"}},
+		{name: "second prefix", path: "/var/log", prefixes: []string{"/etc", "/var"}, expected: "/var", ok: true},
+		{name: "no prefixes", path: "/etc/foo"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefix, ok := underAnyPath(test.path, test.prefixes)
+			testutil.CheckDeepEqual(t, test.ok, ok)
+			testutil.CheckDeepEqual(t, test.expected, prefix)
+		})
+	}
+}
+
+func TestCheckPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowed   []string
+		forbidden []string
+		paths     []string
+		expected  []string
+	}{
+		{
+			name:    "everything allowed under root",
+			allowed: []string{"/"},
+			paths:   []string{"/etc/foo", "/usr/bin/tool"},
+		},
+		{
+			name:     "outside of the allowed paths",
+			allowed:  []string{"/usr"},
+			paths:    []string{"/usr/bin/tool", "/usrlocal/bin/tool"},
+			expected: []string{"added: /usrlocal/bin/tool (not under any allowed path)"},
+		},
+		{
+			name:      "forbidden under an allowed path",
+			allowed:   []string{"/"},
+			forbidden: []string{"/etc"},
+			paths:     []string{"/etc/passwd", "/etcetera"},
+			expected:  []string{"added: /etc/passwd (no changes of this kind allowed under /etc)"},
+		},
+		{
+			name:      "forbidden root",
+			forbidden: []string{"/"},
+			paths:     []string{"/app"},
+			expected:  []string{"added: /app (no changes of this kind allowed under /)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &types.TestResult{Pass: true}
+			DiffTest{AllowedPaths: test.allowed}.checkPaths(result, "added", test.paths, test.forbidden)
+			testutil.CheckDeepEqual(t, test.expected, result.Errors)
+			testutil.CheckDeepEqual(t, len(test.expected) == 0, result.IsPass())
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package v2
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
@@ -25,10 +26,13 @@ import (
 )
 
 type FileContentTest struct {
-	Name             string   `yaml:"name"`             // name of test
-	Path             string   `yaml:"path"`             // file to check existence of
-	ExpectedContents []string `yaml:"expectedContents"` // list of expected contents of file
-	ExcludedContents []string `yaml:"excludedContents"` // list of excluded contents of file
+	Name             string    `yaml:"name"`             // name of test
+	Path             string    `yaml:"path"`             // file to check existence of
+	ExpectedContents []string  `yaml:"expectedContents"` // list of expected contents of file
+	ExcludedContents []string  `yaml:"excludedContents"` // list of excluded contents of file
+	ContentMatchers  []Matcher `yaml:"contentMatchers"`  // list of matchers on the contents of file
+
+	Selection `yaml:",inline"` // tags and skipping
 }
 
 func (ft FileContentTest) Validate(channel chan interface{}) bool {
@@ -40,6 +44,10 @@ func (ft FileContentTest) Validate(channel chan interface{}) bool {
 	if ft.Path == "" {
 		res.Errorf("Please provide a valid file path for test %s", ft.Name)
 	}
+	validateRegexes(res, "expectedContents", ft.ExpectedContents)
+	validateRegexes(res, "excludedContents", ft.ExcludedContents)
+	validateMatchers(res, "contentMatchers", ft.ContentMatchers)
+	ft.Selection.validate(res)
 	if len(res.Errors) > 0 {
 		channel <- res
 		return false
@@ -51,14 +59,14 @@ func (ft FileContentTest) LogName() string {
 	return fmt.Sprintf("File Content Test: %s", ft.Name)
 }
 
-func (ft FileContentTest) Run(driver drivers.Driver) *types.TestResult {
+func (ft FileContentTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name:   ft.LogName(),
 		Pass:   true,
 		Errors: make([]string, 0),
 	}
 	logrus.Info(ft.LogName())
-	actualContents, err := driver.ReadFile(ft.Path)
+	actualContents, err := driver.ReadFile(ctx, ft.Path)
 	if err != nil {
 		result.Errorf("Failed to open %s. Error: %s", ft.Path, err)
 		result.Fail()
@@ -79,5 +87,6 @@ func (ft FileContentTest) Run(driver drivers.Driver) *types.TestResult {
 			result.Fail()
 		}
 	}
+	checkMatchers(result, "file content", contents, ft.ContentMatchers)
 	return result
 }
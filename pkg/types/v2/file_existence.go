@@ -16,6 +16,7 @@ package v2
 
 import (
 	"archive/tar"
+	"context"
 	"fmt"
 	"os"
 
@@ -37,6 +38,11 @@ type FileExistenceTest struct {
 	Uid            int    `yaml:"uid"`            // ID of the owner of the file
 	Gid            int    `yaml:"gid"`            // ID of the group of the file
 	IsExecutableBy string `yaml:"isExecutableBy"` // name of group that file should be executable by
+
+	Capabilities string            `yaml:"capabilities"` // expected file capabilities in getcap form, e.g. cap_net_raw+ep, or none
+	Xattrs       map[string]string `yaml:"xattrs"`       // regexes which extended attributes of the file must match
+
+	Selection `yaml:",inline"` // tags and skipping
 }
 
 func (fe FileExistenceTest) MarshalYAML() (interface{}, error) {
@@ -69,6 +75,23 @@ func (ft FileExistenceTest) Validate(channel chan interface{}) bool {
 	if ft.Path == "" {
 		res.Errorf("Please provide a valid file path for test %s", ft.Name)
 	}
+	if ft.Permissions != "" && !permissionsRegex.MatchString(ft.Permissions) {
+		res.Errorf("Invalid permissions string %s for test %s, expected e.g. -rwxr-xr-x", ft.Permissions, ft.Name)
+	}
+	switch ft.IsExecutableBy {
+	case "", "any", "owner", "group", "other":
+	default:
+		res.Errorf("%s not recognised as a valid option for isExecutableBy, please use one of owner, group, other or any", ft.IsExecutableBy)
+	}
+	if ft.Capabilities != "" {
+		if _, err := parseCapabilities(ft.Capabilities); err != nil {
+			res.Errorf("Invalid capabilities %s for test %s: %s", ft.Capabilities, ft.Name, err)
+		}
+	}
+	for _, name := range sortedKeys(ft.Xattrs) {
+		validateRegexes(res, "xattrs."+name, []string{ft.Xattrs[name]})
+	}
+	ft.Selection.validate(res)
 	if len(res.Errors) > 0 {
 		channel <- res
 		return false
@@ -80,19 +103,16 @@ func (ft FileExistenceTest) LogName() string {
 	return fmt.Sprintf("File Existence Test: %s", ft.Name)
 }
 
-func (ft FileExistenceTest) Run(driver drivers.Driver) *types.TestResult {
+func (ft FileExistenceTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name:   ft.LogName(),
 		Pass:   true,
 		Errors: make([]string, 0),
 	}
 	logrus.Info(ft.LogName())
-	var info os.FileInfo
-	config, err := driver.GetConfig()
-	if err != nil {
-		logrus.Errorf("error retrieving image config: %s", err.Error())
-	}
-	info, err = driver.StatFile(utils.SubstituteEnvVar(ft.Path, config.Env))
+	config := envConfig(ctx, driver)
+	path := utils.SubstituteEnvVar(ft.Path, config.Env)
+	info, err := driver.StatFile(ctx, path)
 	if info == nil && ft.ShouldExist {
 		result.Errorf(errors.Wrap(err, "Error examining file in container").Error())
 		result.Fail()
@@ -162,5 +182,43 @@ func (ft FileExistenceTest) Run(driver drivers.Driver) *types.TestResult {
 			result.Fail()
 		}
 	}
+	if ft.Capabilities != "" || len(ft.Xattrs) > 0 {
+		ft.checkXattrs(ctx, driver, path, info, result)
+	}
 	return result
 }
+
+func (ft FileExistenceTest) checkXattrs(ctx context.Context, driver drivers.Driver, path string, info os.FileInfo, result *types.TestResult) {
+	xattrs, err := fileXattrs(ctx, driver, path, info)
+	if err != nil {
+		result.Errorf("Error checking extended attributes of file %s: %s", ft.Path, err)
+		result.Fail()
+		return
+	}
+	if ft.Capabilities != "" {
+		expected, _ := parseCapabilities(ft.Capabilities)
+		actual := capabilities{}
+		if value, ok := xattrs[capabilityXattr]; ok {
+			if actual, err = decodeCapabilities([]byte(value)); err != nil {
+				result.Errorf("Error checking capabilities of file %s: %s", ft.Path, err)
+				result.Fail()
+			}
+		}
+		if err == nil && !expected.equals(actual) {
+			result.Errorf("%s has incorrect capabilities. Expected: %s, Actual: %s", ft.Path, expected, actual)
+			result.Fail()
+		}
+	}
+	for _, name := range sortedKeys(ft.Xattrs) {
+		value, ok := xattrs[name]
+		if !ok {
+			result.Errorf("%s has no extended attribute %s", ft.Path, name)
+			result.Fail()
+			continue
+		}
+		if !utils.CompileAndRunRegex(ft.Xattrs[name], value, true) {
+			result.Errorf("%s has incorrect extended attribute %s. Expected: %s, Actual: %q", ft.Path, name, ft.Xattrs[name], value)
+			result.Fail()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+const defaultFixtureMode = 0644
+
+// FileFixture is a file on the host which is placed in the container before the
+// command of a test runs.
+type FileFixture struct {
+	Source string `yaml:"source"` // path on the host
+	Target string `yaml:"target"` // path in the container, relative paths are resolved against the working directory
+	Mode   string `yaml:"mode"`   // octal permissions of the file, e.g. "0755", defaults to "0644"
+}
+
+func (f FileFixture) validate(res *types.TestResult) {
+	if f.Source == "" || f.Target == "" {
+		res.Error("Please provide a source and a target for every file")
+	}
+	if f.Mode != "" {
+		if _, err := parseMode(f.Mode); err != nil {
+			res.Errorf("Invalid mode %s for file %s, expected e.g. 0755", f.Mode, f.Target)
+		}
+	}
+}
+
+// configPath resolves a path on the host relative to the config file it was
+// declared in, as the working directory the tests are run from may be any other.
+func configPath(configFile string, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(configFile), p)
+}
+
+// resolvePaths returns the test with its stdin and fixture files resolved relative
+// to the config file.
+func (ct CommandTest) resolvePaths(configFile string) CommandTest {
+	ct.StdinFile = configPath(configFile, ct.StdinFile)
+	files := make([]FileFixture, len(ct.Files))
+	for i, f := range ct.Files {
+		f.Source = configPath(configFile, f.Source)
+		files[i] = f
+	}
+	if ct.Files != nil {
+		ct.Files = files
+	}
+	return ct
+}
+
+// execOptions reads the stdin and fixture files of the test from the host, and
+// sets the overrides of the environment the command is run in.
+func (ct *CommandTest) execOptions() (drivers.ExecOptions, error) {
+	opts := drivers.ExecOptions{
+		User:          ct.User,
+		WorkingDir:    ct.WorkingDir,
+		UseEntrypoint: ct.UseEntrypoint,
+	}
+	if ct.Stdin != "" {
+		opts.Stdin = []byte(ct.Stdin)
+	}
+	if ct.StdinFile != "" {
+		stdin, err := os.ReadFile(ct.StdinFile)
+		if err != nil {
+			return opts, errors.Wrap(err, "reading stdinFile")
+		}
+		opts.Stdin = stdin
+	}
+	for _, f := range ct.Files {
+		contents, err := os.ReadFile(f.Source)
+		if err != nil {
+			return opts, errors.Wrapf(err, "reading file %s", f.Source)
+		}
+		mode := os.FileMode(defaultFixtureMode)
+		if f.Mode != "" {
+			if mode, err = parseMode(f.Mode); err != nil {
+				return opts, err
+			}
+		}
+		opts.Files = append(opts.Files, drivers.File{
+			Target:   f.Target,
+			Mode:     mode,
+			Contents: contents,
+		})
+	}
+	return opts, nil
+}
+
+func parseMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if m > 0777 {
+		return 0, errors.Errorf("mode %s has more than permission bits", mode)
+	}
+	return os.FileMode(m), nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+const defaultRequestTimeout = 10 * time.Second
+
+// HTTPTest starts the image as a service, and makes a request to one of its ports.
+type HTTPTest struct {
+	Name            string            `yaml:"name"`
+	EnvVars         []types.EnvVar    `yaml:"envVars"`
+	Ready           Readiness         `yaml:"ready"`           // conditions to meet before the request, defaults to the port being open
+	Port            string            `yaml:"port"`            // port of the service to send the request to
+	Method          string            `yaml:"method"`          // defaults to GET
+	Path            string            `yaml:"path"`            // defaults to /
+	Headers         map[string]string `yaml:"headers"`         // headers of the request
+	Body            string            `yaml:"body"`            // body of the request
+	TLS             *TLSConfig        `yaml:"tls"`             // if set, the request is made over https
+	ExpectedStatus  int               `yaml:"expectedStatus"`  // defaults to 200
+	ExpectedHeaders map[string]string `yaml:"expectedHeaders"` // regexes matched against the response headers
+	ExpectedBody    []string          `yaml:"expectedBody"`    // regexes which must match the response body
+	ExcludedBody    []string          `yaml:"excludedBody"`    // regexes which must not match the response body
+	BodyMatchers    []Matcher         `yaml:"bodyMatchers"`    // matchers on the response body, e.g. with a jsonPath
+	MaxResponseTime string            `yaml:"maxResponseTime"` // time the response may take, if set
+
+	ContainerRunOptions *types.ContainerRunOptions `yaml:"containerRunOptions"` // overrides of the global run options
+
+	Selection `yaml:",inline"` // tags and skipping
+}
+
+// TLSConfig configures how the certificate of the service is verified.
+type TLSConfig struct {
+	CACert             string `yaml:"caCert"`             // PEM file on the host with the CA to trust
+	ServerName         string `yaml:"serverName"`         // name to verify the certificate for, instead of the address
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"` // do not verify the certificate
+}
+
+// resolvePaths returns the test with its CA certificate resolved relative to the
+// config file.
+func (ht HTTPTest) resolvePaths(configFile string) HTTPTest {
+	if ht.TLS != nil {
+		tls := *ht.TLS
+		tls.CACert = configPath(configFile, tls.CACert)
+		ht.TLS = &tls
+	}
+	return ht
+}
+
+func (ht HTTPTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if ht.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = ht.Name
+	if ht.Port == "" {
+		res.Errorf("Please provide a port for test %s", ht.Name)
+	}
+	validatePort(res, "port", ht.Port)
+	if ht.Path != "" && !strings.HasPrefix(ht.Path, "/") {
+		res.Errorf("Please provide a path starting with / for test %s", ht.Name)
+	}
+	validateStatus(res, "expectedStatus", ht.ExpectedStatus)
+	for _, header := range sortedKeys(ht.ExpectedHeaders) {
+		validateRegexes(res, "expectedHeaders."+header, []string{ht.ExpectedHeaders[header]})
+	}
+	validateRegexes(res, "expectedBody", ht.ExpectedBody)
+	validateRegexes(res, "excludedBody", ht.ExcludedBody)
+	validateMatchers(res, "bodyMatchers", ht.BodyMatchers)
+	validateDuration(res, "maxResponseTime", ht.MaxResponseTime)
+	ht.Ready.validate(res)
+	if ht.TLS != nil && ht.TLS.CACert != "" && ht.TLS.InsecureSkipVerify {
+		res.Errorf("Please provide only one of tls.caCert and tls.insecureSkipVerify for test %s", ht.Name)
+	}
+	validateRunOptions(res, ht.ContainerRunOptions)
+	ht.Selection.validate(res)
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (ht HTTPTest) LogName() string {
+	return fmt.Sprintf("HTTP Test: %s", ht.Name)
+}
+
+func (ht HTTPTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   ht.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(ht.LogName())
+	serviceDriver, ok := driver.(drivers.ServiceDriver)
+	if !ok {
+		result.Error("http tests are not supported by this driver")
+		result.Fail()
+		return result
+	}
+	ready := ht.Ready
+	if ready.LogLine == "" && ready.TCPPort == "" && ready.HTTP == nil && !ready.Healthcheck {
+		ready.TCPPort = ht.Port
+	}
+	ports := ready.ports()
+	if !contains(ports, ht.Port) {
+		ports = append(ports, ht.Port)
+	}
+	service, err := serviceDriver.StartService(ctx, ht.EnvVars, ports)
+	if err != nil {
+		result.Errorf("error starting service: %s", err.Error())
+		result.Fail()
+		return result
+	}
+	defer service.Remove()
+	if err := ready.wait(ctx, service); err != nil {
+		result.Errorf("service did not become ready: %s", err.Error())
+		result.Fail()
+		return result
+	}
+	addr, err := service.Address(ht.Port)
+	if err != nil {
+		result.Error(err.Error())
+		result.Fail()
+		return result
+	}
+	ht.check(ctx, result, addr)
+	return result
+}
+
+// check makes the request of the test to the address, and records whether the
+// response is as expected in the result.
+func (ht HTTPTest) check(ctx context.Context, result *types.TestResult, addr string) {
+	client, err := ht.client()
+	if err != nil {
+		result.Error(err.Error())
+		result.Fail()
+		return
+	}
+	scheme := "http"
+	if ht.TLS != nil {
+		scheme = "https"
+	}
+	path := ht.Path
+	if path == "" {
+		path = "/"
+	}
+	method := ht.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, addr, path)
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, strings.NewReader(ht.Body))
+	if err != nil {
+		result.Errorf("error creating request: %s", err.Error())
+		result.Fail()
+		return
+	}
+	for _, header := range sortedKeys(ht.Headers) {
+		req.Header.Set(header, ht.Headers[header])
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Errorf("%s %s failed: %s", req.Method, url, err.Error())
+		result.Fail()
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Errorf("error reading response body: %s", err.Error())
+		result.Fail()
+		return
+	}
+	result.Stdout = string(body)
+
+	expectedStatus := ht.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+	if resp.StatusCode != expectedStatus {
+		result.Errorf("%s %s returned incorrect status. Expected: %d, Actual: %d", req.Method, path, expectedStatus, resp.StatusCode)
+		result.Fail()
+	}
+	for _, header := range sortedKeys(ht.ExpectedHeaders) {
+		values, ok := resp.Header[http.CanonicalHeaderKey(header)]
+		if !ok {
+			result.Errorf("Expected header %s not found in response", header)
+			result.Fail()
+			continue
+		}
+		if !utils.CompileAndRunRegex(ht.ExpectedHeaders[header], strings.Join(values, ", "), true) {
+			result.Errorf("Header %s has incorrect value. Expected: %s, Actual: %s", header, ht.ExpectedHeaders[header], strings.Join(values, ", "))
+			result.Fail()
+		}
+	}
+	for _, s := range ht.ExpectedBody {
+		if !utils.CompileAndRunRegex(s, string(body), true) {
+			result.Errorf("Expected string '%s' not found in body '%s'", s, excerpt(string(body)))
+			result.Fail()
+		}
+	}
+	for _, s := range ht.ExcludedBody {
+		if !utils.CompileAndRunRegex(s, string(body), false) {
+			result.Errorf("Excluded string '%s' found in body '%s'", s, excerpt(string(body)))
+			result.Fail()
+		}
+	}
+	checkMatchers(result, "body", string(body), ht.BodyMatchers)
+	if ht.MaxResponseTime != "" {
+		if max := duration(ht.MaxResponseTime, 0); result.Duration > max {
+			result.Errorf("Response took %s, expected at most %s", result.Duration.Round(time.Millisecond), ht.MaxResponseTime)
+			result.Fail()
+		}
+	}
+}
+
+// client returns the client to make the request with. Redirects are not followed,
+// so that they can be asserted on.
+func (ht HTTPTest) client() (*http.Client, error) {
+	client := &http.Client{
+		Timeout: defaultRequestTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if ht.TLS == nil {
+		return client, nil
+	}
+	config := &tls.Config{
+		ServerName:         ht.TLS.ServerName,
+		InsecureSkipVerify: ht.TLS.InsecureSkipVerify,
+	}
+	if ht.TLS.CACert != "" {
+		pem, err := os.ReadFile(ht.TLS.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading tls.caCert")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls.caCert %s", ht.TLS.CACert)
+		}
+	}
+	client.Transport = &http.Transport{TLSClientConfig: config}
+	return client, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// handler stands in for a service running in a container.
+func handler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "ok", "version": "1.4.2"}`)
+	case "/echo":
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("X-Token"), body)
+	case "/slow":
+		time.Sleep(50 * time.Millisecond)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestHTTPTestCheck(t *testing.T) {
+	equals := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		test     HTTPTest
+		expected []string
+	}{
+		{
+			name: "json status",
+			test: HTTPTest{
+				Path:            "/status",
+				ExpectedHeaders: map[string]string{"content-type": "json"},
+				BodyMatchers: []Matcher{
+					{JSONPath: ".status", Equals: equals("ok")},
+					{JSONPath: ".version", Semver: ">= 1.4"},
+				},
+			},
+			expected: []string{},
+		},
+		{
+			name: "not found",
+			test: HTTPTest{
+				Path:            "/missing",
+				ExpectedHeaders: map[string]string{"X-Version": "1"},
+				ExcludedBody:    []string{"not found"},
+			},
+			expected: []string{
+				"GET /missing returned incorrect status. Expected: 200, Actual: 404",
+				"Expected header X-Version not found in response",
+				"Excluded string 'not found' found in body '404 page not found'",
+			},
+		},
+		{
+			name: "method, headers and body",
+			test: HTTPTest{
+				Method:       "post",
+				Path:         "/echo",
+				Headers:      map[string]string{"X-Token": "secret"},
+				Body:         "hello",
+				ExpectedBody: []string{"^POST secret hello$"},
+			},
+			expected: []string{},
+		},
+		{
+			name:     "response time",
+			test:     HTTPTest{Path: "/slow", MaxResponseTime: "10ms"},
+			expected: []string{"Response took"},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &types.TestResult{Pass: true, Errors: []string{}}
+			test.test.check(context.Background(), result, strings.TrimPrefix(server.URL, "http://"))
+			// errors are compared by prefix, since durations vary between runs
+			if len(result.Errors) != len(test.expected) {
+				t.Fatalf("expected errors %q, got %q", test.expected, result.Errors)
+			}
+			for i, e := range result.Errors {
+				if !strings.HasPrefix(e, test.expected[i]) {
+					t.Errorf("expected error starting with %q, got %q", test.expected[i], e)
+				}
+			}
+			testutil.CheckDeepEqual(t, len(test.expected) == 0, result.IsPass())
+		})
+	}
+}
+
+func TestHTTPTestResolvePaths(t *testing.T) {
+	st := &StructureTest{}
+	included := &StructureTest{HTTPTests: []HTTPTest{
+		{Name: "ca", TLS: &TLSConfig{CACert: "ca.pem"}},
+		{Name: "absolute", TLS: &TLSConfig{CACert: "/etc/ca.pem"}},
+		{Name: "plain"},
+	}}
+	if err := st.Merge(included, filepath.Join("common", "http.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	var caCerts []string
+	for _, ht := range st.HTTPTests {
+		if ht = ht.resolvePaths(filepath.Join("/configs", "config.yaml")); ht.TLS != nil {
+			caCerts = append(caCerts, ht.TLS.CACert)
+		}
+	}
+	testutil.CheckDeepEqual(t, []string{"/configs/common/ca.pem", "/etc/ca.pem"}, caCerts)
+}
+
+func TestHTTPTestCheckTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(handler))
+	defer server.Close()
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+		pass bool
+	}{
+		{name: "custom ca", tls: TLSConfig{CACert: caCert}, pass: true},
+		{name: "server name", tls: TLSConfig{CACert: caCert, ServerName: "example.com"}, pass: true},
+		{name: "wrong server name", tls: TLSConfig{CACert: caCert, ServerName: "example.org"}, pass: false},
+		{name: "unknown ca", tls: TLSConfig{}, pass: false},
+		{name: "insecure", tls: TLSConfig{InsecureSkipVerify: true}, pass: true},
+		// relative to the config file, rather than the working directory
+		{name: "relative ca", tls: TLSConfig{CACert: "ca.pem"}, pass: true},
+	}
+	configFile := filepath.Join(filepath.Dir(caCert), "config.yaml")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &types.TestResult{Pass: true}
+			tls := test.tls
+			HTTPTest{Path: "/status", TLS: &tls}.resolvePaths(configFile).check(context.Background(), result, addr)
+			testutil.CheckDeepEqual(t, test.pass, result.IsPass())
+		})
+	}
+}
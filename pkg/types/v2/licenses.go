@@ -15,6 +15,7 @@
 package v2
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
@@ -30,6 +31,8 @@ import (
 type LicenseTest struct {
 	Debian bool     `yaml:"debian"`
 	Files  []string `yaml:"files"`
+
+	Selection `yaml:",inline"` // tags and skipping
 }
 
 var (
@@ -42,9 +45,9 @@ var (
 	blacklist = []string{"AGPL", "WTFPL"}
 )
 
-func checkFile(licenseFile string, driver drivers.Driver) error {
+func checkFile(ctx context.Context, licenseFile string, driver drivers.Driver) error {
 	// Read through the copyright file and make sure don't have an unauthorized license
-	license, err := driver.ReadFile(licenseFile)
+	license, err := driver.ReadFile(ctx, licenseFile)
 	if err != nil {
 		return fmt.Errorf("Error reading license file for %s: %s", licenseFile, err.Error())
 	}
@@ -57,7 +60,27 @@ func checkFile(licenseFile string, driver drivers.Driver) error {
 	return nil
 }
 
-func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
+func (lt LicenseTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{
+		Name: lt.LogName(),
+	}
+	if !lt.Debian && len(lt.Files) == 0 {
+		res.Error("Please set debian or provide a list of files for every license test")
+	}
+	for _, file := range lt.Files {
+		if file == "" {
+			res.Error("License file path cannot be empty")
+		}
+	}
+	lt.Selection.validate(res)
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (lt LicenseTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name:   lt.LogName(),
 		Pass:   true,
@@ -66,7 +89,7 @@ func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
 	logrus.Debug(lt.LogName())
 	if lt.Debian {
 		root := utils.DebianRoot
-		packages, err := driver.ReadDir(root)
+		packages, err := driver.ReadDir(ctx, root)
 		if err != nil {
 			result.Errorf("Error reading directory: %s", err)
 			result.Fail()
@@ -91,13 +114,13 @@ func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
 
 			// If package doesn't have copyright file, log an error.
 			licenseFile := path.Join(root, p.Name(), utils.LicenseFile)
-			_, err := driver.StatFile(licenseFile)
+			_, err := driver.StatFile(ctx, licenseFile)
 			if err != nil {
 				result.Errorf("Error reading license file for %s: %s", p.Name(), err.Error())
 				result.Fail()
 			}
 
-			if err = checkFile(licenseFile, driver); err != nil {
+			if err = checkFile(ctx, licenseFile, driver); err != nil {
 				result.Error(err.Error())
 				result.Fail()
 			}
@@ -105,7 +128,7 @@ func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
 	}
 
 	for _, file := range lt.Files {
-		if err := checkFile(file, driver); err != nil {
+		if err := checkFile(ctx, file, driver); err != nil {
 			result.Error(err.Error())
 			result.Fail()
 		}
@@ -0,0 +1,259 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// maxExcerpt is the length of output quoted in matcher errors.
+const maxExcerpt = 80
+
+var (
+	versionRegex    = regexp.MustCompile(`\d+(\.\d+)+`)
+	constraintRegex = regexp.MustCompile(`^(>=|<=|==|!=|>|<|=)?\s*v?(\d+(\.\d+)*)$`)
+	jsonPathRegex   = regexp.MustCompile(`^(\.[^.\[\]]+|\[\d+\])+$`)
+	jsonStepRegex   = regexp.MustCompile(`\.[^.\[\]]+|\[\d+\]`)
+)
+
+// Matcher is an assertion on the output of a command or the contents of a file.
+// If a jsonPath is given, the assertions apply to the value it selects instead of
+// the whole text. All of the set assertions must hold for the matcher to pass.
+type Matcher struct {
+	Equals    *string `yaml:"equals"`    // the text must equal this, ignoring surrounding whitespace
+	Contains  string  `yaml:"contains"`  // the text must contain this string, taken literally
+	LineCount *int    `yaml:"lineCount"` // the text must have this many lines
+	JSONPath  string  `yaml:"jsonPath"`  // path of a value in the JSON text, e.g. .items[0].name
+	Semver    string  `yaml:"semver"`    // the first version in the text must satisfy this, e.g. ">= 1.20"
+	Not       bool    `yaml:"not"`       // negate the matcher
+}
+
+func validateMatchers(res *types.TestResult, field string, matchers []Matcher) {
+	for i, m := range matchers {
+		if m.Equals == nil && m.Contains == "" && m.LineCount == nil && m.JSONPath == "" && m.Semver == "" {
+			res.Errorf("%s[%d]: please provide at least one of equals, contains, lineCount, jsonPath or semver", field, i)
+		}
+		if m.JSONPath != "" && !jsonPathRegex.MatchString(m.JSONPath) {
+			res.Errorf("%s[%d]: invalid jsonPath %s, expected e.g. .items[0].name", field, i, m.JSONPath)
+		}
+		if m.Semver != "" && !constraintRegex.MatchString(strings.TrimSpace(m.Semver)) {
+			res.Errorf("%s[%d]: invalid semver constraint %s, expected e.g. >= 1.20", field, i, m.Semver)
+		}
+	}
+}
+
+// checkMatchers records an error for every matcher which does not hold for the
+// text, which is described by subject in error messages, e.g. "output".
+func checkMatchers(result *types.TestResult, subject string, text string, matchers []Matcher) {
+	for _, m := range matchers {
+		err := m.match(subject, text)
+		switch {
+		case err != nil && !m.Not:
+			result.Error(err.Error())
+			result.Fail()
+		case err == nil && m.Not:
+			result.Errorf("%s unexpectedly matched %s", subject, m.String())
+			result.Fail()
+		}
+	}
+}
+
+// match returns an error describing why the matcher does not hold for the text.
+func (m Matcher) match(subject, text string) error {
+	if m.JSONPath != "" {
+		value, err := selectJSON(text, m.JSONPath)
+		if err != nil {
+			return errors.Wrapf(err, "%s jsonPath %s", subject, m.JSONPath)
+		}
+		subject = fmt.Sprintf("%s jsonPath %s", subject, m.JSONPath)
+		text = value
+	}
+	if m.Equals != nil {
+		if err := diffText(*m.Equals, text); err != "" {
+			return fmt.Errorf("%s does not equal expected: %s", subject, err)
+		}
+	}
+	if m.Contains != "" && !strings.Contains(text, m.Contains) {
+		return fmt.Errorf("%s does not contain '%s': got '%s'", subject, m.Contains, excerpt(text))
+	}
+	if m.LineCount != nil {
+		if n := countLines(text); n != *m.LineCount {
+			return fmt.Errorf("%s has %d lines, expected %d", subject, n, *m.LineCount)
+		}
+	}
+	if m.Semver != "" {
+		version := versionRegex.FindString(text)
+		if version == "" {
+			return fmt.Errorf("no version found in %s: got '%s'", subject, excerpt(text))
+		}
+		if !satisfies(version, m.Semver) {
+			return fmt.Errorf("version %s in %s does not satisfy %s", version, subject, m.Semver)
+		}
+	}
+	return nil
+}
+
+// String describes the matcher in error messages.
+func (m Matcher) String() string {
+	var parts []string
+	if m.JSONPath != "" {
+		parts = append(parts, "jsonPath "+m.JSONPath)
+	}
+	if m.Equals != nil {
+		parts = append(parts, fmt.Sprintf("equals '%s'", excerpt(*m.Equals)))
+	}
+	if m.Contains != "" {
+		parts = append(parts, fmt.Sprintf("contains '%s'", m.Contains))
+	}
+	if m.LineCount != nil {
+		parts = append(parts, fmt.Sprintf("lineCount %d", *m.LineCount))
+	}
+	if m.Semver != "" {
+		parts = append(parts, "semver "+m.Semver)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// diffText compares two texts ignoring surrounding whitespace, and describes the
+// first line which differs, or returns the empty string if they are equal.
+func diffText(expected, actual string) string {
+	expected, actual = strings.TrimSpace(expected), strings.TrimSpace(actual)
+	if expected == actual {
+		return ""
+	}
+	expectedLines, actualLines := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		switch {
+		case i >= len(actualLines):
+			return fmt.Sprintf("line %d: missing, expected '%s'", i+1, excerpt(e))
+		case i >= len(expectedLines):
+			return fmt.Sprintf("line %d: unexpected '%s'", i+1, excerpt(a))
+		case e != a:
+			return fmt.Sprintf("line %d: expected '%s', got '%s'", i+1, excerpt(e), excerpt(a))
+		}
+	}
+	return ""
+}
+
+// selectJSON returns the value at the path in the JSON text. Strings are returned
+// as is, and other values in their JSON encoding.
+func selectJSON(text, path string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return "", errors.Wrap(err, "parsing JSON")
+	}
+	for _, step := range jsonStepRegex.FindAllString(path, -1) {
+		if strings.HasPrefix(step, "[") {
+			index, _ := strconv.Atoi(strings.Trim(step, "[]"))
+			list, ok := value.([]interface{})
+			if !ok || index >= len(list) {
+				return "", fmt.Errorf("index %s not found", step)
+			}
+			value = list[index]
+			continue
+		}
+		key := strings.TrimPrefix(step, ".")
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+		if value, ok = object[key]; !ok {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// satisfies reports whether the version satisfies the constraint, e.g. ">= 1.20".
+// Versions are compared numerically by component, missing components being zero.
+func satisfies(version, constraint string) bool {
+	match := constraintRegex.FindStringSubmatch(strings.TrimSpace(constraint))
+	if match == nil {
+		return false
+	}
+	c := compareVersions(version, match[2])
+	switch match[1] {
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	case "!=":
+		return c != 0
+	default:
+		return c == 0
+	}
+}
+
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func countLines(text string) int {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return 0
+	}
+	return strings.Count(text, "\n") + 1
+}
+
+func excerpt(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) > maxExcerpt {
+		return text[:maxExcerpt] + "..."
+	}
+	return text
+}
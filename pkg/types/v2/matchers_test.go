@@ -0,0 +1,125 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestCheckMatchers(t *testing.T) {
+	equals := func(s string) *string { return &s }
+	lines := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		text     string
+		matcher  Matcher
+		expected []string
+	}{
+		{
+			name:    "equals ignores surrounding whitespace",
+			text:    "hello\nworld\n",
+			matcher: Matcher{Equals: equals("hello\nworld")},
+		},
+		{
+			name:     "equals shows first differing line",
+			text:     "hello\nthere\nworld\n",
+			matcher:  Matcher{Equals: equals("hello\nworld")},
+			expected: []string{"output does not equal expected: line 2: expected 'world', got 'there'"},
+		},
+		{
+			name:    "contains is literal",
+			text:    "go version go1.20.3 linux/amd64",
+			matcher: Matcher{Contains: "go1.20.3 linux/amd64"},
+		},
+		{
+			name:     "contains",
+			text:     "go version go1.20.3 linux/amd64",
+			matcher:  Matcher{Contains: "go1.21"},
+			expected: []string{"output does not contain 'go1.21': got 'go version go1.20.3 linux/amd64'"},
+		},
+		{
+			name:     "line count",
+			text:     "a\nb\nc\n",
+			matcher:  Matcher{LineCount: lines(2)},
+			expected: []string{"output has 3 lines, expected 2"},
+		},
+		{
+			name:    "json path",
+			text:    `{"items": [{"name": "app", "replicas": 3}]}`,
+			matcher: Matcher{JSONPath: ".items[0].replicas", Equals: equals("3")},
+		},
+		{
+			name:     "json path mismatch",
+			text:     `{"items": [{"name": "app"}]}`,
+			matcher:  Matcher{JSONPath: ".items[0].name", Equals: equals("web")},
+			expected: []string{"output jsonPath .items[0].name does not equal expected: line 1: expected 'web', got 'app'"},
+		},
+		{
+			name:     "json path missing",
+			text:     `{"items": []}`,
+			matcher:  Matcher{JSONPath: ".items[0].name"},
+			expected: []string{"output jsonPath .items[0].name: index [0] not found"},
+		},
+		{
+			name:    "semver",
+			text:    "go version go1.20.3 linux/amd64",
+			matcher: Matcher{Semver: ">= 1.20"},
+		},
+		{
+			name:     "semver not satisfied",
+			text:     "jq-1.6",
+			matcher:  Matcher{Semver: ">= 1.7"},
+			expected: []string{"version 1.6 in output does not satisfy >= 1.7"},
+		},
+		{
+			name:    "negated",
+			text:    "hello",
+			matcher: Matcher{Contains: "error", Not: true},
+		},
+		{
+			name:     "negated match",
+			text:     "an error occurred",
+			matcher:  Matcher{Contains: "error", Not: true},
+			expected: []string{"output unexpectedly matched contains 'error'"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &types.TestResult{Pass: true}
+			checkMatchers(result, "output", test.text, []Matcher{test.matcher})
+			testutil.CheckDeepEqual(t, test.expected, result.Errors)
+			testutil.CheckDeepEqual(t, len(test.expected) == 0, result.Pass)
+		})
+	}
+}
+
+func TestValidateMatchers(t *testing.T) {
+	result := &types.TestResult{}
+	validateMatchers(result, "outputMatchers", []Matcher{
+		{},
+		{JSONPath: "items"},
+		{Semver: "~1.2"},
+		{Semver: "1.2.3"},
+	})
+	testutil.CheckDeepEqual(t, []string{
+		"outputMatchers[0]: please provide at least one of equals, contains, lineCount, jsonPath or semver",
+		"outputMatchers[1]: invalid jsonPath items, expected e.g. .items[0].name",
+		"outputMatchers[2]: invalid semver constraint ~1.2, expected e.g. >= 1.20",
+	}, result.Errors)
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"reflect"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// Merge adds the tests of an included config to this one. Included test names are
+// suffixed with the source they came from, and tests which are identical to an
+// existing one apart from their name are dropped. The metadata test and container
+// run options of the included config are only used if this config sets none, and
+// are a conflict if it sets different ones.
+func (st *StructureTest) Merge(included *StructureTest, source string) error {
+	// files on the host are resolved relative to the config file they are declared
+	// in, so the paths of the included config are made relative to this one. They are
+	// resolved on copies, so that the included config is left untouched.
+	snapshotTests := make([]SnapshotTest, len(included.SnapshotTests))
+	for i, test := range included.SnapshotTests {
+		test.Golden = configPath(source, test.Golden)
+		snapshotTests[i] = test
+	}
+	commandTests := make([]CommandTest, len(included.CommandTests))
+	for i, test := range included.CommandTests {
+		commandTests[i] = test.resolvePaths(source)
+	}
+	httpTests := make([]HTTPTest, len(included.HTTPTests))
+	for i, test := range included.HTTPTests {
+		httpTests[i] = test.resolvePaths(source)
+	}
+
+	st.CommandTests = mergeTests(st.CommandTests, commandTests, source)
+	st.FileExistenceTests = mergeTests(st.FileExistenceTests, included.FileExistenceTests, source)
+	st.FileContentTests = mergeTests(st.FileContentTests, included.FileContentTests, source)
+	st.DiffTests = mergeTests(st.DiffTests, included.DiffTests, source)
+	st.SnapshotTests = mergeTests(st.SnapshotTests, snapshotTests, source)
+	st.ServiceTests = mergeTests(st.ServiceTests, included.ServiceTests, source)
+	st.HTTPTests = mergeTests(st.HTTPTests, httpTests, source)
+	for _, test := range included.LicenseTests {
+		if !containsTest(st.LicenseTests, test) {
+			st.LicenseTests = append(st.LicenseTests, test)
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, envVar := range st.GlobalEnvVars {
+		keys[envVar.Key] = true
+	}
+	for _, envVar := range included.GlobalEnvVars {
+		if !keys[envVar.Key] {
+			st.GlobalEnvVars = append(st.GlobalEnvVars, envVar)
+		}
+	}
+
+	if st.MetadataTest.IsEmpty() {
+		st.MetadataTest = included.MetadataTest
+	} else if !included.MetadataTest.IsEmpty() && !reflect.DeepEqual(st.MetadataTest, included.MetadataTest) {
+		return mergeConflict("metadataTest", source)
+	}
+	if !st.ContainerRunOptions.IsSet() {
+		st.ContainerRunOptions = included.ContainerRunOptions
+	} else if included.ContainerRunOptions.IsSet() && !reflect.DeepEqual(st.ContainerRunOptions, included.ContainerRunOptions) {
+		return mergeConflict("containerRunOptions", source)
+	}
+	return nil
+}
+
+// mergeConflict reports a section of an included config which differs from the one
+// of the including config.
+func mergeConflict(section string, source string) error {
+	return types.ValidationError{
+		Section: section,
+		Index:   -1,
+		Message: fmt.Sprintf("the %s of %s conflicts with the one of the including config", section, source),
+	}
+}
+
+func mergeTests[T any](tests []T, included []T, source string) []T {
+	for _, test := range included {
+		if containsTest(tests, test) {
+			continue
+		}
+		name := reflect.ValueOf(&test).Elem().FieldByName("Name")
+		name.SetString(fmt.Sprintf("%s (from %s)", name.String(), source))
+		tests = append(tests, test)
+	}
+	return tests
+}
+
+// containsTest reports whether tests contains a test identical to the given one,
+// apart from its name.
+func containsTest[T any](tests []T, test T) bool {
+	for _, t := range tests {
+		if reflect.DeepEqual(withoutName(t), withoutName(test)) {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutName[T any](test T) T {
+	if name := reflect.ValueOf(&test).Elem().FieldByName("Name"); name.IsValid() {
+		name.SetString("")
+	}
+	return test
+}
@@ -15,6 +15,7 @@
 package v2
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
@@ -34,6 +35,8 @@ type MetadataTest struct {
 	UnmountedVolumes []string       `yaml:"unmountedVolumes"`
 	Labels           []types.Label  `yaml:"labels"`
 	User             string         `yaml:"user"`
+
+	Selection `yaml:",inline"` // tags and skipping
 }
 
 func (mt MetadataTest) IsEmpty() bool {
@@ -62,11 +65,17 @@ func (mt MetadataTest) Validate(channel chan interface{}) bool {
 		if envVar.Key == "" {
 			res.Error("Environment variable key cannot be empty")
 		}
+		if envVar.IsRegex {
+			validateRegexes(res, "envVars", []string{envVar.Value})
+		}
 	}
 	for _, label := range mt.Labels {
 		if label.Key == "" {
 			res.Error("Label key cannot be empty")
 		}
+		if label.IsRegex {
+			validateRegexes(res, "labels", []string{label.Value})
+		}
 	}
 	for _, port := range mt.ExposedPorts {
 		if port == "" {
@@ -78,6 +87,7 @@ func (mt MetadataTest) Validate(channel chan interface{}) bool {
 			res.Error("Volume cannot be empty")
 		}
 	}
+	mt.Selection.validate(res)
 	if len(res.Errors) > 0 {
 		channel <- res
 		return false
@@ -85,13 +95,13 @@ func (mt MetadataTest) Validate(channel chan interface{}) bool {
 	return true
 }
 
-func (mt MetadataTest) Run(driver drivers.Driver) *types.TestResult {
+func (mt MetadataTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
 		Name: mt.LogName(),
 		Pass: true,
 	}
 	logrus.Debug(mt.LogName())
-	imageConfig, err := driver.GetConfig()
+	imageConfig, err := driver.GetConfig(ctx)
 	if err != nil {
 		result.Errorf("Error retrieving image config: %s", err.Error())
 		result.Fail()
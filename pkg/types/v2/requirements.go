@@ -0,0 +1,137 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// requires returns the driver capabilities the command test needs. Teardown
+// commands are not required, since drivers without them run each test in a
+// throwaway environment.
+func (ct CommandTest) requires() []drivers.Capability {
+	required := []drivers.Capability{drivers.CapCommands}
+	if len(ct.Setup) > 0 {
+		required = append(required, drivers.CapSetup)
+	}
+	if ct.UseEntrypoint {
+		required = append(required, drivers.CapMetadata)
+	}
+	return required
+}
+
+// requires returns the driver capabilities the file existence test needs.
+func (ft FileExistenceTest) requires() []drivers.Capability {
+	var required []drivers.Capability
+	if ft.Uid != defaultOwnership || ft.Gid != defaultOwnership {
+		required = append(required, drivers.CapOwnership)
+	}
+	if ft.Capabilities != "" || len(ft.Xattrs) > 0 {
+		required = append(required, drivers.CapXattrs)
+	}
+	return required
+}
+
+// serviceRequirements are the driver capabilities service and HTTP tests need,
+// since services are started with the entrypoint of the image.
+var serviceRequirements = []drivers.Capability{drivers.CapServices, drivers.CapMetadata}
+
+// unsupported sends a result for a test which needs capabilities the driver lacks,
+// skipped or, with --strict, failed, and reports whether it did so.
+func (st *StructureTest) unsupported(channel chan interface{}, logName string, required []drivers.Capability) bool {
+	if len(required) == 0 {
+		return false
+	}
+	missing, err := st.missingCapabilities(required)
+	if err != nil {
+		channel <- &types.TestResult{
+			Name:   logName,
+			Errors: []string{fmt.Sprintf("error creating driver: %s", err.Error())},
+		}
+		return true
+	}
+	if len(missing) == 0 {
+		return false
+	}
+	names := make([]string, len(missing))
+	for i, c := range missing {
+		names[i] = string(c)
+	}
+	reason := fmt.Sprintf("the driver does not support %s", strings.Join(names, ", "))
+	if st.DriverArgs.Strict {
+		channel <- &types.TestResult{
+			Name:   logName,
+			Errors: []string{reason},
+		}
+	} else {
+		channel <- &types.TestResult{
+			Name:       logName,
+			Skipped:    true,
+			SkipReason: reason,
+		}
+	}
+	return true
+}
+
+// envConfig returns the config of the image which env vars in a test are expanded
+// with, or an empty one if the driver cannot retrieve it.
+func envConfig(ctx context.Context, driver drivers.Driver) types.Config {
+	for _, c := range driver.Capabilities() {
+		if c != drivers.CapMetadata {
+			continue
+		}
+		config, err := driver.GetConfig(ctx)
+		if err != nil {
+			logrus.Errorf("error retrieving image config: %s", err.Error())
+		}
+		return config
+	}
+	return types.Config{}
+}
+
+// missingCapabilities returns the required capabilities the driver lacks. They are
+// looked up from the driver args, and otherwise retrieved once from a driver created
+// for the purpose, for drivers the args do not name.
+func (st *StructureTest) missingCapabilities(required []drivers.Capability) ([]drivers.Capability, error) {
+	if st.capabilities == nil {
+		caps, ok := st.DriverArgs.Capabilities()
+		if !ok {
+			driver, err := st.NewDriver()
+			if err != nil {
+				return nil, err
+			}
+			caps = driver.Capabilities()
+			driver.Destroy()
+		}
+		st.capabilities = map[drivers.Capability]bool{}
+		for _, c := range caps {
+			st.capabilities[c] = true
+		}
+	}
+	var missing []drivers.Capability
+	for _, c := range required {
+		if !st.capabilities[c] {
+			missing = append(missing, c)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// fileOnlyDriver reads files, like the tar driver, but neither runs commands nor
+// reports ownership.
+type fileOnlyDriver struct {
+	fakeCommandDriver
+}
+
+func (d fileOnlyDriver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{drivers.CapMetadata}
+}
+
+func TestUnsupportedTests(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		created := 0
+		st := &StructureTest{
+			CommandTests: []CommandTest{{Name: "command", Command: "true"}},
+			FileExistenceTests: []FileExistenceTest{
+				{Name: "owned", Path: "/etc", ShouldExist: true, Uid: 0, Gid: defaultOwnership},
+			},
+			MetadataTest: MetadataTest{UnexposedPorts: []string{"80"}},
+		}
+		st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+			created++
+			return fileOnlyDriver{}, nil
+		}, drivers.DriverConfig{Strict: strict})
+
+		channel := make(chan interface{}, 10)
+		st.RunCommandTests(context.Background(), channel, "")
+		st.RunFileExistenceTests(context.Background(), channel)
+		st.RunMetadataTests(context.Background(), channel)
+		close(channel)
+		var results []string
+		for r := range channel {
+			res := r.(*types.TestResult)
+			switch {
+			case res.Skipped:
+				results = append(results, fmt.Sprintf("%s: skip: %s", res.Name, res.SkipReason))
+			case !res.IsPass():
+				results = append(results, fmt.Sprintf("%s: fail: %v", res.Name, res.Errors))
+			default:
+				results = append(results, fmt.Sprintf("%s: pass", res.Name))
+			}
+		}
+		if strict {
+			testutil.CheckDeepEqual(t, []string{
+				"Command Test: command: fail: [the driver does not support commands]",
+				"File Existence Test: owned: fail: [the driver does not support ownership]",
+				"Metadata Test: pass",
+			}, results)
+		} else {
+			testutil.CheckDeepEqual(t, []string{
+				"Command Test: command: skip: the driver does not support commands",
+				"File Existence Test: owned: skip: the driver does not support ownership",
+				"Metadata Test: pass",
+			}, results)
+		}
+		// the capabilities are retrieved once, and only the metadata test is run
+		testutil.CheckDeepEqual(t, 2, created)
+	}
+}
+
+func TestUnsupportedTestsOfNamedDriver(t *testing.T) {
+	created := 0
+	st := &StructureTest{
+		CommandTests: []CommandTest{{Name: "command", Command: "true"}},
+	}
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		created++
+		return fileOnlyDriver{}, nil
+	}, drivers.DriverConfig{Driver: drivers.Tar})
+
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(context.Background(), channel, "")
+	close(channel)
+	res := (<-channel).(*types.TestResult)
+	testutil.CheckDeepEqual(t, "the driver does not support commands", res.SkipReason)
+	// the capabilities of the tar driver are known without unpacking the image
+	testutil.CheckDeepEqual(t, 0, created)
+}
+
+func TestRequires(t *testing.T) {
+	testutil.CheckDeepEqual(t, []drivers.Capability{drivers.CapCommands, drivers.CapSetup},
+		CommandTest{Setup: [][]string{{"touch", "/tmp/x"}}, Teardown: [][]string{{"rm", "/tmp/x"}}}.requires())
+	testutil.CheckDeepEqual(t, []drivers.Capability(nil),
+		FileExistenceTest{Uid: defaultOwnership, Gid: defaultOwnership}.requires())
+	testutil.CheckDeepEqual(t, []drivers.Capability{drivers.CapOwnership, drivers.CapXattrs},
+		FileExistenceTest{Uid: 0, Gid: defaultOwnership, Capabilities: "cap_net_raw+ep"}.requires())
+}
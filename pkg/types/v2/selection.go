@@ -0,0 +1,206 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// Selection holds the fields shared by every test type which control whether it is run.
+type Selection struct {
+	Tags       []string   `yaml:"tags"`       // tags to select the test by from the command line
+	Skip       bool       `yaml:"skip"`       // whether to skip the test
+	SkipReason string     `yaml:"skipReason"` // why the test is skipped, reported along with it
+	When       *Condition `yaml:"when"`       // if set, the test is skipped unless the image matches
+}
+
+// Condition matches the platform and metadata of an image. All of its fields must
+// match for the condition to be met.
+type Condition struct {
+	Architecture []string       `yaml:"architecture"` // one of these architectures, e.g. amd64
+	OS           []string       `yaml:"os"`           // one of these operating systems, e.g. linux
+	Labels       []types.Label  `yaml:"labels"`       // labels which must be set, to the value if given
+	EnvVars      []types.EnvVar `yaml:"envVars"`      // env vars which must be set, to the value if given
+}
+
+func (s Selection) validate(res *types.TestResult) {
+	if s.When != nil {
+		s.When.validate(res)
+	}
+}
+
+func (c Condition) validate(res *types.TestResult) {
+	for _, label := range c.Labels {
+		if label.Key == "" {
+			res.Error("Label key cannot be empty in when")
+		}
+		if label.IsRegex {
+			validateRegexes(res, "when.labels", []string{label.Value})
+		}
+	}
+	for _, envVar := range c.EnvVars {
+		if envVar.Key == "" {
+			res.Error("Environment variable key cannot be empty in when")
+		}
+		if envVar.IsRegex {
+			validateRegexes(res, "when.envVars", []string{envVar.Value})
+		}
+	}
+}
+
+// unmetReason returns why the condition is not met by the image config, or the
+// empty string if it is.
+func (c Condition) unmetReason(config types.Config) string {
+	if len(c.Architecture) > 0 && !contains(c.Architecture, config.Architecture) {
+		return fmt.Sprintf("architecture is %s, not one of %s", config.Architecture, strings.Join(c.Architecture, ", "))
+	}
+	if len(c.OS) > 0 && !contains(c.OS, config.OS) {
+		return fmt.Sprintf("os is %s, not one of %s", config.OS, strings.Join(c.OS, ", "))
+	}
+	for _, label := range c.Labels {
+		if !matchesValue(config.Labels, label.Key, label.Value, label.IsRegex) {
+			return fmt.Sprintf("label %s does not match", label.Key)
+		}
+	}
+	for _, envVar := range c.EnvVars {
+		if !matchesValue(config.Env, envVar.Key, envVar.Value, envVar.IsRegex) {
+			return fmt.Sprintf("env var %s does not match", envVar.Key)
+		}
+	}
+	return ""
+}
+
+// matchesValue reports whether the key is set in m, to the given value if it is not empty.
+func matchesValue(m map[string]string, key, value string, isRegex bool) bool {
+	actual, ok := m[key]
+	if !ok {
+		return false
+	}
+	if value == "" {
+		return true
+	}
+	if isRegex {
+		return utils.CompileAndRunRegex(value, actual, true)
+	}
+	return actual == value
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// skipReason returns why a test with the given name is not run, or the empty string
+// if it should be run.
+func (s Selection) skipReason(name string, filter types.TestFilter) string {
+	if s.Skip {
+		if s.SkipReason != "" {
+			return s.SkipReason
+		}
+		return "skipped in config"
+	}
+	if filter.Run != nil && !filter.Run.MatchString(name) {
+		return fmt.Sprintf("name does not match --run %s", filter.Run.String())
+	}
+	if len(filter.IncludeTags) > 0 && !s.hasTag(filter.IncludeTags) {
+		return fmt.Sprintf("not tagged with any of %s", strings.Join(filter.IncludeTags, ", "))
+	}
+	for _, tag := range filter.ExcludeTags {
+		if s.hasTag([]string{tag}) {
+			return fmt.Sprintf("tagged with excluded tag %s", tag)
+		}
+	}
+	return ""
+}
+
+func (s Selection) hasTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, t := range s.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipped sends a skipped result for a test which is not selected by the filter of
+// the config, which needs driver capabilities it lacks, or whose condition is not
+// met by the image, and reports whether it did so. The name is matched against
+// --run, while the log name is reported.
+func (st *StructureTest) skipped(ctx context.Context, channel chan interface{}, logName string, name string, s Selection, required []drivers.Capability) bool {
+	reason := s.skipReason(name, st.Filter)
+	if reason == "" {
+		if s.When != nil {
+			// conditions are evaluated against the config of the image
+			required = append(required, drivers.CapMetadata)
+		}
+		if st.unsupported(channel, logName, required) {
+			return true
+		}
+	}
+	if reason == "" && s.When != nil {
+		config, err := st.imageConfig(ctx)
+		if err != nil {
+			channel <- &types.TestResult{
+				Name: logName,
+				Errors: []string{
+					fmt.Sprintf("error evaluating when: %s", err.Error()),
+				},
+			}
+			return true
+		}
+		if unmet := s.When.unmetReason(config); unmet != "" {
+			reason = "condition not met: " + unmet
+		}
+	}
+	if reason == "" {
+		return false
+	}
+	channel <- &types.TestResult{
+		Name:       logName,
+		Skipped:    true,
+		SkipReason: reason,
+	}
+	return true
+}
+
+// imageConfig retrieves the config of the image once, for evaluating conditions.
+func (st *StructureTest) imageConfig(ctx context.Context) (types.Config, error) {
+	if st.config != nil {
+		return *st.config, nil
+	}
+	driver, err := st.NewDriver()
+	if err != nil {
+		return types.Config{}, err
+	}
+	defer driver.Destroy()
+	config, err := driver.GetConfig(ctx)
+	if err != nil {
+		return types.Config{}, err
+	}
+	st.config = &config
+	return config, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"regexp"
+	"testing"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection Selection
+		filter    types.TestFilter
+		expected  string
+	}{
+		{
+			name:      "selected",
+			selection: Selection{Tags: []string{"fast"}},
+			filter:    types.TestFilter{IncludeTags: []string{"fast"}, ExcludeTags: []string{"slow"}},
+		},
+		{
+			name:      "skipped in config",
+			selection: Selection{Skip: true, SkipReason: "flaky"},
+			expected:  "flaky",
+		},
+		{
+			name:      "not included",
+			selection: Selection{Tags: []string{"slow"}},
+			filter:    types.TestFilter{IncludeTags: []string{"fast"}},
+			expected:  "not tagged with any of fast",
+		},
+		{
+			name:      "excluded",
+			selection: Selection{Tags: []string{"fast", "network"}},
+			filter:    types.TestFilter{ExcludeTags: []string{"network"}},
+			expected:  "tagged with excluded tag network",
+		},
+		{
+			name:     "name does not match",
+			filter:   types.TestFilter{Run: regexp.MustCompile("^root")},
+			expected: "name does not match --run ^root",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testutil.CheckDeepEqual(t, test.expected, test.selection.skipReason("test", test.filter))
+		})
+	}
+}
+
+func TestUnmetReason(t *testing.T) {
+	config := types.Config{
+		Architecture: "arm64",
+		OS:           "linux",
+		Labels:       map[string]string{"variant": "debug"},
+		Env:          map[string]string{"JAVA_VERSION": "17.0.2"},
+	}
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  string
+	}{
+		{
+			name: "met",
+			condition: Condition{
+				Architecture: []string{"amd64", "arm64"},
+				OS:           []string{"linux"},
+				Labels:       []types.Label{{Key: "variant", Value: "debug"}},
+				EnvVars:      []types.EnvVar{{Key: "JAVA_VERSION", Value: "^17\\.", IsRegex: true}},
+			},
+		},
+		{
+			name:      "architecture",
+			condition: Condition{Architecture: []string{"amd64"}},
+			expected:  "architecture is arm64, not one of amd64",
+		},
+		{
+			name:      "label value",
+			condition: Condition{Labels: []types.Label{{Key: "variant", Value: "release"}}},
+			expected:  "label variant does not match",
+		},
+		{
+			name:      "missing env var",
+			condition: Condition{EnvVars: []types.EnvVar{{Key: "DEBUG"}}},
+			expected:  "env var DEBUG does not match",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testutil.CheckDeepEqual(t, test.expected, test.condition.unmetReason(config))
+		})
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+const (
+	defaultReadyTimeout = 30 * time.Second
+	defaultStopTimeout  = 10 * time.Second
+	readyInterval       = 250 * time.Millisecond
+	probeTimeout        = 2 * time.Second
+)
+
+// ServiceTest starts the image with its own entrypoint and command, waits for it
+// to become ready, runs probe commands in it and finally stops it.
+type ServiceTest struct {
+	Name            string         `yaml:"name"`
+	EnvVars         []types.EnvVar `yaml:"envVars"`
+	Ready           Readiness      `yaml:"ready"`           // conditions the service has to meet before it is probed
+	Probes          []ServiceProbe `yaml:"probes"`          // commands run in the ready service
+	StopTimeout     string         `yaml:"stopTimeout"`     // time to wait for a graceful stop before killing, defaults to 10s
+	ExitCode        int            `yaml:"exitCode"`        // expected exit code once stopped
+	MaxShutdownTime string         `yaml:"maxShutdownTime"` // time the service may take to stop, if set
+
+	ContainerRunOptions *types.ContainerRunOptions `yaml:"containerRunOptions"` // overrides of the global run options
+
+	Selection `yaml:",inline"` // tags and skipping
+}
+
+// Readiness is the condition for a service to be ready. All of the set checks
+// have to pass; if none are set, the service is ready once it has started.
+type Readiness struct {
+	LogLine     string     `yaml:"logLine"`     // regex matched against the logs of the service
+	TCPPort     string     `yaml:"tcpPort"`     // port which accepts connections
+	HTTP        *HTTPCheck `yaml:"http"`        // HTTP endpoint which responds as expected
+	Healthcheck bool       `yaml:"healthcheck"` // the HEALTHCHECK of the image reports healthy
+	Timeout     string     `yaml:"timeout"`     // time to wait for the service to become ready, defaults to 30s
+}
+
+// HTTPCheck is a GET request made to a port of the service.
+type HTTPCheck struct {
+	Port   string `yaml:"port"`
+	Path   string `yaml:"path"`   // defaults to /
+	Status int    `yaml:"status"` // expected status code, defaults to 200
+	Body   string `yaml:"body"`   // regex matched against the response body
+}
+
+// ServiceProbe is a command run in a ready service.
+type ServiceProbe struct {
+	Name           string    `yaml:"name"`
+	Command        string    `yaml:"command"`
+	Args           []string  `yaml:"args"`
+	ExitCode       int       `yaml:"exitCode"`
+	ExpectedOutput []string  `yaml:"expectedOutput"`
+	ExcludedOutput []string  `yaml:"excludedOutput"`
+	ExpectedError  []string  `yaml:"expectedError"`
+	ExcludedError  []string  `yaml:"excludedError"`
+	OutputMatchers []Matcher `yaml:"outputMatchers"`
+	ErrorMatchers  []Matcher `yaml:"errorMatchers"`
+}
+
+func (st ServiceTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if st.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = st.Name
+	validateDuration(res, "stopTimeout", st.StopTimeout)
+	validateDuration(res, "maxShutdownTime", st.MaxShutdownTime)
+	st.Ready.validate(res)
+	for i, p := range st.Probes {
+		if p.Command == "" {
+			res.Errorf("Please provide a valid command to run for probes[%d] of test %s", i, st.Name)
+		}
+		validateRegexes(res, "expectedOutput", p.ExpectedOutput)
+		validateRegexes(res, "excludedOutput", p.ExcludedOutput)
+		validateRegexes(res, "expectedError", p.ExpectedError)
+		validateRegexes(res, "excludedError", p.ExcludedError)
+		validateMatchers(res, "outputMatchers", p.OutputMatchers)
+		validateMatchers(res, "errorMatchers", p.ErrorMatchers)
+	}
+	validateRunOptions(res, st.ContainerRunOptions)
+	st.Selection.validate(res)
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (r Readiness) validate(res *types.TestResult) {
+	validateDuration(res, "ready.timeout", r.Timeout)
+	validateRegexes(res, "ready.logLine", []string{r.LogLine})
+	validatePort(res, "ready.tcpPort", r.TCPPort)
+	if r.HTTP != nil {
+		if r.HTTP.Port == "" {
+			res.Errorf("Please provide a port for the http check of test %s", res.Name)
+		}
+		validatePort(res, "ready.http.port", r.HTTP.Port)
+		validateStatus(res, "ready.http.status", r.HTTP.Status)
+		validateRegexes(res, "ready.http.body", []string{r.HTTP.Body})
+	}
+}
+
+func validateStatus(res *types.TestResult, field string, status int) {
+	if status != 0 && (status < 100 || status > 599) {
+		res.Errorf("Invalid %s %d for test %s", field, status, res.Name)
+	}
+}
+
+func validateDuration(res *types.TestResult, field string, duration string) {
+	if duration == "" {
+		return
+	}
+	if _, err := time.ParseDuration(duration); err != nil {
+		res.Errorf("Invalid %s %s, expected e.g. 10s", field, duration)
+	}
+}
+
+func validatePort(res *types.TestResult, field string, port string) {
+	if port == "" {
+		return
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		res.Errorf("Invalid %s %s, expected a port number", field, port)
+	}
+}
+
+// duration parses a validated duration, returning the default if it is not set.
+func duration(d string, defaultDuration time.Duration) time.Duration {
+	if d == "" {
+		return defaultDuration
+	}
+	parsed, _ := time.ParseDuration(d)
+	return parsed
+}
+
+func (st ServiceTest) LogName() string {
+	return fmt.Sprintf("Service Test: %s", st.Name)
+}
+
+// ports returns the ports of the service which the readiness checks connect to.
+func (r Readiness) ports() []string {
+	var ports []string
+	if r.TCPPort != "" {
+		ports = append(ports, r.TCPPort)
+	}
+	if r.HTTP != nil && r.HTTP.Port != r.TCPPort {
+		ports = append(ports, r.HTTP.Port)
+	}
+	return ports
+}
+
+func (st ServiceTest) Run(ctx context.Context, driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   st.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(st.LogName())
+	serviceDriver, ok := driver.(drivers.ServiceDriver)
+	if !ok {
+		result.Error("service tests are not supported by this driver")
+		result.Fail()
+		return result
+	}
+	start := time.Now()
+	service, err := serviceDriver.StartService(ctx, st.EnvVars, st.Ready.ports())
+	if err != nil {
+		result.Errorf("error starting service: %s", err.Error())
+		result.Fail()
+		return result
+	}
+	defer service.Remove()
+	defer func() {
+		result.Duration = time.Since(start)
+		if stdout, stderr, err := service.Logs(); err == nil {
+			result.Stdout, result.Stderr = stdout, stderr
+		}
+	}()
+
+	if err := st.Ready.wait(ctx, service); err != nil {
+		result.Errorf("service did not become ready: %s", err.Error())
+		result.Fail()
+		return result
+	}
+	for _, p := range st.Probes {
+		st.runProbe(ctx, result, service, p)
+	}
+
+	stopStart := time.Now()
+	exitCode, err := service.Stop(duration(st.StopTimeout, defaultStopTimeout))
+	shutdownTime := time.Since(stopStart)
+	if err != nil {
+		result.Errorf("error stopping service: %s", err.Error())
+		result.Fail()
+		return result
+	}
+	if exitCode != st.ExitCode {
+		result.Errorf("Service exited with incorrect exit code. Expected: %d, Actual: %d", st.ExitCode, exitCode)
+		result.Fail()
+	}
+	if st.MaxShutdownTime != "" && shutdownTime > duration(st.MaxShutdownTime, 0) {
+		result.Errorf("Service took %s to stop, expected at most %s", shutdownTime.Round(time.Millisecond), st.MaxShutdownTime)
+		result.Fail()
+	}
+	return result
+}
+
+// wait polls the service until all readiness checks pass, it exits, the
+// timeout passes or the context is cancelled.
+func (r Readiness) wait(ctx context.Context, service drivers.Service) error {
+	deadline := time.Now().Add(duration(r.Timeout, defaultReadyTimeout))
+	for {
+		state, err := service.State()
+		if err != nil {
+			return err
+		}
+		if !state.Running {
+			return fmt.Errorf("service exited with code %d", state.ExitCode)
+		}
+		if r.Healthcheck && state.Health == "" {
+			return fmt.Errorf("the image has no HEALTHCHECK, or the driver does not report it")
+		}
+		unmet := r.check(ctx, service, state)
+		if unmet == "" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s: %s", duration(r.Timeout, defaultReadyTimeout), unmet)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// check returns the first readiness check which does not pass, or the empty
+// string if they all do.
+func (r Readiness) check(ctx context.Context, service drivers.Service, state drivers.ServiceState) string {
+	if r.LogLine != "" {
+		stdout, stderr, err := service.Logs()
+		if err != nil {
+			return err.Error()
+		}
+		if !utils.CompileAndRunRegex(r.LogLine, stdout+stderr, true) {
+			return fmt.Sprintf("no log line matching '%s'", r.LogLine)
+		}
+	}
+	if r.TCPPort != "" {
+		addr, err := service.Address(r.TCPPort)
+		if err != nil {
+			return err.Error()
+		}
+		dialer := net.Dialer{Timeout: probeTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Sprintf("port %s is not open: %s", r.TCPPort, err)
+		}
+		conn.Close()
+	}
+	if r.HTTP != nil {
+		if unmet := r.HTTP.check(ctx, service); unmet != "" {
+			return unmet
+		}
+	}
+	if r.Healthcheck && state.Health != "healthy" {
+		return fmt.Sprintf("healthcheck status is %s", state.Health)
+	}
+	return ""
+}
+
+func (h HTTPCheck) check(ctx context.Context, service drivers.Service) string {
+	addr, err := service.Address(h.Port)
+	if err != nil {
+		return err.Error()
+	}
+	path := h.Path
+	if path == "" {
+		path = "/"
+	}
+	url := fmt.Sprintf("http://%s%s", addr, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err.Error()
+	}
+	client := http.Client{Timeout: probeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("GET %s failed: %s", url, err)
+	}
+	defer resp.Body.Close()
+	status := h.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if resp.StatusCode != status {
+		return fmt.Sprintf("GET %s returned status %d, expected %d", url, resp.StatusCode, status)
+	}
+	if h.Body != "" {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Sprintf("GET %s failed reading body: %s", url, err)
+		}
+		if !utils.CompileAndRunRegex(h.Body, string(body), true) {
+			return fmt.Sprintf("GET %s returned body not matching '%s': got '%s'", url, h.Body, excerpt(string(body)))
+		}
+	}
+	return ""
+}
+
+// runProbe runs a probe command in the service, recording its failures in the
+// result of the test.
+func (st ServiceTest) runProbe(ctx context.Context, result *types.TestResult, service drivers.Service, p ServiceProbe) {
+	name := p.Name
+	if name == "" {
+		name = p.Command
+	}
+	stdout, stderr, exitCode, err := service.Exec(ctx, append([]string{p.Command}, p.Args...))
+	if err != nil {
+		result.Errorf("probe %s: %s", name, err.Error())
+		result.Fail()
+		return
+	}
+	probe := CommandTest{
+		Name:           name,
+		ExitCode:       p.ExitCode,
+		ExpectedOutput: p.ExpectedOutput,
+		ExcludedOutput: p.ExcludedOutput,
+		ExpectedError:  p.ExpectedError,
+		ExcludedError:  p.ExcludedError,
+		OutputMatchers: p.OutputMatchers,
+		ErrorMatchers:  p.ErrorMatchers,
+	}
+	probeResult := &types.TestResult{Pass: true}
+	probe.CheckOutput(probeResult, stdout, stderr, exitCode)
+	for _, e := range probeResult.Errors {
+		result.Errorf("probe %s: %s", name, e)
+	}
+	if !probeResult.Pass {
+		result.Fail()
+	}
+}
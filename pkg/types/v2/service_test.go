@@ -0,0 +1,126 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// fakeService is a service whose probes all output ok, and which exits with code
+// 143 once stopped.
+type fakeService struct {
+	logs  string
+	state drivers.ServiceState
+}
+
+func (s *fakeService) Logs() (string, string, error) { return s.logs, "", nil }
+
+func (s *fakeService) Exec(context.Context, []string) (string, string, int, error) {
+	return "ok\n", "", 0, nil
+}
+
+func (s *fakeService) Address(port string) (string, error) { return "127.0.0.1:" + port, nil }
+
+func (s *fakeService) State() (drivers.ServiceState, error) { return s.state, nil }
+
+func (s *fakeService) Stop(time.Duration) (int, error) {
+	s.state = drivers.ServiceState{ExitCode: 143}
+	return 143, nil
+}
+
+func (s *fakeService) Remove() {}
+
+type fakeServiceDriver struct {
+	drivers.Driver
+	service *fakeService
+}
+
+func (d fakeServiceDriver) StartService(_ context.Context, _ []types.EnvVar, _ []string) (drivers.Service, error) {
+	return d.service, nil
+}
+
+func TestServiceTestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		test     ServiceTest
+		service  fakeService
+		expected []string
+	}{
+		{
+			name: "ready and probed",
+			test: ServiceTest{
+				Ready:    Readiness{LogLine: "listening on \\d+"},
+				Probes:   []ServiceProbe{{Command: "status", ExpectedOutput: []string{"ok"}}},
+				ExitCode: 143,
+			},
+			service:  fakeService{logs: "listening on 8080\n", state: drivers.ServiceState{Running: true}},
+			expected: []string{},
+		},
+		{
+			name:     "exited before ready",
+			test:     ServiceTest{Ready: Readiness{LogLine: "listening"}},
+			service:  fakeService{state: drivers.ServiceState{ExitCode: 1}},
+			expected: []string{"service did not become ready: service exited with code 1"},
+		},
+		{
+			name:     "no healthcheck",
+			test:     ServiceTest{Ready: Readiness{Healthcheck: true}},
+			service:  fakeService{state: drivers.ServiceState{Running: true}},
+			expected: []string{"service did not become ready: the image has no HEALTHCHECK, or the driver does not report it"},
+		},
+		{
+			name: "timed out",
+			test: ServiceTest{Ready: Readiness{Healthcheck: true, Timeout: "1ms"}},
+			service: fakeService{state: drivers.ServiceState{
+				Running: true,
+				Health:  "starting",
+			}},
+			expected: []string{"service did not become ready: timed out after 1ms: healthcheck status is starting"},
+		},
+		{
+			name: "failing probe and exit code",
+			test: ServiceTest{
+				Probes: []ServiceProbe{{Name: "status", Command: "status", ExpectedOutput: []string{"healthy"}}},
+			},
+			service: fakeService{state: drivers.ServiceState{Running: true}},
+			expected: []string{
+				"probe status: Expected string 'healthy' not found in output 'ok\n'",
+				"Service exited with incorrect exit code. Expected: 0, Actual: 143",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.test.Run(context.Background(), fakeServiceDriver{service: &test.service})
+			testutil.CheckDeepEqual(t, test.expected, result.Errors)
+			testutil.CheckDeepEqual(t, len(test.expected) == 0, result.IsPass())
+		})
+	}
+}
+
+func TestReadinessWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service := &fakeService{state: drivers.ServiceState{Running: true, Health: "starting"}}
+	if err := (Readiness{Healthcheck: true, Timeout: "1h"}).wait(ctx, service); err != context.Canceled {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+}
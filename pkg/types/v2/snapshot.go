@@ -0,0 +1,92 @@
+// Copyright 2017 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/snapshot"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+type SnapshotTest struct {
+	Name   string   `yaml:"name"`   // name of test
+	Golden string   `yaml:"golden"` // golden file recorded by `container-structure-test snapshot`
+	Ignore []string `yaml:"ignore"` // patterns of paths and keys to ignore drift for
+
+	Selection `yaml:",inline"` // tags and skipping
+}
+
+func (st SnapshotTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if st.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = st.Name
+	if st.Golden == "" {
+		res.Errorf("Please provide a golden file for test %s", st.Name)
+	}
+	st.Selection.validate(res)
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (st SnapshotTest) LogName() string {
+	return fmt.Sprintf("Snapshot Test: %s", st.Name)
+}
+
+// goldenPath resolves the golden file relative to the config file it was declared in.
+func (st SnapshotTest) goldenPath(configFile string) string {
+	return configPath(configFile, st.Golden)
+}
+
+func (st SnapshotTest) Run(ctx context.Context, driver drivers.Driver, configFile string) *types.TestResult {
+	result := &types.TestResult{
+		Name:   st.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(st.LogName())
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	golden, err := snapshot.Load(st.goldenPath(configFile))
+	if err != nil {
+		result.Errorf("Error loading golden file: %s", err)
+		result.Fail()
+		return result
+	}
+	actual, err := snapshot.Record(ctx, driver, golden.Options)
+	if err != nil {
+		result.Errorf("Error recording snapshot: %s", err)
+		result.Fail()
+		return result
+	}
+	for _, diff := range snapshot.Diff(golden, actual, st.Ignore) {
+		result.Error(diff)
+		result.Fail()
+	}
+	return result
+}
@@ -15,149 +15,361 @@
 package v2
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/GoogleContainerTools/container-structure-test/internal/pkgutil"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
 	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 )
 
 type StructureTest struct {
-	DriverImpl          func(drivers.DriverConfig) (drivers.Driver, error)
-	DriverArgs          drivers.DriverConfig
-	SchemaVersion       string                    `yaml:"schemaVersion"`
-	GlobalEnvVars       []types.EnvVar            `yaml:"globalEnvVars"`
-	CommandTests        []CommandTest             `yaml:"commandTests"`
-	FileExistenceTests  []FileExistenceTest       `yaml:"fileExistenceTests"`
-	FileContentTests    []FileContentTest         `yaml:"fileContentTests"`
-	MetadataTest        MetadataTest              `yaml:"metadataTest"`
-	LicenseTests        []LicenseTest             `yaml:"licenseTests"`
-	ContainerRunOptions types.ContainerRunOptions `yaml:"containerRunOptions"`
+	DriverImpl          func(drivers.DriverConfig) (drivers.Driver, error) `yaml:"-" json:"-"`
+	DriverArgs          drivers.DriverConfig                               `yaml:"-" json:"-"`
+	Filter              types.TestFilter                                   `yaml:"-" json:"-"`
+	SchemaVersion       string                                             `yaml:"schemaVersion"`
+	Include             []string                                           `yaml:"include"` // config files or directories of config files to include
+	Vars                map[string]string                                  `yaml:"vars"`    // default values of the template variables
+	GlobalEnvVars       []types.EnvVar                                     `yaml:"globalEnvVars"`
+	CommandTests        []CommandTest                                      `yaml:"commandTests"`
+	FileExistenceTests  []FileExistenceTest                                `yaml:"fileExistenceTests"`
+	FileContentTests    []FileContentTest                                  `yaml:"fileContentTests"`
+	MetadataTest        MetadataTest                                       `yaml:"metadataTest"`
+	LicenseTests        []LicenseTest                                      `yaml:"licenseTests"`
+	DiffTests           []DiffTest                                         `yaml:"diffTests"`
+	SnapshotTests       []SnapshotTest                                     `yaml:"snapshotTests"`
+	ServiceTests        []ServiceTest                                      `yaml:"serviceTests"`
+	HTTPTests           []HTTPTest                                         `yaml:"httpTests"`
+	ContainerRunOptions types.ContainerRunOptions                          `yaml:"containerRunOptions"`
+
+	config       *types.Config               // image config, retrieved once for evaluating conditions
+	vars         map[string]string           // variables captured by the command tests run so far
+	skippedVars  map[string]bool             // variables of the command tests skipped so far
+	capabilities map[drivers.Capability]bool // capabilities of the driver, retrieved once
 }
 
 func (st *StructureTest) NewDriver() (drivers.Driver, error) {
+	return st.newDriver("", st.ContainerRunOptions)
+}
+
+// newDriver creates a driver for a test with the given container run options,
+// usually the global ones overridden by the ones of the test.
+func (st *StructureTest) newDriver(testName string, runOpts types.ContainerRunOptions) (drivers.Driver, error) {
 	args := st.DriverArgs
-	if st.ContainerRunOptions.IsSet() {
-		args.RunOpts = st.ContainerRunOptions
+	args.TestName = testName
+	if runOpts.IsSet() {
+		args.RunOpts = runOpts
 	}
 	return st.DriverImpl(args)
 }
 
+func (st *StructureTest) SetFilter(filter types.TestFilter) {
+	st.Filter = filter
+}
+
 func (st *StructureTest) SetDriverImpl(f func(drivers.DriverConfig) (drivers.Driver, error), args drivers.DriverConfig) {
 	st.DriverImpl = f
 	st.DriverArgs = args
+	st.capabilities = nil
+}
+
+// Validate checks every test in the config, without creating any drivers.
+func (st *StructureTest) Validate() []types.ValidationError {
+	var errs []types.ValidationError
+	for i, test := range st.CommandTests {
+		errs = append(errs, collectValidationErrors("commandTests", i, test.Validate)...)
+	}
+	for i, test := range st.FileExistenceTests {
+		errs = append(errs, collectValidationErrors("fileExistenceTests", i, test.Validate)...)
+	}
+	for i, test := range st.FileContentTests {
+		errs = append(errs, collectValidationErrors("fileContentTests", i, test.Validate)...)
+	}
+	if !st.MetadataTest.IsEmpty() {
+		errs = append(errs, collectValidationErrors("metadataTest", -1, st.MetadataTest.Validate)...)
+	}
+	if err := drivers.ValidateRunOptions(st.ContainerRunOptions); err != nil {
+		errs = append(errs, types.ValidationError{Section: "containerRunOptions", Index: -1, Message: err.Error()})
+	}
+	for i, test := range st.LicenseTests {
+		errs = append(errs, collectValidationErrors("licenseTests", i, test.Validate)...)
+	}
+	for i, test := range st.DiffTests {
+		errs = append(errs, collectValidationErrors("diffTests", i, test.Validate)...)
+	}
+	for i, test := range st.SnapshotTests {
+		errs = append(errs, collectValidationErrors("snapshotTests", i, test.Validate)...)
+	}
+	for i, test := range st.ServiceTests {
+		errs = append(errs, collectValidationErrors("serviceTests", i, test.Validate)...)
+	}
+	for i, test := range st.HTTPTests {
+		errs = append(errs, collectValidationErrors("httpTests", i, test.Validate)...)
+	}
+
+	var names []string
+	for _, test := range st.CommandTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("commandTests", names)...)
+	errs = append(errs, st.validateCaptures()...)
+	names = nil
+	for _, test := range st.FileExistenceTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("fileExistenceTests", names)...)
+	names = nil
+	for _, test := range st.FileContentTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("fileContentTests", names)...)
+	names = nil
+	for _, test := range st.DiffTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("diffTests", names)...)
+	names = nil
+	for _, test := range st.SnapshotTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("snapshotTests", names)...)
+	names = nil
+	for _, test := range st.ServiceTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("serviceTests", names)...)
+	names = nil
+	for _, test := range st.HTTPTests {
+		names = append(names, test.Name)
+	}
+	errs = append(errs, validateNames("httpTests", names)...)
+	return errs
 }
 
-func (st *StructureTest) RunAll(channel chan interface{}, file string) {
+// invalid checks a single test before it is run, and reports it as failed under its
+// log name if it is invalid.
+func invalid(channel chan interface{}, logName string, validate func(chan interface{}) bool) bool {
+	results := make(chan interface{}, 1)
+	if validate(results) {
+		return false
+	}
+	res := (<-results).(*types.TestResult)
+	res.Name = logName
+	channel <- res
+	return true
+}
+
+// collectValidationErrors runs the validation of a single test, and returns the
+// errors it would have reported on the results channel.
+func collectValidationErrors(section string, index int, validate func(chan interface{}) bool) []types.ValidationError {
+	channel := make(chan interface{}, 1)
+	if validate(channel) {
+		return nil
+	}
+	var errs []types.ValidationError
+	for _, msg := range (<-channel).(*types.TestResult).Errors {
+		errs = append(errs, types.ValidationError{
+			Section: section,
+			Index:   index,
+			Message: msg,
+		})
+	}
+	return errs
+}
+
+// RunAll runs every test in the config. Callers are expected to have checked the
+// whole config with Validate beforehand, which also reports problems across tests;
+// each Run*Tests method still checks a test on its own before running it, and
+// reports it as failed if it is invalid. Once the context is cancelled, no further
+// tests are started.
+func (st *StructureTest) RunAll(ctx context.Context, channel chan interface{}, file string) {
 	fileProcessed := make(chan bool, 1)
-	go st.runAll(channel, fileProcessed)
+	go st.runAll(ctx, channel, file, fileProcessed)
 	<-fileProcessed
 }
 
-func (st *StructureTest) runAll(channel chan interface{}, fileProcessed chan bool) {
-	st.RunCommandTests(channel)
-	st.RunFileContentTests(channel)
-	st.RunFileExistenceTests(channel)
-	st.RunLicenseTests(channel)
-	st.RunMetadataTests(channel)
+func (st *StructureTest) runAll(ctx context.Context, channel chan interface{}, file string, fileProcessed chan bool) {
+	st.RunCommandTests(ctx, channel, file)
+	st.RunFileContentTests(ctx, channel)
+	st.RunFileExistenceTests(ctx, channel)
+	st.RunLicenseTests(ctx, channel)
+	st.RunMetadataTests(ctx, channel)
+	st.RunDiffTests(ctx, channel)
+	st.RunSnapshotTests(ctx, channel, file)
+	st.RunServiceTests(ctx, channel)
+	st.RunHTTPTests(ctx, channel, file)
 	fileProcessed <- true
 }
 
-func (st *StructureTest) RunCommandTests(channel chan interface{}) {
+// RunCommandTests runs the command tests, reading their stdin and fixture files
+// relative to the config file.
+func (st *StructureTest) RunCommandTests(ctx context.Context, channel chan interface{}, file string) {
+	if st.vars == nil {
+		st.vars = map[string]string{}
+	}
 	for _, test := range st.CommandTests {
-		if !test.Validate(channel) {
-			continue
+		if ctx.Err() != nil {
+			return
 		}
-		res := &types.TestResult{
-			Name: test.Name,
-			Pass: false,
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			res.Errorf("error creating driver: %s", err.Error())
-			channel <- res
+		if invalid(channel, test.LogName(), test.Validate) {
 			continue
 		}
-		defer driver.Destroy()
-		if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
-			res.Errorf("error setting env vars: %s", err.Error())
-			channel <- res
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, test.requires()) {
+			st.skipCaptures(test)
 			continue
 		}
-		if err = driver.Setup(test.EnvVars, test.Setup); err != nil {
-			res.Errorf("error in setup: %s", err.Error())
+		if res := st.uncaptured(test.LogName(), test.references()); res != nil {
+			if res.Skipped {
+				st.skipCaptures(test)
+			}
 			channel <- res
 			continue
 		}
-		defer func() {
-			if err := driver.Teardown(test.Teardown); err != nil {
-				logrus.Error(err.Error())
-			}
-		}()
-		channel <- test.Run(driver)
+		test = test.expand(st.vars).resolvePaths(file)
+		res := st.runCommandTest(ctx, test, st.ContainerRunOptions.Override(test.ContainerRunOptions), st.vars)
+		compare := st.DriverArgs.Compatibility && ctx.Err() == nil
+		if compare && !res.IsPass() {
+			// there is no point re-running a test which already fails
+			res.Error("Not compared in compatibility mode, as the test fails in the default run")
+		}
+		channel <- res
+		if compare && res.IsPass() {
+			channel <- st.runCompatibilityTest(ctx, test)
+		}
 	}
 }
 
-func (st *StructureTest) RunFileExistenceTests(channel chan interface{}) {
+// runCommandTest runs a command test, with its setup and teardown, in a new driver
+// with the given container run options. Captured variables are stored in vars.
+func (st *StructureTest) runCommandTest(ctx context.Context, test CommandTest, runOpts types.ContainerRunOptions, vars map[string]string) (res *types.TestResult) {
+	res = &types.TestResult{
+		Name: test.LogName(),
+		Pass: false,
+	}
+	driver, err := st.newDriver(test.LogName(), runOpts)
+	if err != nil {
+		res.Errorf("error creating driver: %s", err.Error())
+		return res
+	}
+	defer func() { st.destroy(driver, res) }()
+	if err = driver.SetEnv(ctx, st.GlobalEnvVars); err != nil {
+		res.Errorf("error setting env vars: %s", err.Error())
+		return res
+	}
+	if err = driver.Setup(ctx, test.EnvVars, test.Setup); err != nil {
+		res.Errorf("error in setup: %s", err.Error())
+		return res
+	}
+	defer func() {
+		// the environment of a test kept for debugging is left as it failed
+		if res.Debug != "" {
+			return
+		}
+		// teardown commands still run once the run is cancelled
+		if err := driver.Teardown(context.WithoutCancel(ctx), test.Teardown); err != nil {
+			logrus.Error(err.Error())
+		}
+	}()
+	res = test.Run(ctx, driver, vars)
+	if !res.IsPass() && st.DriverArgs.DebugOnFailure {
+		st.keepForDebugging(ctx, driver, test, res)
+	}
+	return res
+}
+
+func (st *StructureTest) RunFileExistenceTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.FileExistenceTests {
-		if !test.Validate(channel) {
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
+			continue
+		}
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, test.requires()) {
+			continue
+		}
+		if res := st.uncaptured(test.LogName(), test.references()); res != nil {
+			channel <- res
 			continue
 		}
+		test = test.expand(st.vars)
 		res := &types.TestResult{
-			Name: test.Name,
+			Name: test.LogName(),
 			Pass: false,
 		}
-		driver, err := st.NewDriver()
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions)
 		if err != nil {
 			res.Errorf("error creating driver: %s", err.Error())
 			channel <- res
 			continue
 		}
-		if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
+		if err = driver.SetEnv(ctx, st.GlobalEnvVars); err != nil {
 			res.Errorf("error setting env vars: %s", err.Error())
+			st.destroy(driver, res)
 			channel <- res
 			continue
 		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+		res = test.Run(ctx, driver)
+		st.destroy(driver, res)
+		channel <- res
 	}
 }
 
-func (st *StructureTest) RunFileContentTests(channel chan interface{}) {
+func (st *StructureTest) RunFileContentTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.FileContentTests {
-		if !test.Validate(channel) {
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
 			continue
 		}
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, nil) {
+			continue
+		}
+		if res := st.uncaptured(test.LogName(), test.references()); res != nil {
+			channel <- res
+			continue
+		}
+		test = test.expand(st.vars)
 		res := &types.TestResult{
-			Name: test.Name,
+			Name: test.LogName(),
 			Pass: false,
 		}
-		driver, err := st.NewDriver()
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions)
 		if err != nil {
 			res.Errorf("error creating driver: %s", err.Error())
 			channel <- res
 			continue
 		}
-		if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
+		if err = driver.SetEnv(ctx, st.GlobalEnvVars); err != nil {
 			res.Errorf("error setting env vars: %s", err.Error())
+			st.destroy(driver, res)
 			channel <- res
 			continue
 		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+		res = test.Run(ctx, driver)
+		st.destroy(driver, res)
+		channel <- res
 	}
 }
 
-func (st *StructureTest) RunMetadataTests(channel chan interface{}) {
+func (st *StructureTest) RunMetadataTests(ctx context.Context, channel chan interface{}) {
+	if ctx.Err() != nil {
+		return
+	}
 	if st.MetadataTest.IsEmpty() {
 		logrus.Debug("Skipping empty metadata test")
 		return
 	}
-	if !st.MetadataTest.Validate(channel) {
+	if invalid(channel, st.MetadataTest.LogName(), st.MetadataTest.Validate) {
 		return
 	}
-	driver, err := st.NewDriver()
+	if st.skipped(ctx, channel, st.MetadataTest.LogName(), st.MetadataTest.LogName(), st.MetadataTest.Selection, []drivers.Capability{drivers.CapMetadata}) {
+		return
+	}
+	driver, err := st.newDriver(st.MetadataTest.LogName(), st.ContainerRunOptions)
 	if err != nil {
 		channel <- &types.TestResult{
 			Name: st.MetadataTest.LogName(),
@@ -167,17 +379,195 @@ func (st *StructureTest) RunMetadataTests(channel chan interface{}) {
 		}
 		return
 	}
-	channel <- st.MetadataTest.Run(driver)
-	driver.Destroy()
+	res := st.MetadataTest.Run(ctx, driver)
+	st.destroy(driver, res)
+	channel <- res
 }
 
-func (st *StructureTest) RunLicenseTests(channel chan interface{}) {
+func (st *StructureTest) RunLicenseTests(ctx context.Context, channel chan interface{}) {
 	for _, test := range st.LicenseTests {
-		driver, err := st.NewDriver()
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
+			continue
+		}
+		if st.skipped(ctx, channel, test.LogName(), test.LogName(), test.Selection, nil) {
+			continue
+		}
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions)
 		if err != nil {
-			logrus.Fatal(err.Error())
+			channel <- &types.TestResult{
+				Name: test.LogName(),
+				Errors: []string{
+					fmt.Sprintf("error creating driver: %s", err.Error()),
+				},
+			}
+			continue
 		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+		res := test.Run(ctx, driver)
+		st.destroy(driver, res)
+		channel <- res
 	}
 }
+
+func (st *StructureTest) RunDiffTests(ctx context.Context, channel chan interface{}) {
+	for _, test := range st.DiffTests {
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
+			continue
+		}
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, nil) {
+			continue
+		}
+		res := &types.TestResult{
+			Name: test.LogName(),
+			Pass: false,
+		}
+		baselineImage := test.BaselineImage
+		if baselineImage == "" {
+			baselineImage = st.DriverArgs.BaselineImage
+		}
+		if baselineImage == "" {
+			res.Error("no baseline image provided; please set baselineImage or pass --baseline-image")
+			channel <- res
+			continue
+		}
+		if st.DriverArgs.Image == "" {
+			res.Error("diff tests require an image and are not supported by the host driver")
+			channel <- res
+			continue
+		}
+		resolve := pkgutil.ResolveImage
+		cleanup := pkgutil.CleanupImage
+		if cache := st.DriverArgs.ImageCache; cache != nil {
+			// the filesystems of cached images are owned by the cache
+			resolve = cache.Get
+			cleanup = func(pkgutil.Image) {}
+		}
+		image, err := resolve(st.DriverArgs.Image)
+		if err != nil {
+			res.Errorf("error retrieving image: %s", err.Error())
+			channel <- res
+			continue
+		}
+		baseline, err := resolve(baselineImage)
+		if err != nil {
+			cleanup(image)
+			res.Errorf("error retrieving baseline image: %s", err.Error())
+			channel <- res
+			continue
+		}
+		channel <- test.Run(image, baseline)
+		if !st.DriverArgs.Save {
+			cleanup(image)
+			cleanup(baseline)
+		}
+	}
+}
+
+func (st *StructureTest) RunSnapshotTests(ctx context.Context, channel chan interface{}, file string) {
+	for _, test := range st.SnapshotTests {
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
+			continue
+		}
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, []drivers.Capability{drivers.CapMetadata}) {
+			continue
+		}
+		res := &types.TestResult{
+			Name: test.LogName(),
+			Pass: false,
+		}
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions)
+		if err != nil {
+			res.Errorf("error creating driver: %s", err.Error())
+			channel <- res
+			continue
+		}
+		if err = driver.SetEnv(ctx, st.GlobalEnvVars); err != nil {
+			res.Errorf("error setting env vars: %s", err.Error())
+			st.destroy(driver, res)
+			channel <- res
+			continue
+		}
+		res = test.Run(ctx, driver, file)
+		st.destroy(driver, res)
+		channel <- res
+	}
+}
+
+func (st *StructureTest) RunServiceTests(ctx context.Context, channel chan interface{}) {
+	for _, test := range st.ServiceTests {
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
+			continue
+		}
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, serviceRequirements) {
+			continue
+		}
+		res := &types.TestResult{
+			Name: test.LogName(),
+			Pass: false,
+		}
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions.Override(test.ContainerRunOptions))
+		if err != nil {
+			res.Errorf("error creating driver: %s", err.Error())
+			channel <- res
+			continue
+		}
+		// the global env vars are passed to the service directly, since committing
+		// them to a new image would override its entrypoint and command.
+		test.EnvVars = append(append([]types.EnvVar{}, st.GlobalEnvVars...), test.EnvVars...)
+		res = test.Run(ctx, driver)
+		st.destroy(driver, res)
+		channel <- res
+	}
+}
+
+// RunHTTPTests runs the HTTP tests, reading their CA certificates relative to the
+// config file.
+func (st *StructureTest) RunHTTPTests(ctx context.Context, channel chan interface{}, file string) {
+	for _, test := range st.HTTPTests {
+		if ctx.Err() != nil {
+			return
+		}
+		if invalid(channel, test.LogName(), test.Validate) {
+			continue
+		}
+		if st.skipped(ctx, channel, test.LogName(), test.Name, test.Selection, serviceRequirements) {
+			continue
+		}
+		res := &types.TestResult{
+			Name: test.LogName(),
+			Pass: false,
+		}
+		driver, err := st.newDriver(test.LogName(), st.ContainerRunOptions.Override(test.ContainerRunOptions))
+		if err != nil {
+			res.Errorf("error creating driver: %s", err.Error())
+			channel <- res
+			continue
+		}
+		// as with service tests, the global env vars are passed to the service directly
+		test.EnvVars = append(append([]types.EnvVar{}, st.GlobalEnvVars...), test.EnvVars...)
+		res = test.resolvePaths(file).Run(ctx, driver)
+		st.destroy(driver, res)
+		channel <- res
+	}
+}
+
+// destroy destroys the driver of a test. The containers and images it kept with
+// --save or for debugging are listed in the result of the test first, so that they
+// can be inspected.
+func (st *StructureTest) destroy(driver drivers.Driver, res *types.TestResult) {
+	if resourceDriver, ok := driver.(drivers.ResourceDriver); ok && (st.DriverArgs.Save || res.Debug != "") {
+		res.Containers, res.Images = resourceDriver.Resources()
+	}
+	driver.Destroy()
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// cancellingDriver cancels the run while its command is running.
+type cancellingDriver struct {
+	fakeCommandDriver
+	cancel    context.CancelFunc
+	destroyed *int
+}
+
+func (d cancellingDriver) ProcessCommand(ctx context.Context, _ []types.EnvVar, _ []string, _ drivers.ExecOptions) (string, string, int, error) {
+	d.cancel()
+	return "", "", -1, ctx.Err()
+}
+
+func (d cancellingDriver) Destroy() { *d.destroyed++ }
+
+func TestRunCommandTestsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	destroyed := 0
+	st := &StructureTest{
+		CommandTests: []CommandTest{
+			{Name: "interrupted", Command: "sleep"},
+			{Name: "never started", Command: "sleep"},
+		},
+	}
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		return cancellingDriver{cancel: cancel, destroyed: &destroyed}, nil
+	}, drivers.DriverConfig{Compatibility: true})
+
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(ctx, channel, "")
+	close(channel)
+	var names []string
+	for r := range channel {
+		names = append(names, r.(*types.TestResult).Name)
+	}
+	// the compatibility run and the remaining tests are not started
+	testutil.CheckDeepEqual(t, []string{"Command Test: interrupted"}, names)
+	// along with the driver created to retrieve the capabilities of the driver
+	testutil.CheckDeepEqual(t, 2, destroyed)
+}
+
+// savingDriver reports the resources it created.
+type savingDriver struct {
+	fakeCommandDriver
+}
+
+func (d savingDriver) Resources() ([]string, []string) {
+	return []string{"container"}, []string{"image"}
+}
+
+func TestSavedResources(t *testing.T) {
+	for _, save := range []bool{false, true} {
+		st := &StructureTest{CommandTests: []CommandTest{{Name: "saved", Command: "true"}}}
+		st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+			return savingDriver{}, nil
+		}, drivers.DriverConfig{Save: save})
+
+		channel := make(chan interface{}, 1)
+		st.RunCommandTests(context.Background(), channel, "")
+		res := (<-channel).(*types.TestResult)
+		if save {
+			testutil.CheckDeepEqual(t, []string{"container"}, res.Containers)
+			testutil.CheckDeepEqual(t, []string{"image"}, res.Images)
+		} else if res.Containers != nil || res.Images != nil {
+			t.Errorf("expected no resources to be listed without --save, got %v %v", res.Containers, res.Images)
+		}
+	}
+}
+
+// failingEnvDriver fails to set up the environment of every test.
+type failingEnvDriver struct {
+	fakeCommandDriver
+}
+
+func (d failingEnvDriver) SetEnv(context.Context, []types.EnvVar) error {
+	return errors.New("no env")
+}
+
+func (d failingEnvDriver) Capabilities() []drivers.Capability {
+	return append(d.fakeCommandDriver.Capabilities(), drivers.CapOwnership)
+}
+
+func TestResultNames(t *testing.T) {
+	skipped := Selection{Skip: true}
+	st := &StructureTest{
+		CommandTests:       []CommandTest{{Name: "run", Command: "true"}, {Name: "skip", Command: "true", Selection: skipped}},
+		FileExistenceTests: []FileExistenceTest{{Name: "run", Path: "/"}, {Name: "skip", Path: "/", Selection: skipped}},
+		FileContentTests:   []FileContentTest{{Name: "run", Path: "/"}, {Name: "skip", Path: "/", Selection: skipped}},
+	}
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		return failingEnvDriver{}, nil
+	}, drivers.DriverConfig{})
+
+	channel := make(chan interface{}, 10)
+	ctx := context.Background()
+	st.RunCommandTests(ctx, channel, "")
+	st.RunFileExistenceTests(ctx, channel)
+	st.RunFileContentTests(ctx, channel)
+	close(channel)
+	var names []string
+	for r := range channel {
+		names = append(names, r.(*types.TestResult).Name)
+	}
+	// tests which fail early are named the same as the ones which run or are skipped
+	testutil.CheckDeepEqual(t, []string{
+		"Command Test: run", "Command Test: skip",
+		"File Existence Test: run", "File Existence Test: skip",
+		"File Content Test: run", "File Content Test: skip",
+	}, names)
+}
+
+// inputDriver records the stdin and files of the commands it runs.
+type inputDriver struct {
+	fakeCommandDriver
+	inputs *[]string
+}
+
+func (d inputDriver) ProcessCommand(_ context.Context, _ []types.EnvVar, _ []string, opts drivers.ExecOptions) (string, string, int, error) {
+	*d.inputs = append(*d.inputs, string(opts.Stdin))
+	for _, f := range opts.Files {
+		*d.inputs = append(*d.inputs, string(f.Contents))
+	}
+	return "", "", 0, nil
+}
+
+func TestInputFilesRelativeToConfig(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{"stdin.txt": "stdin", "common/fixture.json": "fixture"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := &StructureTest{CommandTests: []CommandTest{{Name: "stdin", Command: "cat", StdinFile: "stdin.txt"}}}
+	// the files of an included config are relative to it
+	included := &StructureTest{CommandTests: []CommandTest{
+		{Name: "files", Command: "cat", Files: []FileFixture{{Source: "fixture.json", Target: "/tmp/fixture.json"}}},
+	}}
+	if err := st.Merge(included, filepath.Join("common", "checks.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		return inputDriver{inputs: &inputs}, nil
+	}, drivers.DriverConfig{})
+
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(context.Background(), channel, filepath.Join(dir, "config.yaml"))
+	close(channel)
+	for r := range channel {
+		if res := r.(*types.TestResult); !res.IsPass() {
+			t.Errorf("expected %s to pass, got %v", res.Name, res.Errors)
+		}
+	}
+	testutil.CheckDeepEqual(t, []string{"stdin", "", "fixture"}, inputs)
+}
+
+func TestMergeLeavesIncludedUntouched(t *testing.T) {
+	newIncluded := func() *StructureTest {
+		return &StructureTest{
+			SnapshotTests: []SnapshotTest{{Name: "snapshot", Golden: "golden.yaml"}},
+			CommandTests: []CommandTest{
+				{Name: "files", Command: "cat", Files: []FileFixture{{Source: "fixture.json", Target: "/tmp/fixture.json"}}},
+			},
+			HTTPTests: []HTTPTest{{Name: "https", TLS: &TLSConfig{CACert: "ca.pem"}}},
+		}
+	}
+	included := newIncluded()
+	// a config included by two others is resolved against each of them
+	for _, st := range []*StructureTest{{}, {}} {
+		if err := st.Merge(included, filepath.Join("common", "checks.yaml")); err != nil {
+			t.Fatal(err)
+		}
+		testutil.CheckDeepEqual(t, filepath.Join("common", "golden.yaml"), st.SnapshotTests[0].Golden)
+		testutil.CheckDeepEqual(t, filepath.Join("common", "fixture.json"), st.CommandTests[0].Files[0].Source)
+		testutil.CheckDeepEqual(t, filepath.Join("common", "ca.pem"), st.HTTPTests[0].TLS.CACert)
+	}
+	expected := newIncluded()
+	testutil.CheckDeepEqual(t, expected.SnapshotTests, included.SnapshotTests)
+	testutil.CheckDeepEqual(t, expected.CommandTests, included.CommandTests)
+	testutil.CheckDeepEqual(t, expected.HTTPTests, included.HTTPTests)
+}
+
+func TestRunInvalidTests(t *testing.T) {
+	st := &StructureTest{
+		CommandTests:       []CommandTest{{Name: "no command"}},
+		FileExistenceTests: []FileExistenceTest{{Name: "no path"}},
+	}
+	created := 0
+	st.SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error) {
+		created++
+		return fakeCommandDriver{}, nil
+	}, drivers.DriverConfig{})
+
+	// library callers may run tests without validating the config first
+	channel := make(chan interface{}, 10)
+	st.RunCommandTests(context.Background(), channel, "")
+	st.RunFileExistenceTests(context.Background(), channel)
+	close(channel)
+	var names []string
+	for r := range channel {
+		res := r.(*types.TestResult)
+		if res.IsPass() || len(res.Errors) == 0 {
+			t.Errorf("expected %s to fail validation, got %+v", res.Name, res)
+		}
+		names = append(names, res.Name)
+	}
+	testutil.CheckDeepEqual(t, []string{"Command Test: no command", "File Existence Test: no path"}, names)
+	testutil.CheckDeepEqual(t, 0, created)
+}
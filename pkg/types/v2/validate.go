@@ -0,0 +1,65 @@
+// Copyright 2017 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"regexp"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// permissionsRegex matches the format of os.FileMode.String(), e.g. -rwxr-xr-x or dtrwxrwxrwx
+var permissionsRegex = regexp.MustCompile(`^(-|[dalTLDpSugct?]+)([r-][w-][x-]){3}$`)
+
+// validateRegexes records an error for every regex of the given field which does not compile.
+func validateRegexes(res *types.TestResult, field string, regexes []string) {
+	for _, r := range regexes {
+		if _, err := regexp.Compile(r); err != nil {
+			res.Errorf("Invalid regex '%s' in %s: %s", r, field, err)
+		}
+	}
+}
+
+// validateRunOptions records an error if the container run options of a test are
+// invalid.
+func validateRunOptions(res *types.TestResult, opts *types.ContainerRunOptions) {
+	if opts == nil {
+		return
+	}
+	if err := drivers.ValidateRunOptions(*opts); err != nil {
+		res.Errorf("Invalid containerRunOptions: %s", err)
+	}
+}
+
+// validateNames records an error for every test name which is used more than once.
+func validateNames(section string, names []string) []types.ValidationError {
+	var errs []types.ValidationError
+	seen := map[string]bool{}
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, types.ValidationError{
+				Section: section,
+				Index:   i,
+				Message: "Duplicate test name " + name,
+			})
+		}
+		seen[name] = true
+	}
+	return errs
+}
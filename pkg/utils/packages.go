@@ -0,0 +1,91 @@
+// Copyright 2017 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+const (
+	DpkgStatusFile   string = "/var/lib/dpkg/status"
+	ApkInstalledFile string = "/lib/apk/db/installed"
+)
+
+// GetPackages returns the installed packages of an image, mapped to their versions.
+// readFile is used to retrieve the package databases from the image; databases that
+// cannot be read are assumed not to exist.
+func GetPackages(readFile func(string) ([]byte, error)) map[string]string {
+	packages := map[string]string{}
+	if contents, err := readFile(DpkgStatusFile); err == nil {
+		for name, version := range ParseDpkgStatus(contents) {
+			packages[name] = version
+		}
+	}
+	if contents, err := readFile(ApkInstalledFile); err == nil {
+		for name, version := range ParseApkInstalled(contents) {
+			packages[name] = version
+		}
+	}
+	return packages
+}
+
+// ParseDpkgStatus parses the contents of a dpkg status file, returning
+// all packages which are currently installed.
+func ParseDpkgStatus(contents []byte) map[string]string {
+	packages := map[string]string{}
+	for _, stanza := range bytes.Split(contents, []byte("\n\n")) {
+		var name, version, status string
+		scanner := bufio.NewScanner(bytes.NewReader(stanza))
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "Package:"):
+				name = strings.TrimSpace(strings.TrimPrefix(line, "Package:"))
+			case strings.HasPrefix(line, "Version:"):
+				version = strings.TrimSpace(strings.TrimPrefix(line, "Version:"))
+			case strings.HasPrefix(line, "Status:"):
+				status = strings.TrimSpace(strings.TrimPrefix(line, "Status:"))
+			}
+		}
+		if name != "" && strings.HasSuffix(status, " installed") {
+			packages[name] = version
+		}
+	}
+	return packages
+}
+
+// ParseApkInstalled parses the contents of an apk installed database.
+func ParseApkInstalled(contents []byte) map[string]string {
+	packages := map[string]string{}
+	for _, stanza := range bytes.Split(contents, []byte("\n\n")) {
+		var name, version string
+		scanner := bufio.NewScanner(bytes.NewReader(stanza))
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "P:"):
+				name = strings.TrimPrefix(line, "P:")
+			case strings.HasPrefix(line, "V:"):
+				version = strings.TrimPrefix(line, "V:")
+			}
+		}
+		if name != "" {
+			packages[name] = version
+		}
+	}
+	return packages
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestParseDpkgStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected map[string]string
+	}{
+		{
+			name: "installed packages",
+			contents: `Package: base-files
+Status: install ok installed
+Priority: required
+Version: 12.4+deb12u5
+Description: Debian base system miscellaneous files
+ This package contains the basic filesystem hierarchy.
+
+Package: libc6
+Status: install ok installed
+Architecture: amd64
+Version: 2.36-9+deb12u4
+`,
+			expected: map[string]string{"base-files": "12.4+deb12u5", "libc6": "2.36-9+deb12u4"},
+		},
+		{
+			name: "removed packages",
+			contents: `Package: curl
+Status: deinstall ok config-files
+Version: 7.88.1-10
+
+Package: tzdata
+Status: install ok installed
+Version: 2024a-0+deb12u1
+`,
+			expected: map[string]string{"tzdata": "2024a-0+deb12u1"},
+		},
+		{
+			name:     "empty",
+			expected: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testutil.CheckDeepEqual(t, test.expected, ParseDpkgStatus([]byte(test.contents)))
+		})
+	}
+}
+
+func TestParseApkInstalled(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected map[string]string
+	}{
+		{
+			name: "installed packages",
+			contents: `C:Q1Z0sOW5SnqfXxBN5UCwb8ML3bCsc=
+P:musl
+V:1.2.4-r2
+A:x86_64
+T:the musl c library (libc) implementation
+
+C:Q1ZZ1aZ3Ay0k2fvFwPbmDxe7Hr5hA=
+P:busybox
+V:1.36.1-r15
+`,
+			expected: map[string]string{"musl": "1.2.4-r2", "busybox": "1.36.1-r15"},
+		},
+		{
+			name:     "empty",
+			expected: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testutil.CheckDeepEqual(t, test.expected, ParseApkInstalled([]byte(test.contents)))
+		})
+	}
+}
+
+func TestGetPackages(t *testing.T) {
+	files := map[string]string{
+		DpkgStatusFile:   "Package: libc6\nStatus: install ok installed\nVersion: 2.36\n",
+		ApkInstalledFile: "P:musl\nV:1.2.4-r2\n",
+	}
+	readFile := func(path string) ([]byte, error) {
+		if contents, ok := files[path]; ok {
+			return []byte(contents), nil
+		}
+		return nil, errors.New("not found")
+	}
+	testutil.CheckDeepEqual(t, map[string]string{"libc6": "2.36", "musl": "1.2.4-r2"}, GetPackages(readFile))
+
+	delete(files, ApkInstalledFile)
+	delete(files, DpkgStatusFile)
+	testutil.CheckDeepEqual(t, map[string]string{}, GetPackages(readFile))
+}
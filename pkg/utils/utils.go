@@ -17,7 +17,9 @@ package utils
 import (
 	"fmt"
 	"os"
+	"path"
 	"regexp"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -85,6 +87,20 @@ func SubstituteEnvVar(arg string, env map[string]string) string {
 	return subbed
 }
 
+// SubstituteVars expands the variables set in vars, and leaves any other
+// variable reference untouched so that it can be substituted later on.
+func SubstituteVars(arg string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return arg
+	}
+	return os.Expand(arg, func(key string) string {
+		if value, ok := vars[key]; ok {
+			return value
+		}
+		return "${" + key + "}"
+	})
+}
+
 func SubstituteEnvVars(args []string, env map[string]string) []string {
 	finalArgs := []string{}
 	for _, arg := range args {
@@ -92,3 +108,30 @@ func SubstituteEnvVars(args []string, env map[string]string) []string {
 	}
 	return finalArgs
 }
+
+// MatchesPath reports whether the given path, or any of its parent directories,
+// matches the shell pattern (see path.Match).
+func MatchesPath(pattern string, p string) bool {
+	for p = path.Clean(p); ; p = path.Dir(p) {
+		if matched, _ := path.Match(pattern, p); matched {
+			return true
+		}
+		if p == "/" || p == "." {
+			return false
+		}
+	}
+}
+
+// ShellJoin joins the arguments of a command into a line which can be pasted into
+// a POSIX shell, quoting the ones with special characters.
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=.,/:@%") == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}